@@ -0,0 +1,505 @@
+package thingscloud
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// now is used by builders to set creation and modification dates
+var now = time.Now
+
+// TaskBuilder creates TaskActionItems to create or modify tasks and projects
+type TaskBuilder struct {
+	item TaskActionItem
+}
+
+// NewTask starts building a new pending task with the defaults written by things for mac
+func NewTask(title string) *TaskBuilder {
+	ts := now()
+	return &TaskBuilder{
+		item: TaskActionItem{
+			Item: Item{
+				UUID:   uuid.New().String(),
+				Kind:   ItemKindTask,
+				Action: ItemActionCreated,
+			},
+			P: TaskActionItemPayload{
+				Title:                  String(title),
+				Status:                 Status(TaskStatusPending),
+				Schedule:               Schedule(TaskScheduleAnytime),
+				CreationDate:           Time(ts),
+				ModificationDate:       Time(ts),
+				Index:                  intVal(0),
+				TaskIndex:              intVal(0),
+				Type:                   Type(TaskTypeTask),
+				InTrash:                boolVal(false),
+				InstanceCreationPaused: boolVal(false),
+				InstanceCreationCount:  intVal(0),
+				DeadlineOffset:         intVal(0),
+				StartBucket:            bucket(StartBucketDay),
+				AreaIDs:                ids(),
+				ParentTaskIDs:          ids(),
+				ActionGroupIDs:         ids(),
+				RecurrenceTaskIDs:      ids(),
+				DelegateIDs:            ids(),
+			},
+		},
+	}
+}
+
+// NewProject starts building a new pending project
+func NewProject(title string) *TaskBuilder {
+	return NewTask(title).AsProject()
+}
+
+// NewHeading starts building a new heading within a project
+func NewHeading(title string, project *Task) *TaskBuilder {
+	b := NewTask(title).InProject(project)
+	b.item.P.Type = Type(TaskTypeHeading)
+	return b
+}
+
+// EditTask starts building modifications of an existing task, project or heading
+func EditTask(uuid string) *TaskBuilder {
+	return &TaskBuilder{
+		item: TaskActionItem{
+			Item: Item{
+				UUID:   uuid,
+				Kind:   ItemKindTask,
+				Action: ItemActionModified,
+			},
+			P: TaskActionItemPayload{
+				ModificationDate: Time(now()),
+			},
+		},
+	}
+}
+
+// DeleteTask creates an item deleting a task or project
+func DeleteTask(uuid string) TaskActionItem {
+	return TaskActionItem{
+		Item: Item{
+			UUID:   uuid,
+			Kind:   ItemKindTask,
+			Action: ItemActionDeleted,
+		},
+	}
+}
+
+// Build returns the item, ready to be written to a history
+func (b *TaskBuilder) Build() TaskActionItem {
+	return b.item
+}
+
+// WithTitle changes the title
+func (b *TaskBuilder) WithTitle(title string) *TaskBuilder {
+	b.item.P.Title = String(title)
+	return b
+}
+
+// WithNote changes the note
+func (b *TaskBuilder) WithNote(text string) *TaskBuilder {
+	b.item.P.Note = Some(NewNote(text))
+	return b
+}
+
+// AsProject turns the task into a project
+func (b *TaskBuilder) AsProject() *TaskBuilder {
+	b.item.P.Type = Type(TaskTypeProject)
+	return b
+}
+
+// AtIndex changes the sort order within the parent
+func (b *TaskBuilder) AtIndex(index int) *TaskBuilder {
+	b.item.P.Index = intVal(index)
+	return b
+}
+
+// InArea moves the task into an area
+func (b *TaskBuilder) InArea(area *Area) *TaskBuilder {
+	b.item.P.AreaIDs = ids(area.UUID)
+	return b
+}
+
+// InProject moves the task into a project, outside of any heading
+func (b *TaskBuilder) InProject(project *Task) *TaskBuilder {
+	b.item.P.ParentTaskIDs = ids(project.UUID)
+	b.item.P.ActionGroupIDs = ids()
+	return b
+}
+
+// UnderHeading moves the task below a heading. Tasks below headings reference
+// the heading only, the project is derived from the heading
+func (b *TaskBuilder) UnderHeading(heading *Heading) *TaskBuilder {
+	b.item.P.ParentTaskIDs = ids()
+	b.item.P.ActionGroupIDs = ids(heading.UUID)
+	return b
+}
+
+// WithTags replaces the tags of the task
+func (b *TaskBuilder) WithTags(tags ...*Tag) *TaskBuilder {
+	b.item.P.TagIDs = tagIDs(tags)
+	return b
+}
+
+// ScheduledFor sets the start date to the calendar day of t, in the location of t
+func (b *TaskBuilder) ScheduledFor(t time.Time) *TaskBuilder {
+	return b.ScheduledOn(DayOf(t))
+}
+
+// ScheduledOn sets the start date
+func (b *TaskBuilder) ScheduledOn(day Day) *TaskBuilder {
+	b.item.P.ScheduledDate = Some(day)
+	b.item.P.TaskIR = Some(day)
+	return b
+}
+
+// Unscheduled removes the start date
+func (b *TaskBuilder) Unscheduled() *TaskBuilder {
+	b.item.P.ScheduledDate = Null[Day]()
+	b.item.P.TaskIR = Null[Day]()
+	return b
+}
+
+// Today schedules the task for today in the local time zone
+func (b *TaskBuilder) Today() *TaskBuilder {
+	return b.TodayIn(time.Local)
+}
+
+// TodayIn schedules the task for today in loc, e.g. the time zone of the user
+func (b *TaskBuilder) TodayIn(loc *time.Location) *TaskBuilder {
+	b.item.P.Schedule = Schedule(TaskScheduleToday)
+	b.item.P.StartBucket = bucket(StartBucketDay)
+	return b.ScheduledOn(TodayIn(loc))
+}
+
+// ThisEvening schedules the task for this evening in the local time zone
+func (b *TaskBuilder) ThisEvening() *TaskBuilder {
+	return b.ThisEveningIn(time.Local)
+}
+
+// ThisEveningIn schedules the task for this evening in loc, e.g. the time zone of the user
+func (b *TaskBuilder) ThisEveningIn(loc *time.Location) *TaskBuilder {
+	b.TodayIn(loc)
+	b.item.P.StartBucket = bucket(StartBucketEvening)
+	return b
+}
+
+// Anytime moves the task to anytime
+func (b *TaskBuilder) Anytime() *TaskBuilder {
+	b.item.P.Schedule = Schedule(TaskScheduleAnytime)
+	return b
+}
+
+// Someday moves the task to someday
+func (b *TaskBuilder) Someday() *TaskBuilder {
+	b.item.P.Schedule = Schedule(TaskScheduleSomeday)
+	return b
+}
+
+// DeadlineAt sets the deadline to the calendar day of t, in the location of t
+func (b *TaskBuilder) DeadlineAt(t time.Time) *TaskBuilder {
+	return b.DeadlineOn(DayOf(t))
+}
+
+// DeadlineOn sets the deadline
+func (b *TaskBuilder) DeadlineOn(day Day) *TaskBuilder {
+	b.item.P.DeadlineDate = Some(day)
+	return b
+}
+
+// WithoutDeadline removes the deadline
+func (b *TaskBuilder) WithoutDeadline() *TaskBuilder {
+	b.item.P.DeadlineDate = Null[Day]()
+	return b
+}
+
+// RemindAt schedules the task for the day of t, in the location of t, and sets a reminder at the time of t
+func (b *TaskBuilder) RemindAt(t time.Time) *TaskBuilder {
+	b.ScheduledOn(DayOf(t))
+	b.item.P.AlarmTimeOffset = Some(reminderOffset(t).Seconds())
+	b.item.P.LastAlarmInteractionDate = Null[Timestamp]()
+	return b
+}
+
+// WithoutReminder removes the reminder, keeping the start date
+func (b *TaskBuilder) WithoutReminder() *TaskBuilder {
+	b.item.P.AlarmTimeOffset = Null[float64]()
+	b.item.P.LastAlarmInteractionDate = Null[Timestamp]()
+	return b
+}
+
+// Complete marks the task as completed now
+func (b *TaskBuilder) Complete() *TaskBuilder {
+	b.item.P.Status = Status(TaskStatusCompleted)
+	b.item.P.CompletionDate = Some(Timestamp(now()))
+	return b
+}
+
+// Cancel marks the task as canceled now
+func (b *TaskBuilder) Cancel() *TaskBuilder {
+	b.item.P.Status = Status(TaskStatusCanceled)
+	b.item.P.CompletionDate = Some(Timestamp(now()))
+	return b
+}
+
+// Reopen marks the task as pending
+func (b *TaskBuilder) Reopen() *TaskBuilder {
+	b.item.P.Status = Status(TaskStatusPending)
+	b.item.P.CompletionDate = Null[Timestamp]()
+	return b
+}
+
+// Trash moves the task into the trash
+func (b *TaskBuilder) Trash() *TaskBuilder {
+	b.item.P.InTrash = boolVal(true)
+	return b
+}
+
+// Restore moves the task out of the trash
+func (b *TaskBuilder) Restore() *TaskBuilder {
+	b.item.P.InTrash = boolVal(false)
+	return b
+}
+
+// CheckListItemBuilder creates CheckListActionItems
+type CheckListItemBuilder struct {
+	item CheckListActionItem
+}
+
+// NewCheckListItem starts building a new pending check list item
+func NewCheckListItem(title string) *CheckListItemBuilder {
+	ts := now()
+	return &CheckListItemBuilder{
+		item: CheckListActionItem{
+			Item: Item{
+				UUID:   uuid.New().String(),
+				Kind:   ItemKindChecklistItem,
+				Action: ItemActionCreated,
+			},
+			P: CheckListActionItemPayload{
+				Title:            String(title),
+				Status:           Status(TaskStatusPending),
+				CreationDate:     Time(ts),
+				ModificationDate: Time(ts),
+				Index:            intVal(0),
+				TaskIDs:          ids(),
+			},
+		},
+	}
+}
+
+// EditCheckListItem starts building modifications of an existing check list item
+func EditCheckListItem(uuid string) *CheckListItemBuilder {
+	return &CheckListItemBuilder{
+		item: CheckListActionItem{
+			Item: Item{
+				UUID:   uuid,
+				Kind:   ItemKindChecklistItem,
+				Action: ItemActionModified,
+			},
+			P: CheckListActionItemPayload{
+				ModificationDate: Time(now()),
+			},
+		},
+	}
+}
+
+// DeleteCheckListItem creates an item deleting a check list item
+func DeleteCheckListItem(uuid string) CheckListActionItem {
+	return CheckListActionItem{
+		Item: Item{
+			UUID:   uuid,
+			Kind:   ItemKindChecklistItem,
+			Action: ItemActionDeleted,
+		},
+	}
+}
+
+// Build returns the item, ready to be written to a history
+func (b *CheckListItemBuilder) Build() CheckListActionItem {
+	return b.item
+}
+
+// WithTitle changes the title
+func (b *CheckListItemBuilder) WithTitle(title string) *CheckListItemBuilder {
+	b.item.P.Title = String(title)
+	return b
+}
+
+// AtIndex changes the sort order within the task
+func (b *CheckListItemBuilder) AtIndex(index int) *CheckListItemBuilder {
+	b.item.P.Index = intVal(index)
+	return b
+}
+
+// InTask moves the check list item to a task
+func (b *CheckListItemBuilder) InTask(task *Task) *CheckListItemBuilder {
+	b.item.P.TaskIDs = ids(task.UUID)
+	return b
+}
+
+// Complete marks the check list item as completed now
+func (b *CheckListItemBuilder) Complete() *CheckListItemBuilder {
+	b.item.P.Status = Status(TaskStatusCompleted)
+	b.item.P.CompletionDate = Some(Timestamp(now()))
+	return b
+}
+
+// Reopen marks the check list item as pending
+func (b *CheckListItemBuilder) Reopen() *CheckListItemBuilder {
+	b.item.P.Status = Status(TaskStatusPending)
+	b.item.P.CompletionDate = Null[Timestamp]()
+	return b
+}
+
+// AreaBuilder creates AreaActionItems
+type AreaBuilder struct {
+	item AreaActionItem
+}
+
+// NewArea starts building a new area
+func NewArea(title string) *AreaBuilder {
+	return &AreaBuilder{
+		item: AreaActionItem{
+			Item: Item{
+				UUID:   uuid.New().String(),
+				Kind:   ItemKindArea,
+				Action: ItemActionCreated,
+			},
+			P: AreaActionItemPayload{
+				Title: String(title),
+				IX:    intVal(0),
+			},
+		},
+	}
+}
+
+// EditArea starts building modifications of an existing area
+func EditArea(uuid string) *AreaBuilder {
+	return &AreaBuilder{
+		item: AreaActionItem{
+			Item: Item{
+				UUID:   uuid,
+				Kind:   ItemKindArea,
+				Action: ItemActionModified,
+			},
+		},
+	}
+}
+
+// DeleteArea creates an item deleting an area
+func DeleteArea(uuid string) AreaActionItem {
+	return AreaActionItem{
+		Item: Item{
+			UUID:   uuid,
+			Kind:   ItemKindArea,
+			Action: ItemActionDeleted,
+		},
+	}
+}
+
+// Build returns the item, ready to be written to a history
+func (b *AreaBuilder) Build() AreaActionItem {
+	return b.item
+}
+
+// WithTitle changes the title
+func (b *AreaBuilder) WithTitle(title string) *AreaBuilder {
+	b.item.P.Title = String(title)
+	return b
+}
+
+// AtIndex changes the sort order of the area
+func (b *AreaBuilder) AtIndex(index int) *AreaBuilder {
+	b.item.P.IX = intVal(index)
+	return b
+}
+
+// WithTags replaces the tags of the area
+func (b *AreaBuilder) WithTags(tags ...*Tag) *AreaBuilder {
+	b.item.P.TagIDs = tagIDs(tags)
+	return b
+}
+
+// TagBuilder creates TagActionItems
+type TagBuilder struct {
+	item TagActionItem
+}
+
+// NewTag starts building a new top level tag
+func NewTag(title string) *TagBuilder {
+	return &TagBuilder{
+		item: TagActionItem{
+			Item: Item{
+				UUID:   uuid.New().String(),
+				Kind:   ItemKindTag,
+				Action: ItemActionCreated,
+			},
+			P: TagActionItemPayload{
+				Title:        String(title),
+				ShortHand:    String(""),
+				IX:           intVal(0),
+				ParentTagIDs: ids(),
+			},
+		},
+	}
+}
+
+// EditTag starts building modifications of an existing tag
+func EditTag(uuid string) *TagBuilder {
+	return &TagBuilder{
+		item: TagActionItem{
+			Item: Item{
+				UUID:   uuid,
+				Kind:   ItemKindTag,
+				Action: ItemActionModified,
+			},
+		},
+	}
+}
+
+// DeleteTag creates an item deleting a tag
+func DeleteTag(uuid string) TagActionItem {
+	return TagActionItem{
+		Item: Item{
+			UUID:   uuid,
+			Kind:   ItemKindTag,
+			Action: ItemActionDeleted,
+		},
+	}
+}
+
+// Build returns the item, ready to be written to a history
+func (b *TagBuilder) Build() TagActionItem {
+	return b.item
+}
+
+// WithTitle changes the title
+func (b *TagBuilder) WithTitle(title string) *TagBuilder {
+	b.item.P.Title = String(title)
+	return b
+}
+
+// WithShortHand changes the keyboard shortcut
+func (b *TagBuilder) WithShortHand(shortHand string) *TagBuilder {
+	b.item.P.ShortHand = String(shortHand)
+	return b
+}
+
+// AtIndex changes the sort order of the tag
+func (b *TagBuilder) AtIndex(index int) *TagBuilder {
+	b.item.P.IX = intVal(index)
+	return b
+}
+
+// InParent nests the tag below parent. A nil parent turns it into a top level tag
+func (b *TagBuilder) InParent(parent *Tag) *TagBuilder {
+	if parent == nil {
+		b.item.P.ParentTagIDs = ids()
+		return b
+	}
+	b.item.P.ParentTagIDs = ids(parent.UUID)
+	return b
+}
@@ -0,0 +1,153 @@
+package thingscloud
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func jsonEqual(a, b []byte) bool {
+	var va, vb interface{}
+	json.Unmarshal(a, &va)
+	json.Unmarshal(b, &vb)
+	return reflect.DeepEqual(va, vb)
+}
+
+func withNow(t time.Time) func() {
+	before := now
+	now = func() time.Time { return t }
+	return func() { now = before }
+}
+
+func TestNewTask(t *testing.T) {
+	defer withNow(time.Date(2017, time.May, 24, 22, 5, 17, 0, time.UTC))()
+
+	area := &Area{UUID: "area"}
+	project := &Task{UUID: "project", Type: TaskTypeProject}
+	tag := &Tag{UUID: "tag"}
+	item := NewTask("test").
+		InArea(area).
+		InProject(project).
+		ScheduledFor(time.Date(2017, time.May, 25, 18, 0, 0, 0, time.UTC)).
+		WithTags(tag).
+		Build()
+
+	if item.UUID() == "" {
+		t.Fatal("Expected a UUID to be generated")
+	}
+	if item.Action != ItemActionCreated || item.Kind != ItemKindTask {
+		t.Fatalf("Expected a created task, but got %v %v", item.Action, item.Kind)
+	}
+
+	bs, err := json.Marshal(item)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var v struct {
+		P map[string]interface{} `json:"p"`
+	}
+	if err := json.Unmarshal(bs, &v); err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := map[string]interface{}{
+		"tt":  "test",
+		"ss":  float64(0),
+		"st":  float64(1),
+		"tp":  float64(0),
+		"cd":  float64(1495663517),
+		"md":  float64(1495663517),
+		"sr":  float64(1495670400),
+		"tir": float64(1495670400),
+	}
+	for k, val := range expected {
+		if v.P[k] != val {
+			t.Errorf("Expected %q to be %v, but got %v", k, val, v.P[k])
+		}
+	}
+	if ar := v.P["ar"].([]interface{}); len(ar) != 1 || ar[0] != "area" {
+		t.Errorf("Expected area, but got %v", v.P["ar"])
+	}
+	if pr := v.P["pr"].([]interface{}); len(pr) != 1 || pr[0] != "project" {
+		t.Errorf("Expected project, but got %v", v.P["pr"])
+	}
+	if tg := v.P["tg"].([]interface{}); len(tg) != 1 || tg[0] != "tag" {
+		t.Errorf("Expected tag, but got %v", v.P["tg"])
+	}
+}
+
+func TestNewHeading(t *testing.T) {
+	item := NewHeading("heading", &Task{UUID: "project", Type: TaskTypeProject}).Build()
+	if item.P.Type == nil || *item.P.Type != TaskTypeHeading {
+		t.Fatalf("Expected a heading, but got %v", item.P.Type)
+	}
+	if item.P.ParentTaskIDs == nil || len(*item.P.ParentTaskIDs) != 1 || (*item.P.ParentTaskIDs)[0] != "project" {
+		t.Fatalf("Expected heading to belong to the project, but got %v", item.P.ParentTaskIDs)
+	}
+	if err := item.Validate(); err != nil {
+		t.Fatalf("Expected heading to be valid, but got %v", err)
+	}
+}
+
+func TestEditTask(t *testing.T) {
+	defer withNow(time.Date(2017, time.May, 24, 22, 5, 17, 0, time.UTC))()
+
+	item := EditTask("A").Complete().Build()
+	if item.UUID() != "A" || item.Action != ItemActionModified {
+		t.Fatalf("Expected modification of %q, but got %v on %q", "A", item.Action, item.UUID())
+	}
+	bs, err := json.Marshal(item.P)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := `{"md":1495663517,"sp":1495663517,"ss":3}`
+	if !jsonEqual(bs, []byte(expected)) {
+		t.Fatalf("Expected payload %s, but got %s", expected, string(bs))
+	}
+}
+
+func TestBuilders(t *testing.T) {
+	defer withNow(time.Date(2017, time.May, 24, 22, 5, 17, 0, time.UTC))()
+
+	testCases := []struct {
+		Title    string
+		Item     interface{}
+		Expected string
+	}{
+		{"check list item", NewCheckListItem("item").InTask(&Task{UUID: "A"}).Build().P, `{"cd":1495663517,"ix":0,"md":1495663517,"ss":0,"ts":["A"],"tt":"item"}`},
+		{"edit check list item", EditCheckListItem("B").Complete().Build().P, `{"md":1495663517,"sp":1495663517,"ss":3}`},
+		{"area", NewArea("area").WithTags(&Tag{UUID: "T"}).Build().P, `{"ix":0,"tg":["T"],"tt":"area"}`},
+		{"edit area", EditArea("C").WithTitle("renamed").Build().P, `{"tt":"renamed"}`},
+		{"clear area tags", EditArea("C").WithTags().Build().P, `{"tg":[]}`},
+		{"clear task tags", EditTask("F").WithTags().Build().P, `{"md":1495663517,"tg":[]}`},
+		{"task tags", EditTask("F").WithTags(&Tag{UUID: "T"}).Build().P, `{"md":1495663517,"tg":["T"]}`},
+		{"tag", NewTag("tag").InParent(&Tag{UUID: "P"}).Build().P, `{"ix":0,"pn":["P"],"sh":"","tt":"tag"}`},
+		{"edit tag", EditTag("D").WithShortHand("t").Build().P, `{"sh":"t"}`},
+		{"delete task", DeleteTask("E").P, `{}`},
+		{"clear deadline", EditTask("F").WithoutDeadline().Reopen().Build().P, `{"md":1495663517,"dd":null,"sp":null,"ss":0}`},
+		{"move under heading", EditTask("G").UnderHeading(&Heading{UUID: "H"}).Build().P, `{"md":1495663517,"pr":[],"agr":["H"]}`},
+		{"this evening", EditTask("I").ThisEveningIn(time.UTC).Build().P, `{"md":1495663517,"st":0,"sb":1,"sr":1495584000,"tir":1495584000}`},
+		{"today", EditTask("I").TodayIn(time.UTC).Build().P, `{"md":1495663517,"st":0,"sb":0,"sr":1495584000,"tir":1495584000}`},
+		{"move out of heading", EditTask("G").InProject(&Task{UUID: "P"}).Build().P, `{"md":1495663517,"pr":["P"],"agr":[]}`},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Title, func(t *testing.T) {
+			bs, err := json.Marshal(testCase.Item)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if !jsonEqual(bs, []byte(testCase.Expected)) {
+				t.Errorf("Expected payload %s, but got %s", testCase.Expected, string(bs))
+			}
+		})
+	}
+}
+
+func TestBuilders_NotIdentifiable(t *testing.T) {
+	// builders must be built before they are written, otherwise an empty payload is committed
+	for _, b := range []interface{}{NewTask("x"), NewCheckListItem("x"), NewArea("x"), NewTag("x")} {
+		if _, ok := b.(Identifiable); ok {
+			t.Errorf("Expected %T not to be writable", b)
+		}
+	}
+}
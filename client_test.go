@@ -18,7 +18,11 @@ type fakeResponse struct {
 }
 
 func fakeServer(t fakeResponse) *httptest.Server {
-	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return httptest.NewServer(fakeHandler(t))
+}
+
+func fakeHandler(t fakeResponse) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		f, err := os.Open(fmt.Sprintf("tapes/%s", t.file))
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
@@ -36,5 +40,14 @@ func fakeServer(t fakeResponse) *httptest.Server {
 		w.WriteHeader(t.statusCode)
 		w.Header().Set("Content-Type", "application/json")
 		fmt.Fprintln(w, string(content))
-	}))
+	})
+}
+
+// fakeRouter serves a different fixture per request path
+func fakeRouter(routes map[string]fakeResponse) *httptest.Server {
+	mux := http.NewServeMux()
+	for path, response := range routes {
+		mux.Handle(path, fakeHandler(response))
+	}
+	return httptest.NewServer(mux)
 }
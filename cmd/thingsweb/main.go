@@ -14,6 +14,7 @@ import (
 
 	thingscloud "github.com/nicolai86/things-cloud-sdk"
 	_ "github.com/nicolai86/things-cloud-sdk/cmd/thingsweb/statik"
+	"github.com/nicolai86/things-cloud-sdk/state"
 	"github.com/nicolai86/things-cloud-sdk/state/memory"
 	"github.com/rakyll/statik/fs"
 )
@@ -44,20 +45,32 @@ func proxyRequest(target string) http.Handler {
 	})
 }
 
+// projectTasks returns all tasks of a project, including its headings and the tasks below them
+func projectTasks(store state.Store, project *thingscloud.Task, opts state.ListOption) []*thingscloud.Task {
+	tasks := state.Subtasks(store, project, opts)
+	for _, heading := range state.HeadingsByProject(store, project, opts) {
+		if task := store.Task(heading.UUID); task != nil {
+			tasks = append(tasks, task)
+		}
+		tasks = append(tasks, state.TasksByHeading(store, heading, opts)...)
+	}
+	return tasks
+}
+
 type projectAPI struct {
-	state   *state
+	store   state.Store
 	project *thingscloud.Task
 }
 
 func (api *projectAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	listOpts := memory.ListOption{
+	listOpts := state.ListOption{
 		ExcludeCompleted: false,
 		ExcludeInTrash:   false,
 	}
-	tasks := api.state.Subtasks(api.project, listOpts)
+	tasks := projectTasks(api.store, api.project, listOpts)
 	clis := []*thingscloud.CheckListItem{}
 	for _, task := range tasks {
-		clis = append(clis, api.state.CheckListItemsByTask(task, listOpts)...)
+		clis = append(clis, state.CheckListItemsByTask(api.store, task, listOpts)...)
 	}
 	json.NewEncoder(w).Encode(&taskResponse{
 		Title:          fmt.Sprintf("Project %q", api.project.Title),
@@ -67,7 +80,7 @@ func (api *projectAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 type areaAPI struct {
-	state *state
+	store state.Store
 	area  *thingscloud.Area
 }
 
@@ -78,20 +91,20 @@ type taskResponse struct {
 }
 
 func (api *areaAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	listOpts := memory.ListOption{
+	listOpts := state.ListOption{
 		ExcludeCompleted: false,
 		ExcludeInTrash:   false,
 	}
-	tasks := api.state.TasksByArea(api.area, listOpts)
+	tasks := state.TasksByArea(api.store, api.area, listOpts)
 	for _, task := range tasks {
-		if !task.IsProject {
+		if task.Type != thingscloud.TaskTypeProject {
 			continue
 		}
-		tasks = append(tasks, api.state.Subtasks(task, listOpts)...)
+		tasks = append(tasks, projectTasks(api.store, task, listOpts)...)
 	}
 	clis := []*thingscloud.CheckListItem{}
 	for _, task := range tasks {
-		clis = append(clis, api.state.CheckListItemsByTask(task, listOpts)...)
+		clis = append(clis, state.CheckListItemsByTask(api.store, task, listOpts)...)
 	}
 
 	json.NewEncoder(w).Encode(&taskResponse{
@@ -107,7 +120,7 @@ func main() {
 	areaName := flag.String("area", "", "things area to expose")
 	username := flag.String("username", "", "things cloud username")
 	password := flag.String("password", "", "things cloud password")
-	store := flag.String("store", "", "persisted state")
+	storeFile := flag.String("store", "", "persisted state")
 	development := flag.Bool("development", false, "development mode")
 	flag.Parse()
 
@@ -126,39 +139,34 @@ func main() {
 		log.Fatalf("Login failed: %q\nPlease check your credentials.", err.Error())
 	}
 
-	hs, err := c.Histories()
+	hs, err := c.DiscoverHistories()
 	if err != nil {
 		log.Fatalf("Failed to lookup histories: %q\n", err.Error())
 	}
-	var history *thingscloud.History
-	if historyID == nil || *historyID == "" {
-		history = hs[0]
-	} else {
-		for _, h := range hs {
-			if h.ID == *historyID {
-				history = h
-			}
-		}
+	policies := []thingscloud.HistoryPolicy{thingscloud.PreferOwnHistory, thingscloud.PreferLatestHistory}
+	if historyID != nil && *historyID != "" {
+		policies = []thingscloud.HistoryPolicy{thingscloud.PreferHistoryID(*historyID)}
+	}
+	history, err := thingscloud.SelectHistory(hs, policies...)
+	if err != nil {
+		log.Fatalf("Failed to select history: %q\n", err.Error())
 	}
 
-	s, err := load(*store)
+	s, err := load(*storeFile)
 	if err != nil {
-		s = state{
+		s = persisted{
 			History: history,
 			State:   memory.NewState(),
 		}
 	}
 	s.History.Client = c
-	fmt.Printf("using history %q since %d\n", s.History.ID, s.History.LatestServerIndex)
-	items, _, err := s.History.Items(thingscloud.ItemsOptions{StartIndex: s.History.LatestServerIndex})
-	if err != nil {
-		log.Fatalf("Failed to lookup items: %q\n", err.Error())
-	}
-	log.Printf("Updating state with %d new items\n", len(items))
-	if err := s.Update(items...); err != nil {
+	var store state.Store = s.State
+	fmt.Printf("using history %q since %d\n", s.History.ID, store.LastIndex())
+	if err := state.Sync(store, s.History); err != nil {
 		log.Printf("Failed aggregating state: %q", err.Error())
 	}
-	save(*store, s)
+	log.Printf("Updated state up to index %d\n", store.LastIndex())
+	save(*storeFile, s)
 
 	if *development {
 		log.Println("Starting in development mode w/ proxy to polymer…")
@@ -178,21 +186,21 @@ func main() {
 	}
 
 	if *projectName != "" {
-		project := s.ProjectByName(*projectName)
+		project := state.ProjectByName(store, *projectName)
 		if project == nil {
 			log.Fatalf("%q is no known project name\n", *projectName)
 		}
 
-		http.Handle("/api/", &projectAPI{&s, project})
+		http.Handle("/api/", &projectAPI{store, project})
 	}
 
 	if *areaName != "" {
-		area := s.AreaByName(*areaName)
+		area := state.AreaByName(store, *areaName)
 		if area == nil {
 			log.Fatalf("%q is no known area name\n", *areaName)
 		}
 
-		http.Handle("/api/", &areaAPI{&s, area})
+		http.Handle("/api/", &areaAPI{store, area})
 	}
 	http.ListenAndServe(":8080", nil)
 
@@ -9,27 +9,34 @@ import (
 	"github.com/nicolai86/things-cloud-sdk/state/memory"
 )
 
-type state struct {
+// persisted is the history and aggregated state stored between runs
+type persisted struct {
 	*thingscloud.History
 	*memory.State
 }
 
-func load(file string) (state, error) {
+func load(file string) (persisted, error) {
 	f, err := os.OpenFile(file, os.O_RDONLY, 0600)
 	if err != nil {
-		return state{}, err
+		return persisted{}, err
 	}
 	defer f.Close()
-	var s state
+	var s persisted
 	bs, err := ioutil.ReadAll(f)
 	if err != nil {
-		return state{}, err
+		return persisted{}, err
 	}
-	err = json.Unmarshal(bs, &s)
-	return s, err
+	if err := json.Unmarshal(bs, &s); err != nil {
+		return s, err
+	}
+	if s.State != nil && s.History != nil && s.AppliedIndex == 0 {
+		// stores written before the state recorded its index
+		s.AppliedIndex = s.History.LatestServerIndex
+	}
+	return s, nil
 }
 
-func save(file string, s state) error {
+func save(file string, s persisted) error {
 	f, err := os.OpenFile(file, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0600)
 	if err != nil {
 		return err
@@ -0,0 +1,125 @@
+package thingscloud
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Day is a calendar day without time of day or time zone, as used for start dates and deadlines.
+// Things stores days as unix epochs of midnight UTC, no matter where the user lives,
+// so converting from and to time.Time requires the time zone of the user.
+// The zero value is January 1, year 1.
+type Day struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// NewDay returns the given day. Values outside their usual ranges are normalized, e.g. March 0 becomes February 28
+func NewDay(year int, month time.Month, day int) Day {
+	return DayOf(time.Date(year, month, day, 0, 0, 0, 0, time.UTC))
+}
+
+// DayOf returns the calendar day of t in the location of t
+func DayOf(t time.Time) Day {
+	y, m, d := t.Date()
+	return Day{Year: y, Month: m, Day: d}
+}
+
+// DayIn returns the calendar day of t in loc, e.g. the time zone of the user
+func DayIn(t time.Time, loc *time.Location) Day {
+	return DayOf(t.In(loc))
+}
+
+// TodayIn returns the current day in loc
+func TodayIn(loc *time.Location) Day {
+	return DayIn(now(), loc)
+}
+
+// ParseDay parses days formatted as 2006-01-02
+func ParseDay(s string) (Day, error) {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return Day{}, fmt.Errorf("invalid day %q: %w", s, err)
+	}
+	return DayOf(t), nil
+}
+
+// In returns the start of the day in loc. On days DST starts at midnight, e.g. in São Paulo,
+// the day starts at the first existing time instead
+func (d Day) In(loc *time.Location) time.Time {
+	t := time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+	for DayOf(t).Before(d) {
+		t = t.Add(time.Hour)
+	}
+	return t
+}
+
+// Time returns midnight UTC of the day, which is how things stores days
+func (d Day) Time() time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, time.UTC)
+}
+
+// AddDays returns the day n days after d. n may be negative
+func (d Day) AddDays(n int) Day {
+	return NewDay(d.Year, d.Month, d.Day+n)
+}
+
+// AddDate returns the day years, months and days after d, normalized like time.Time.AddDate,
+// e.g. adding a month to October 31 yields December 1
+func (d Day) AddDate(years, months, days int) Day {
+	return NewDay(d.Year+years, d.Month+time.Month(months), d.Day+days)
+}
+
+// Weekday returns the day of the week
+func (d Day) Weekday() time.Weekday {
+	return d.Time().Weekday()
+}
+
+// Before reports whether d is before o
+func (d Day) Before(o Day) bool {
+	return d.Time().Before(o.Time())
+}
+
+// After reports whether d is after o
+func (d Day) After(o Day) bool {
+	return d.Time().After(o.Time())
+}
+
+// IsZero reports whether d is the zero value
+func (d Day) IsZero() bool {
+	return d == Day{}
+}
+
+// String returns the day formatted as 2006-01-02
+func (d Day) String() string {
+	return d.Time().Format("2006-01-02")
+}
+
+// UnmarshalJSON decodes a unix epoch into the UTC day it falls on.
+// Formatted times, as persisted by earlier versions of this SDK, are accepted as well.
+// null leaves the day unchanged, as is the convention of encoding/json
+func (d *Day) UnmarshalJSON(bs []byte) error {
+	if string(bytes.TrimSpace(bs)) == "null" {
+		return nil
+	}
+	var f float64
+	if err := json.Unmarshal(bs, &f); err != nil {
+		var t time.Time
+		if err := json.Unmarshal(bs, &t); err != nil {
+			return err
+		}
+		*d = DayOf(t.UTC())
+		return nil
+	}
+	*d = DayOf(time.Unix(int64(math.Floor(f)), 0).UTC())
+	return nil
+}
+
+// MarshalJSON encodes the day as unix epoch of midnight UTC
+func (d Day) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Time().Unix())
+}
@@ -0,0 +1,144 @@
+package thingscloud
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return loc
+}
+
+func TestDay_UnmarshalJSON(t *testing.T) {
+	testCases := []struct {
+		JSON     string
+		Expected Day
+	}{
+		{"1495843200", NewDay(2017, time.May, 27)},
+		{"1495843200.0", NewDay(2017, time.May, 27)},
+		{"1495929599.9", NewDay(2017, time.May, 27)},
+		{`"2017-05-27T00:00:00Z"`, NewDay(2017, time.May, 27)},
+	}
+	for _, testCase := range testCases {
+		var d Day
+		if err := json.Unmarshal([]byte(testCase.JSON), &d); err != nil {
+			t.Fatal(err.Error())
+		}
+		if d != testCase.Expected {
+			t.Fatalf("Expected %s but got %s", testCase.Expected, d)
+		}
+	}
+}
+
+func TestDay_UnmarshalJSON_Null(t *testing.T) {
+	d := NewDay(2017, time.May, 27)
+	if err := json.Unmarshal([]byte("null"), &d); err != nil {
+		t.Fatal(err.Error())
+	}
+	if d != NewDay(2017, time.May, 27) {
+		t.Fatalf("Expected null to keep the day, but got %s", d)
+	}
+
+	var v struct {
+		Day *Day `json:"d"`
+	}
+	if err := json.Unmarshal([]byte(`{"d":null}`), &v); err != nil {
+		t.Fatal(err.Error())
+	}
+	if v.Day != nil {
+		t.Fatalf("Expected null to decode to nil, but got %s", v.Day)
+	}
+}
+
+func TestDay_MarshalJSON(t *testing.T) {
+	bs, err := json.Marshal(NewDay(2017, time.May, 27))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(bs) != "1495843200" {
+		t.Fatalf("Expected midnight UTC but got %s", bs)
+	}
+}
+
+func TestDayIn(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	losAngeles := mustLoadLocation(t, "America/Los_Angeles")
+
+	testCases := []struct {
+		Name     string
+		Time     time.Time
+		Location *time.Location
+		Expected Day
+	}{
+		{"Berlin shortly after midnight", time.Date(2017, time.May, 27, 22, 30, 0, 0, time.UTC), berlin, NewDay(2017, time.May, 28)},
+		{"Los Angeles in the evening", time.Date(2017, time.May, 28, 5, 0, 0, 0, time.UTC), losAngeles, NewDay(2017, time.May, 27)},
+		{"UTC", time.Date(2017, time.May, 28, 5, 0, 0, 0, time.UTC), time.UTC, NewDay(2017, time.May, 28)},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			d := DayIn(testCase.Time, testCase.Location)
+			if d != testCase.Expected {
+				t.Fatalf("Expected %s but got %s", testCase.Expected, d)
+			}
+		})
+	}
+}
+
+func TestDay_In(t *testing.T) {
+	losAngeles := mustLoadLocation(t, "America/Los_Angeles")
+
+	// a start date read from things must stay on the same day for users west of UTC
+	var d Day
+	if err := json.Unmarshal([]byte("1495843200"), &d); err != nil {
+		t.Fatal(err.Error())
+	}
+	start := d.In(losAngeles)
+	if start.Day() != 27 || start.Hour() != 0 {
+		t.Fatalf("Expected start of May 27 in Los Angeles but got %s", start)
+	}
+	if DayOf(start) != d {
+		t.Fatalf("Expected %s to round trip but got %s", d, DayOf(start))
+	}
+}
+
+func TestDay_AddDays(t *testing.T) {
+	d := NewDay(2017, time.February, 27).AddDays(2)
+	if d != NewDay(2017, time.March, 1) {
+		t.Fatalf("Expected March 1st but got %s", d)
+	}
+	if !d.After(NewDay(2017, time.February, 28)) || d.Before(NewDay(2017, time.February, 28)) {
+		t.Fatalf("Expected %s to be after February 28th", d)
+	}
+}
+
+func TestParseDay(t *testing.T) {
+	d, err := ParseDay("2017-05-27")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if d != NewDay(2017, time.May, 27) {
+		t.Fatalf("Expected May 27 but got %s", d)
+	}
+	if _, err := ParseDay("27.05.2017"); err == nil {
+		t.Fatal("Expected invalid day to fail")
+	}
+}
+
+func TestTaskBuilder_TodayIn(t *testing.T) {
+	defer withNow(time.Date(2017, time.May, 28, 5, 0, 0, 0, time.UTC))()
+
+	item := NewTask("a").TodayIn(mustLoadLocation(t, "America/Los_Angeles")).Build()
+	if d, _ := item.P.ScheduledDate.Get(); d != NewDay(2017, time.May, 27) {
+		t.Fatalf("Expected task to be scheduled for May 27 but got %s", d)
+	}
+	item = NewTask("a").TodayIn(mustLoadLocation(t, "Europe/Berlin")).Build()
+	if d, _ := item.P.ScheduledDate.Get(); d != NewDay(2017, time.May, 28) {
+		t.Fatalf("Expected task to be scheduled for May 28 but got %s", d)
+	}
+}
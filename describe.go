@@ -0,0 +1,215 @@
+package thingscloud
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Locale selects the language of descriptions
+type Locale string
+
+const (
+	// LocaleEnglish describes rules in english
+	LocaleEnglish Locale = "en"
+	// LocaleGerman describes rules in german
+	LocaleGerman Locale = "de"
+)
+
+// describeTemplate contains the words and sentence structure of a locale
+type describeTemplate struct {
+	and      string
+	weekdays [7]string
+	months   [12]string
+	ordinal  func(n int64) string
+	last     string
+	lastDay  string
+	// every contains the singular and plural frequency of each unit
+	every map[FrequencyUnit][2]string
+	// sentences formats the frequency and the details of each unit
+	sentences map[FrequencyUnit]string
+	// dayOfYear formats days of yearly rules, e.g. "March 3rd", ofMonth the last day and weekdays,
+	// e.g. "last Wednesday of February"
+	dayOfYear       string
+	ofMonth         string
+	afterCompletion string
+	count           func(n int64) string
+	until           string
+	// invalid describes rules failing validation
+	invalid string
+}
+
+var describeTemplates = map[Locale]describeTemplate{
+	LocaleEnglish: {
+		and:      "and",
+		weekdays: [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		months:   [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		ordinal:  englishOrdinal,
+		last:     "last",
+		lastDay:  "last day",
+		every: map[FrequencyUnit][2]string{
+			FrequencyUnitDaily:   {"every day", "every %d days"},
+			FrequencyUnitWeekly:  {"every week", "every %d weeks"},
+			FrequencyUnitMonthly: {"every month", "every %d months"},
+			FrequencyUnitYearly:  {"every year", "every %d years"},
+		},
+		sentences: map[FrequencyUnit]string{
+			FrequencyUnitWeekly:  "%[1]s on %[2]s",
+			FrequencyUnitMonthly: "%[1]s on the %[2]s",
+			FrequencyUnitYearly:  "%[2]s %[1]s",
+		},
+		dayOfYear:       "%[2]s %[1]s",
+		ofMonth:         "%s of %s",
+		afterCompletion: "%s after completion",
+		count: func(n int64) string {
+			if n == 1 {
+				return ", once"
+			}
+			return fmt.Sprintf(", %d times", n)
+		},
+		until:   ", until %s",
+		invalid: "invalid repeat rule",
+	},
+	LocaleGerman: {
+		and:      "und",
+		weekdays: [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		months:   [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		ordinal: func(n int64) string {
+			return fmt.Sprintf("%d.", n)
+		},
+		last:    "letzten",
+		lastDay: "letzten Tag",
+		every: map[FrequencyUnit][2]string{
+			FrequencyUnitDaily:   {"jeden Tag", "alle %d Tage"},
+			FrequencyUnitWeekly:  {"jede Woche", "alle %d Wochen"},
+			FrequencyUnitMonthly: {"jeden Monat", "alle %d Monate"},
+			FrequencyUnitYearly:  {"jedes Jahr", "alle %d Jahre"},
+		},
+		sentences: map[FrequencyUnit]string{
+			FrequencyUnitWeekly:  "%[1]s am %[2]s",
+			FrequencyUnitMonthly: "%[1]s am %[2]s",
+			FrequencyUnitYearly:  "%[1]s am %[2]s",
+		},
+		dayOfYear:       "%[1]s %[2]s",
+		ofMonth:         "%s im %s",
+		afterCompletion: "%s nach Erledigung",
+		count: func(n int64) string {
+			if n == 1 {
+				return ", einmal"
+			}
+			return fmt.Sprintf(", %d Mal", n)
+		},
+		until:   ", bis %s",
+		invalid: "ungültige Wiederholung",
+	},
+}
+
+func englishOrdinal(n int64) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
+// join lists words, e.g. "Monday, Tuesday and Friday"
+func (t describeTemplate) join(words []string) string {
+	if len(words) < 2 {
+		return strings.Join(words, "")
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " " + t.and + " " + words[len(words)-1]
+}
+
+// dayOfMonth describes a day or weekday within a month, e.g. "3rd", "last day" or "2nd Monday"
+func (t describeTemplate) dayOfMonth(dc RepeaterDetailConfiguration) (string, bool) {
+	if dc.Weekday != nil && dc.MonthOf != nil {
+		if *dc.MonthOf == -1 {
+			return t.last + " " + t.weekdays[*dc.Weekday], true
+		}
+		return t.ordinal(*dc.MonthOf) + " " + t.weekdays[*dc.Weekday], true
+	}
+	if dc.Day == nil {
+		return "", false
+	}
+	if *dc.Day == -1 {
+		return t.lastDay, true
+	}
+	return t.ordinal(*dc.Day + 1), true
+}
+
+// details describes the days of the rule. The rule must pass validatePattern
+func (t describeTemplate) details(c RepeaterConfiguration) []string {
+	details := []string{}
+	for _, dc := range c.DetailConfiguration {
+		switch c.FrequencyUnit {
+		case FrequencyUnitWeekly:
+			if dc.Weekday != nil {
+				details = append(details, t.weekdays[*dc.Weekday])
+			}
+		case FrequencyUnitMonthly:
+			if d, ok := t.dayOfMonth(dc); ok {
+				details = append(details, d)
+			}
+		case FrequencyUnitYearly:
+			d, ok := t.dayOfMonth(dc)
+			if !ok || dc.Month == nil {
+				continue
+			}
+			month := t.months[*dc.Month]
+			if dc.Day != nil && *dc.Day >= 0 && dc.MonthOf == nil {
+				details = append(details, fmt.Sprintf(t.dayOfYear, d, month))
+			} else {
+				details = append(details, fmt.Sprintf(t.ofMonth, d, month))
+			}
+		}
+	}
+	return details
+}
+
+// Describe returns a human readable description of the rule, e.g. "Every 2 weeks on Monday and Tuesday, 5 times".
+// Unknown locales are described in english. Malformed rules, which fail Validate for other reasons
+// than a missing FirstScheduledAt, are described as invalid
+func (c RepeaterConfiguration) Describe(locale Locale) string {
+	t, ok := describeTemplates[locale]
+	if !ok {
+		t = describeTemplates[LocaleEnglish]
+	}
+	if err := c.validatePattern(); err != nil {
+		return capitalize(t.invalid)
+	}
+	every := t.every[c.FrequencyUnit]
+	frequency := every[0]
+	if c.FrequencyAmplitude > 1 {
+		frequency = fmt.Sprintf(every[1], c.FrequencyAmplitude)
+	}
+
+	var description string
+	if c.IsAfterCompletion() {
+		description = fmt.Sprintf(t.afterCompletion, frequency)
+	} else if details := t.details(c); c.FrequencyUnit == FrequencyUnitDaily || len(details) == 0 {
+		description = frequency
+	} else {
+		description = fmt.Sprintf(t.sentences[c.FrequencyUnit], frequency, t.join(details))
+	}
+
+	if c.RepeatCount != nil && *c.RepeatCount > 0 {
+		description += t.count(*c.RepeatCount)
+	} else if c.LastScheduledAt != nil && !c.IsNeverending() {
+		description += fmt.Sprintf(t.until, DayOf(c.LastScheduledAt.Time().UTC()))
+	}
+
+	return capitalize(description)
+}
+
+// capitalize turns the first letter of s into upper case
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
@@ -0,0 +1,104 @@
+package thingscloud
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRepeaterConfiguration_Describe(t *testing.T) {
+	testCases := []struct {
+		Data    []byte
+		English string
+		German  string
+	}{
+		{rcEveryDay, "Every day", "Jeden Tag"},
+		{rcEvery2ndDay, "Every 2 days", "Alle 2 Tage"},
+		{rcEveryDayEndDate, "Every day, until 2018-03-01", "Jeden Tag, bis 2018-03-01"},
+		{rcEveryDayEndRepeat, "Every day, 2 times", "Jeden Tag, 2 Mal"},
+		{rcEveryWeekOnMonday, "Every week on Monday", "Jede Woche am Montag"},
+		{rcEveryWeekOnMondayEndDate, "Every week on Monday, until 2018-03-18", "Jede Woche am Montag, bis 2018-03-18"},
+		{rcEveryWeekOnMondayAndTuesday, "Every week on Monday and Tuesday", "Jede Woche am Montag und Dienstag"},
+		{rcEvery2ndWeekOnMondayAndTuesday, "Every 2 weeks on Monday and Tuesday", "Alle 2 Wochen am Montag und Dienstag"},
+		{rc1stDayEveryMonthEndRepeat, "Every month on the 1st, 2 times", "Jeden Monat am 1., 2 Mal"},
+		{rc1stDayAnd3rdDayEveryMonth, "Every month on the 1st and 3rd", "Jeden Monat am 1. und 3."},
+		{rc1stDayAnd2ndMondayEveryMonth, "Every month on the 1st and 2nd Monday", "Jeden Monat am 1. und 2. Montag"},
+		{rc1stDayEvery2ndMonth, "Every 2 months on the 1st", "Alle 2 Monate am 1."},
+		{rc1stAndLastDayEveryMonth, "Every month on the 1st and last day", "Jeden Monat am 1. und letzten Tag"},
+		{rcLastMondayEvery2ndMonth, "Every 2 months on the last Monday", "Alle 2 Monate am letzten Montag"},
+		{rc1stDayJanuaryEveryYear, "January 1st every year", "Jedes Jahr am 1. Januar"},
+		{rcLastDayJanuaryEveryYearEndDate, "Last day of January every year, until 2019-02-27", "Jedes Jahr am letzten Tag im Januar, bis 2019-02-27"},
+		{rc1stJanuaryAnd1stMarchEveryYear, "January 1st and March 1st every year", "Jedes Jahr am 1. Januar und 1. März"},
+		{rc1stJanuaryAndLastWednesdayFebuaryEveryYear, "January 1st and last Wednesday of February every year", "Jedes Jahr am 1. Januar und letzten Mittwoch im Februar"},
+		{rcLastWednesdayFebuaryEveryYear, "Last Wednesday of February every year", "Jedes Jahr am letzten Mittwoch im Februar"},
+		{rcEvery3DaysAfterCompletion, "Every 3 days after completion", "Alle 3 Tage nach Erledigung"},
+		{rcEveryYearAfterCompletionEndRepeat, "Every year after completion, 2 times", "Jedes Jahr nach Erledigung, 2 Mal"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.English, func(t *testing.T) {
+			var rc RepeaterConfiguration
+			if err := json.Unmarshal(testCase.Data, &rc); err != nil {
+				t.Fatalf("Failed to deserialize repeater configuration: %v", err)
+			}
+			if d := rc.Describe(LocaleEnglish); d != testCase.English {
+				t.Errorf("Expected %q, but got %q", testCase.English, d)
+			}
+			if d := rc.Describe(LocaleGerman); d != testCase.German {
+				t.Errorf("Expected %q, but got %q", testCase.German, d)
+			}
+			if d := rc.Describe("fr"); d != testCase.English {
+				t.Errorf("Expected unknown locales to fall back to english, but got %q", d)
+			}
+		})
+	}
+}
+
+func TestRepeaterConfiguration_DescribeCount(t *testing.T) {
+	var rc RepeaterConfiguration
+	if err := json.Unmarshal(rcEveryDayEndRepeat, &rc); err != nil {
+		t.Fatal(err.Error())
+	}
+	once := int64(1)
+	rc.RepeatCount = &once
+	if d := rc.Describe(LocaleEnglish); d != "Every day, once" {
+		t.Errorf("Expected %q, but got %q", "Every day, once", d)
+	}
+	if d := rc.Describe(LocaleGerman); d != "Jeden Tag, einmal" {
+		t.Errorf("Expected %q, but got %q", "Jeden Tag, einmal", d)
+	}
+}
+
+func TestRepeaterConfiguration_DescribeMalformed(t *testing.T) {
+	testCases := []struct {
+		Title string
+		JSON  string
+	}{
+		{"unknown weekday", `{"tp":0,"of":[{"wd":9}],"fu":256,"fa":1}`},
+		{"unknown month", `{"tp":0,"of":[{"dy":0,"mo":12}],"fu":4,"fa":1}`},
+		{"negative month", `{"tp":0,"of":[{"dy":0,"mo":-2}],"fu":4,"fa":1}`},
+		{"unknown weekday of month", `{"tp":0,"of":[{"wd":-1,"wdo":1}],"fu":8,"fa":1}`},
+		{"unknown frequency unit", `{"tp":0,"of":[{"dy":0}],"fu":3,"fa":1}`},
+		{"zero amplitude", `{"tp":0,"of":[{"dy":0}],"fu":16,"fa":0}`},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Title, func(t *testing.T) {
+			var rc RepeaterConfiguration
+			if err := json.Unmarshal([]byte(testCase.JSON), &rc); err != nil {
+				t.Fatal(err.Error())
+			}
+			if d := rc.Describe(LocaleEnglish); d != "Invalid repeat rule" {
+				t.Errorf("Expected %q, but got %q", "Invalid repeat rule", d)
+			}
+			if d := rc.Describe(LocaleGerman); d != "Ungültige Wiederholung" {
+				t.Errorf("Expected %q, but got %q", "Ungültige Wiederholung", d)
+			}
+		})
+	}
+}
+
+func Test_englishOrdinal(t *testing.T) {
+	for n, expected := range map[int64]string{1: "1st", 2: "2nd", 3: "3rd", 4: "4th", 11: "11th", 12: "12th", 13: "13th", 21: "21st", 22: "22nd", 31: "31st"} {
+		if got := englishOrdinal(n); got != expected {
+			t.Errorf("Expected %q, but got %q", expected, got)
+		}
+	}
+}
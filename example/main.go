@@ -6,33 +6,35 @@ import (
 	"os"
 	"time"
 
-	"github.com/google/uuid"
 	thingscloud "github.com/nicolai86/things-cloud-sdk"
+	"github.com/nicolai86/things-cloud-sdk/state"
 	memory "github.com/nicolai86/things-cloud-sdk/state/memory"
 )
 
-func printTag(tag *thingscloud.Tag, state *memory.State, indent string) {
+func printTag(tag *thingscloud.Tag, store state.Store, indent string) {
 	fmt.Printf("%s-\t%s\n", indent, tag.Title)
-	children := state.SubTags(tag)
+	children := state.SubTags(store, tag)
 	for _, child := range children {
-		printTag(child, state, fmt.Sprintf("%s\t", indent))
+		printTag(child, store, fmt.Sprintf("%s\t", indent))
 	}
 }
 
-func printTask(task *thingscloud.Task, state *memory.State, indent string) {
+func printTask(task *thingscloud.Task, store state.Store, indent string) {
 	fmt.Printf("%s-\t%s\n", indent, task.Title)
-	checklist := state.CheckListItemsByTask(task, memory.ListOption{})
+	checklist := state.CheckListItemsByTask(store, task, state.ListOption{})
 	for _, item := range checklist {
 		fmt.Printf("%s+%s\n", indent, item.Title)
 	}
-	children := state.Subtasks(task, memory.ListOption{})
+	children := state.Subtasks(store, task, state.ListOption{})
 	for _, child := range children {
-		printTask(child, state, fmt.Sprintf("%s\t", indent))
+		printTask(child, store, fmt.Sprintf("%s\t", indent))
+	}
+	for _, heading := range state.HeadingsByProject(store, task, state.ListOption{}) {
+		fmt.Printf("%s\t#\t%s\n", indent, heading.Title)
+		for _, child := range state.TasksByHeading(store, heading, state.ListOption{}) {
+			printTask(child, store, fmt.Sprintf("%s\t\t", indent))
+		}
 	}
-}
-
-func stringVal(s string) *string {
-	return &s
 }
 
 func main() {
@@ -91,68 +93,34 @@ func main() {
 		log.Fatalf("unable to sync history: %v", err)
 	}
 
-	state := memory.NewState()
-
-	pending := thingscloud.TaskStatusPending
-	anytime := thingscloud.TaskScheduleAnytime
-	no := thingscloud.Boolean(false)
-	taskUUID := uuid.New().String()
-	now := thingscloud.Timestamp(time.Now())
-	date := thingscloud.Timestamp(time.Now().Truncate(24 * time.Hour))
-	todayIdx := 0
-	idx := -4000
-	log.Printf("Creating task %s\n", taskUUID)
-	if err := history.Write(thingscloud.TaskActionItem{
-		Item: thingscloud.Item{
-			Kind:   thingscloud.ItemKindTask,
-			Action: thingscloud.ItemActionCreated,
-			UUID:   taskUUID,
-		},
-		P: thingscloud.TaskActionItemPayload{
-			Title:            stringVal("test project"),
-			Schedule:         &anytime,
-			Status:           &pending,
-			CreationDate:     &now,
-			ModificationDate: &now,
-			ScheduledDate:    &date,
-			TaskIR:           &date,
-			Index:            &idx,
-			TaskIndex:        &todayIdx,
-			IsProject:        &no,
-		},
-	}); err != nil {
+	var store state.Store = memory.NewState()
+
+	task := thingscloud.NewTask("test project").ScheduledFor(time.Now()).AtIndex(-4000).Build()
+	log.Printf("Creating task %s\n", task.UUID())
+	if err := history.Write(task); err != nil {
 		log.Fatalf("Task creation failed failed: %q\n", err.Error())
 	}
 
-	log.Printf("Deleting task %s\n", taskUUID)
-	if err := history.Write(thingscloud.TaskActionItem{
-		Item: thingscloud.Item{
-			Kind:   thingscloud.ItemKindTask,
-			Action: thingscloud.ItemActionDeleted,
-			UUID:   taskUUID,
-		},
-		P: thingscloud.TaskActionItemPayload{},
-	}); err != nil {
+	log.Printf("Deleting task %s\n", task.UUID())
+	if err := history.Write(thingscloud.DeleteTask(task.UUID())); err != nil {
 		log.Fatalf("Task deletion failed failed: %q\n", err.Error())
 	}
 
-	items, _, err := history.Items(thingscloud.ItemsOptions{StartIndex: 0})
-	if err != nil {
-		log.Fatalf("Failed to lookup items: %q\n", err.Error())
-	}
-	if err := state.Update(items...); err != nil {
+	if err := state.Sync(store, history); err != nil {
 		log.Fatalf("Failed to update state: %q\n", err.Error())
 	}
 
+	tasks := store.AllTasks(state.ListOption{})
 	doneTasks := 0
-	for _, task := range state.Tasks {
+	for _, task := range tasks {
 		if task.Status == thingscloud.TaskStatusCompleted {
 			doneTasks = doneTasks + 1
 		}
 	}
 
+	checklistItems := store.AllCheckListItems(state.ListOption{})
 	doneChecklistItems := 0
-	for _, item := range state.CheckListItems {
+	for _, item := range checklistItems {
 		if item.Status == thingscloud.TaskStatusCompleted {
 			doneChecklistItems = doneChecklistItems + 1
 		}
@@ -162,42 +130,42 @@ Areas:          %d
 Tasks:          %d (%d)
 CheckListItems: %d (%d)
 Tags:           %d
-`, len(state.Areas),
-		len(state.Tasks), doneTasks,
-		len(state.CheckListItems), doneChecklistItems,
-		len(state.Tags))
+`, len(store.AllAreas()),
+		len(tasks), doneTasks,
+		len(checklistItems), doneChecklistItems,
+		len(store.AllTags()))
 
 	fmt.Printf("Tags\n")
-	for _, tag := range state.Tags {
+	for _, tag := range store.AllTags() {
 		if len(tag.ParentTagIDs) != 0 {
 			continue
 		}
-		printTag(tag, state, "")
+		printTag(tag, store, "")
 	}
 	fmt.Printf("\n\n")
 
 	fmt.Printf("Areas\n")
-	for _, area := range state.Areas {
+	for _, area := range store.AllAreas() {
 		fmt.Printf("-\t%s\n", area.Title)
 
-		for _, task := range state.TasksByArea(area, memory.ListOption{}) {
-			printTask(task, state, "|")
+		for _, task := range state.TasksByArea(store, area, state.ListOption{}) {
+			printTask(task, store, "|")
 		}
 	}
 
 	fmt.Printf("No Areas\n")
-	for _, task := range state.TasksWithoutArea() {
-		printTask(task, state, "|")
+	for _, task := range state.TasksWithoutArea(store) {
+		printTask(task, store, "|")
 	}
 
 	fmt.Printf("Today\n")
-	for _, task := range state.Tasks {
+	for _, task := range tasks {
 		if task.Schedule != thingscloud.TaskScheduleToday {
 			continue
 		}
 		if task.Status != thingscloud.TaskStatusPending {
 			continue
 		}
-		printTask(task, state, "--")
+		printTask(task, store, "--")
 	}
 }
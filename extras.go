@@ -0,0 +1,211 @@
+package thingscloud
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Extras holds payload fields which are not modelled by this SDK. They are kept
+// so that writing a payload back does not erase data created by newer things versions.
+type Extras map[string]json.RawMessage
+
+// Merge returns a copy of e, updated with all fields of other
+func (e Extras) Merge(other Extras) Extras {
+	if len(e) == 0 && len(other) == 0 {
+		return nil
+	}
+	merged := Extras{}
+	for k, v := range e {
+		merged[k] = v
+	}
+	for k, v := range other {
+		merged[k] = v
+	}
+	return merged
+}
+
+var knownFieldsCache sync.Map
+
+// knownFields returns the json keys of all fields of the struct type t
+func knownFields(t reflect.Type) map[string]bool {
+	if fields, ok := knownFieldsCache.Load(t); ok {
+		return fields.(map[string]bool)
+	}
+	fields := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = true
+	}
+	knownFieldsCache.Store(t, fields)
+	return fields
+}
+
+// unknownFields returns all fields of the json object bs which are not known to v
+func unknownFields(bs []byte, v interface{}) (Extras, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(bs, &m); err != nil {
+		return nil, err
+	}
+	known := knownFields(reflect.TypeOf(v))
+	var extras Extras
+	for k, raw := range m {
+		if known[k] {
+			continue
+		}
+		if extras == nil {
+			extras = Extras{}
+		}
+		extras[k] = raw
+	}
+	return extras, nil
+}
+
+// unmarshalWithExtras decodes the json object bs into v and stores all fields unknown to v in extras.
+// T must not implement json.Unmarshaler, so callers pass a locally defined copy of their type
+func unmarshalWithExtras[T any](bs []byte, v *T, extras *Extras) error {
+	var decoded T
+	if err := json.Unmarshal(bs, &decoded); err != nil {
+		return err
+	}
+	unknown, err := unknownFields(bs, decoded)
+	if err != nil {
+		return err
+	}
+	*v = decoded
+	*extras = unknown
+	return nil
+}
+
+// marshalWithExtras encodes v, omitting unset optional fields and adding all extras
+// without overwriting known fields. T must not implement json.Marshaler
+func marshalWithExtras[T any](v T, extras Extras) ([]byte, error) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	unset := unsetFields(v)
+	if len(extras) == 0 && len(unset) == 0 {
+		return bs, nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(bs, &m); err != nil {
+		return nil, err
+	}
+	for _, k := range unset {
+		delete(m, k)
+	}
+	for k, v := range extras {
+		if _, ok := m[k]; !ok {
+			m[k] = v
+		}
+	}
+	return json.Marshal(m)
+}
+
+// unsetFields returns the json keys of all unset optional fields of the struct v
+func unsetFields(v interface{}) []string {
+	rv := reflect.ValueOf(v)
+	rt := rv.Type()
+	keys := []string{}
+	for i := 0; i < rt.NumField(); i++ {
+		o, ok := rv.Field(i).Interface().(unsettable)
+		if !ok || !o.isUnset() {
+			continue
+		}
+		keys = append(keys, strings.Split(rt.Field(i).Tag.Get("json"), ",")[0])
+	}
+	return keys
+}
+
+// UnmarshalJSON decodes the payload and keeps unknown fields
+func (p *TaskActionItemPayload) UnmarshalJSON(bs []byte) error {
+	type payload TaskActionItemPayload
+	return unmarshalWithExtras(bs, (*payload)(p), &p.Extras)
+}
+
+// MarshalJSON encodes the payload including unknown fields
+func (p TaskActionItemPayload) MarshalJSON() ([]byte, error) {
+	type payload TaskActionItemPayload
+	return marshalWithExtras(payload(p), p.Extras)
+}
+
+// UnmarshalJSON decodes the payload and keeps unknown fields
+func (p *TagActionItemPayload) UnmarshalJSON(bs []byte) error {
+	type payload TagActionItemPayload
+	return unmarshalWithExtras(bs, (*payload)(p), &p.Extras)
+}
+
+// MarshalJSON encodes the payload including unknown fields
+func (p TagActionItemPayload) MarshalJSON() ([]byte, error) {
+	type payload TagActionItemPayload
+	return marshalWithExtras(payload(p), p.Extras)
+}
+
+// UnmarshalJSON decodes the payload and keeps unknown fields
+func (p *AreaActionItemPayload) UnmarshalJSON(bs []byte) error {
+	type payload AreaActionItemPayload
+	return unmarshalWithExtras(bs, (*payload)(p), &p.Extras)
+}
+
+// MarshalJSON encodes the payload including unknown fields
+func (p AreaActionItemPayload) MarshalJSON() ([]byte, error) {
+	type payload AreaActionItemPayload
+	return marshalWithExtras(payload(p), p.Extras)
+}
+
+// UnmarshalJSON decodes the payload and keeps unknown fields
+func (p *CheckListActionItemPayload) UnmarshalJSON(bs []byte) error {
+	type payload CheckListActionItemPayload
+	return unmarshalWithExtras(bs, (*payload)(p), &p.Extras)
+}
+
+// MarshalJSON encodes the payload including unknown fields
+func (p CheckListActionItemPayload) MarshalJSON() ([]byte, error) {
+	type payload CheckListActionItemPayload
+	return marshalWithExtras(payload(p), p.Extras)
+}
+
+// UnmarshalJSON decodes the payload and keeps unknown fields
+func (p *SettingsActionItemPayload) UnmarshalJSON(bs []byte) error {
+	type payload SettingsActionItemPayload
+	return unmarshalWithExtras(bs, (*payload)(p), &p.Extras)
+}
+
+// MarshalJSON encodes the payload including unknown fields
+func (p SettingsActionItemPayload) MarshalJSON() ([]byte, error) {
+	type payload SettingsActionItemPayload
+	return marshalWithExtras(payload(p), p.Extras)
+}
+
+// UnmarshalJSON decodes the configuration and keeps unknown fields
+func (c *RepeaterConfiguration) UnmarshalJSON(bs []byte) error {
+	type configuration RepeaterConfiguration
+	return unmarshalWithExtras(bs, (*configuration)(c), &c.Extras)
+}
+
+// MarshalJSON encodes the configuration including unknown fields
+func (c RepeaterConfiguration) MarshalJSON() ([]byte, error) {
+	type configuration RepeaterConfiguration
+	return marshalWithExtras(configuration(c), c.Extras)
+}
+
+// UnmarshalJSON decodes the configuration and keeps unknown fields
+func (c *RepeaterDetailConfiguration) UnmarshalJSON(bs []byte) error {
+	type configuration RepeaterDetailConfiguration
+	return unmarshalWithExtras(bs, (*configuration)(c), &c.Extras)
+}
+
+// MarshalJSON encodes the configuration including unknown fields
+func (c RepeaterDetailConfiguration) MarshalJSON() ([]byte, error) {
+	type configuration RepeaterDetailConfiguration
+	return marshalWithExtras(configuration(c), c.Extras)
+}
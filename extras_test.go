@@ -0,0 +1,115 @@
+package thingscloud
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestExtras_RoundTrip(t *testing.T) {
+	testCases := []struct {
+		Title string
+		JSON  string
+		Value interface{}
+	}{
+		{"task", `{"tt":"test","xx":{"nested":[1,2]},"yy":null}`, &TaskActionItemPayload{}},
+		{"tag", `{"ix":1,"tt":"tag","sh":"","pn":[],"xx":true}`, &TagActionItemPayload{}},
+		{"area", `{"tt":"area","xx":"value"}`, &AreaActionItemPayload{}},
+		{"check list item", `{"tt":"item","ix":0,"xx":1}`, &CheckListActionItemPayload{}},
+		{"settings", `{"li":1,"xx":1}`, &SettingsActionItemPayload{}},
+		{"repeater", string(rcEveryDay), &RepeaterConfiguration{}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Title, func(t *testing.T) {
+			if err := json.Unmarshal([]byte(testCase.JSON), testCase.Value); err != nil {
+				t.Fatal(err.Error())
+			}
+			bs, err := json.Marshal(testCase.Value)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			var expected, actual map[string]interface{}
+			json.Unmarshal([]byte(testCase.JSON), &expected)
+			json.Unmarshal(bs, &actual)
+			for k, v := range expected {
+				if !reflect.DeepEqual(actual[k], v) {
+					t.Errorf("Expected %q to be %v, but got %v", k, v, actual[k])
+				}
+			}
+		})
+	}
+}
+
+func TestExtras_KnownFieldsWin(t *testing.T) {
+	var p TaskActionItemPayload
+	if err := json.Unmarshal([]byte(`{"tt":"old","xx":1}`), &p); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, ok := p.Extras["tt"]; ok {
+		t.Fatal("Expected known fields not to be kept as extras")
+	}
+	p.Title = String("new")
+	p.Extras["tt"] = json.RawMessage(`"stale"`)
+
+	bs, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var v map[string]interface{}
+	json.Unmarshal(bs, &v)
+	if v["tt"] != "new" {
+		t.Errorf("Expected title %q, but got %v", "new", v["tt"])
+	}
+	if v["xx"] != float64(1) {
+		t.Errorf("Expected unknown field to be kept, but got %v", v["xx"])
+	}
+}
+
+func TestExtras_Merge(t *testing.T) {
+	a := Extras{"a": json.RawMessage(`1`), "b": json.RawMessage(`1`)}
+	b := Extras{"b": json.RawMessage(`2`)}
+	m := a.Merge(b)
+	if string(m["a"]) != "1" || string(m["b"]) != "2" {
+		t.Fatalf("Unexpected merge result %v", m)
+	}
+	if string(a["b"]) != "1" {
+		t.Fatal("Expected merge not to modify the receiver")
+	}
+	if Extras(nil).Merge(nil) != nil {
+		t.Fatal("Expected merge of empty extras to be nil")
+	}
+}
+
+func TestPayload_RoundTripKeepsPresentFields(t *testing.T) {
+	// unset fields must not be sent as null, which would clear them on other devices,
+	// while zero values like "ix":0 or empty titles are still sent
+	testCases := []struct {
+		Title string
+		JSON  string
+		Value interface{}
+	}{
+		{"tag zero values", `{"ix":0,"tt":"","sh":"","pn":[]}`, &TagActionItemPayload{}},
+		{"tag short hand only", `{"sh":"t"}`, &TagActionItemPayload{}},
+		{"check list item zero values", `{"ix":0,"tt":""}`, &CheckListActionItemPayload{}},
+		{"check list item status only", `{"ss":3}`, &CheckListActionItemPayload{}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Title, func(t *testing.T) {
+			if err := json.Unmarshal([]byte(testCase.JSON), testCase.Value); err != nil {
+				t.Fatal(err.Error())
+			}
+			bs, err := json.Marshal(testCase.Value)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+
+			var expected, actual map[string]interface{}
+			json.Unmarshal([]byte(testCase.JSON), &expected)
+			json.Unmarshal(bs, &actual)
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("Expected %s, but got %s", testCase.JSON, bs)
+			}
+		})
+	}
+}
@@ -17,8 +17,43 @@ func Schedule(val TaskSchedule) *TaskSchedule {
 	return &val
 }
 
+// Type returns a pointer to a TaskType
+func Type(val TaskType) *TaskType {
+	return &val
+}
+
 // Time returns a pointer to a Time
 func Time(val time.Time) *Timestamp {
 	ts := Timestamp(val)
 	return &ts
 }
+
+func intVal(i int) *int {
+	return &i
+}
+
+func bucket(b StartBucket) *StartBucket {
+	return &b
+}
+
+func boolVal(b bool) *bool {
+	return &b
+}
+
+// ids returns a pointer to a list of ids, which is empty instead of nil if no ids are given
+// so the field is cleared instead of left unchanged
+func ids(ids ...string) *[]string {
+	if ids == nil {
+		ids = []string{}
+	}
+	return &ids
+}
+
+// tagIDs returns a pointer to the list of ids of tags
+func tagIDs(tags []*Tag) *[]string {
+	uuids := make([]string, len(tags))
+	for i, tag := range tags {
+		uuids[i] = tag.UUID
+	}
+	return ids(uuids...)
+}
@@ -3,12 +3,14 @@ package thingscloud
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httputil"
 	"strconv"
+	"sync"
 )
 
 // History represents a synchronization stream. It's identified with a uuid v4
@@ -20,6 +22,13 @@ type History struct {
 	LatestSchemaVersion    int
 	EndTotalContentSize    int
 	LatestTotalContentSize int
+	IsEmpty                bool
+	// IsOwn is set by DiscoverHistories for the history matching the accounts history key
+	IsOwn bool
+	// Strict makes Write validate all items and reject the batch if any item is invalid or can't be validated
+	Strict bool
+	// References, if set, is used by strict writes to ensure referenced objects exist
+	References References
 }
 
 type historyResponse struct {
@@ -55,6 +64,7 @@ func (h *History) Sync() error {
 	var v itemsResponse
 	json.Unmarshal(bs, &v)
 	h.LatestServerIndex = v.CurrentItemIndex
+	h.IsEmpty = v.CurrentItemIndex == 0
 	h.LatestSchemaVersion = v.SchemaVersion
 	h.LatestTotalContentSize = v.LatestTotalContentSize
 	return nil
@@ -92,6 +102,7 @@ func (c *Client) History(id string) (*History, error) {
 		LatestServerIndex:      h.LatestServerIndex,
 		LatestSchemaVersion:    h.LatestSchemaVersion,
 		LatestTotalContentSize: h.LatestTotalContentSize,
+		IsEmpty:                h.IsEmpty,
 	}, nil
 }
 
@@ -149,6 +160,110 @@ func (c *Client) Histories() ([]*History, error) {
 	return histories, nil
 }
 
+// DiscoverHistories requests all known history keys and concurrently loads the details of every history.
+// The history matching the HistoryKey returned by Verify is marked with IsOwn.
+func (c *Client) DiscoverHistories() ([]*History, error) {
+	v, err := c.Verify()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := c.Histories()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		histories = make([]*History, len(keys))
+		errs      = make([]error, len(keys))
+		wg        sync.WaitGroup
+	)
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			histories[i], errs[i] = c.History(id)
+		}(i, key.ID)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("history %s: %w", keys[i].ID, err)
+		}
+		histories[i].IsOwn = histories[i].ID == v.HistoryKey
+	}
+	return histories, nil
+}
+
+// HistoryPolicy picks the active history out of a list of discovered histories.
+// It returns nil if no history qualifies.
+type HistoryPolicy func(histories []*History) *History
+
+var (
+	// ErrNoHistory is returned if no history matches the selection policies
+	ErrNoHistory = errors.New("no matching history")
+
+	// PreferOwnHistory selects the history matching the accounts history key
+	PreferOwnHistory HistoryPolicy = func(histories []*History) *History {
+		for _, h := range histories {
+			if h.IsOwn {
+				return h
+			}
+		}
+		return nil
+	}
+
+	// PreferLatestHistory selects the non-empty history with the highest server index
+	PreferLatestHistory HistoryPolicy = func(histories []*History) *History {
+		var latest *History
+		for _, h := range histories {
+			if h.IsEmpty {
+				continue
+			}
+			if latest == nil || h.LatestServerIndex > latest.LatestServerIndex {
+				latest = h
+			}
+		}
+		return latest
+	}
+
+	// PreferLargestHistory selects the non-empty history with the biggest content size
+	PreferLargestHistory HistoryPolicy = func(histories []*History) *History {
+		var largest *History
+		for _, h := range histories {
+			if h.IsEmpty {
+				continue
+			}
+			if largest == nil || h.LatestTotalContentSize > largest.LatestTotalContentSize {
+				largest = h
+			}
+		}
+		return largest
+	}
+)
+
+// PreferHistoryID selects the history with the given id
+func PreferHistoryID(id string) HistoryPolicy {
+	return func(histories []*History) *History {
+		for _, h := range histories {
+			if h.ID == id {
+				return h
+			}
+		}
+		return nil
+	}
+}
+
+// SelectHistory applies all policies in order and returns the first match
+func SelectHistory(histories []*History, policies ...HistoryPolicy) (*History, error) {
+	for _, policy := range policies {
+		if h := policy(histories); h != nil {
+			return h, nil
+		}
+	}
+	return nil, ErrNoHistory
+}
+
 type createHistoryResponse struct {
 	Key string `json:"new-history-key"`
 }
@@ -211,7 +326,14 @@ type Identifiable interface {
 	UUID() string
 }
 
+// Write commits items to the history. In strict mode invalid batches are rejected
+// before anything is sent to thingscloud.
 func (h *History) Write(items ...Identifiable) error {
+	if h.Strict {
+		if err := ValidateBatch(h.References, items...); err != nil {
+			return err
+		}
+	}
 	m := map[string]interface{}{}
 	for _, item := range items {
 		m[item.UUID()] = item
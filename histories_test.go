@@ -83,3 +83,84 @@ func TestHistory_Sync(t *testing.T) {
 		}
 	})
 }
+
+func TestClient_DiscoverHistories(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		t.Parallel()
+		server := fakeRouter(map[string]fakeResponse{
+			"/version/1/account/martin@example.com":                   {200, "verify-history-success.json"},
+			"/version/1/account/martin@example.com/own-history-keys":  {200, "histories-multiple-success.json"},
+			"/version/1/history/33333abb-123c-4e12-b123-ffe8981c207e": {200, "history-empty-success.json"},
+			"/version/1/history/44444abb-123c-4e12-b123-ffe8981c207e": {200, "history-details-success.json"},
+		})
+		defer server.Close()
+
+		c := New(fmt.Sprintf("http://%s", server.Listener.Addr().String()), "martin@example.com", "")
+		hs, err := c.DiscoverHistories()
+		if err != nil {
+			t.Fatalf("Expected discovery to succeed, but didn't: %q", err.Error())
+		}
+		if len(hs) != 2 {
+			t.Fatalf("Expected to receive %d histories, but got %d", 2, len(hs))
+		}
+		if !hs[0].IsEmpty || hs[0].IsOwn {
+			t.Errorf("Expected first history to be empty and foreign, but got %#v", hs[0])
+		}
+		if hs[1].IsEmpty || !hs[1].IsOwn {
+			t.Errorf("Expected second history to be filled and owned, but got %#v", hs[1])
+		}
+		if hs[1].LatestServerIndex != 27 {
+			t.Errorf("Expected LatestServerIndex of %d, but got %d", 27, hs[1].LatestServerIndex)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Parallel()
+		server := fakeRouter(map[string]fakeResponse{
+			"/version/1/account/martin@example.com":                   {200, "verify-history-success.json"},
+			"/version/1/account/martin@example.com/own-history-keys":  {200, "histories-multiple-success.json"},
+			"/version/1/history/33333abb-123c-4e12-b123-ffe8981c207e": {401, "error.json"},
+			"/version/1/history/44444abb-123c-4e12-b123-ffe8981c207e": {200, "history-details-success.json"},
+		})
+		defer server.Close()
+
+		c := New(fmt.Sprintf("http://%s", server.Listener.Addr().String()), "martin@example.com", "")
+		if _, err := c.DiscoverHistories(); err == nil {
+			t.Error("Expected discovery to fail, but didn't")
+		}
+	})
+}
+
+func TestSelectHistory(t *testing.T) {
+	empty := &History{ID: "empty", IsEmpty: true, LatestServerIndex: 100}
+	own := &History{ID: "own", IsOwn: true, LatestServerIndex: 10, LatestTotalContentSize: 500}
+	other := &History{ID: "other", LatestServerIndex: 20, LatestTotalContentSize: 100}
+	histories := []*History{empty, own, other}
+
+	testCases := []struct {
+		Title    string
+		Policies []HistoryPolicy
+		Expected *History
+	}{
+		{"own", []HistoryPolicy{PreferOwnHistory}, own},
+		{"latest", []HistoryPolicy{PreferLatestHistory}, other},
+		{"largest", []HistoryPolicy{PreferLargestHistory}, own},
+		{"by id", []HistoryPolicy{PreferHistoryID("empty")}, empty},
+		{"fallback", []HistoryPolicy{PreferHistoryID("unknown"), PreferLatestHistory}, other},
+		{"none", []HistoryPolicy{PreferHistoryID("unknown")}, nil},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Title, func(t *testing.T) {
+			h, err := SelectHistory(histories, testCase.Policies...)
+			if testCase.Expected == nil {
+				if err != ErrNoHistory {
+					t.Fatalf("Expected %v, but got %v", ErrNoHistory, err)
+				}
+				return
+			}
+			if h != testCase.Expected {
+				t.Errorf("Expected history %q, but got %v", testCase.Expected.ID, h)
+			}
+		})
+	}
+}
@@ -73,6 +73,7 @@ func (h *History) Items(opts ItemsOptions) ([]Item, bool, error) {
 	}
 	h.LoadedServerIndex = h.LoadedServerIndex + len(v.Items)
 	h.LatestServerIndex = v.CurrentItemIndex
+	h.IsEmpty = v.CurrentItemIndex == 0
 	h.EndTotalContentSize = v.EndTotalContentSize
 	h.LatestTotalContentSize = v.LatestTotalContentSize
 	hasMoreItems := h.LoadedServerIndex < h.LatestServerIndex
@@ -0,0 +1,174 @@
+package thingscloud
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// NoteFormat describes how a note is encoded inside a payload
+type NoteFormat int
+
+const (
+	// NoteFormatXML wraps the text in a <note xml:space="preserve"> element
+	NoteFormatXML NoteFormat = iota
+	// NoteFormatText is the structured text object used by newer things versions
+	NoteFormatText
+	// NoteFormatPlain is an unwrapped string
+	NoteFormatPlain
+)
+
+// noteTextType identifies plain text notes inside the structured format
+const noteTextType = 1
+
+// Note describes the notes attached to a Task.
+// The zero value is an empty note which is serialized in the XML format.
+type Note struct {
+	Text   string
+	Format NoteFormat
+}
+
+// NewNote creates a note using the XML format
+func NewNote(text string) Note {
+	return Note{Text: text}
+}
+
+type xmlNote struct {
+	XMLName xml.Name `xml:"note"`
+	Text    string   `xml:",chardata"`
+}
+
+type textNote struct {
+	Type     string `json:"_t"`
+	Checksum uint32 `json:"ch"`
+	Value    string `json:"v"`
+	Kind     int    `json:"t"`
+}
+
+// ParseNote decodes the string representation of a note. Strings which are not wrapped in
+// a <note> element are treated as plain text.
+func ParseNote(raw string) (Note, error) {
+	if !strings.HasPrefix(raw, "<note") {
+		return Note{Text: raw, Format: NoteFormatPlain}, nil
+	}
+	var n xmlNote
+	if err := xml.Unmarshal([]byte(raw), &n); err != nil {
+		return Note{}, fmt.Errorf("invalid note: %w", err)
+	}
+	return Note{Text: n.Text, Format: NoteFormatXML}, nil
+}
+
+// UnmarshalJSON decodes all known note formats
+func (n *Note) UnmarshalJSON(bs []byte) error {
+	var raw string
+	if err := json.Unmarshal(bs, &raw); err == nil {
+		note, err := ParseNote(raw)
+		if err != nil {
+			return err
+		}
+		*n = note
+		return nil
+	}
+
+	var tn textNote
+	if err := json.Unmarshal(bs, &tn); err != nil {
+		return err
+	}
+	if tn.Type != "tx" {
+		return fmt.Errorf("unsupported note type %q", tn.Type)
+	}
+	*n = Note{Text: tn.Value, Format: NoteFormatText}
+	return nil
+}
+
+// MarshalJSON encodes the note in its format
+func (n Note) MarshalJSON() ([]byte, error) {
+	switch n.Format {
+	case NoteFormatText:
+		return json.Marshal(textNote{
+			Type:     "tx",
+			Checksum: crc32.ChecksumIEEE([]byte(n.Text)),
+			Value:    n.Text,
+			Kind:     noteTextType,
+		})
+	case NoteFormatPlain:
+		return json.Marshal(n.Text)
+	default:
+		if err := validateXMLText(n.Text); err != nil {
+			return nil, err
+		}
+		return json.Marshal(n.XML())
+	}
+}
+
+// noteEscaper escapes markup and carriage returns, which XML parsers would normalize to line feeds
+var noteEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+
+// validateXMLText ensures text only contains characters allowed in XML 1.0.
+// Other control characters can't be represented, not even as character references
+func validateXMLText(text string) error {
+	for i, r := range text {
+		switch {
+		case r == utf8.RuneError && !strings.HasPrefix(text[i:], "\uFFFD"):
+			return fmt.Errorf("invalid note: invalid UTF-8 at offset %d", i)
+		case r == '\t' || r == '\n' || r == '\r':
+		case r < 0x20 || r == 0xFFFE || r == 0xFFFF:
+			return fmt.Errorf("invalid note: character %U is not allowed in XML", r)
+		}
+	}
+	return nil
+}
+
+// XML returns the note wrapped in a <note> element. Whitespace is kept as is.
+// Texts containing control characters other than tabs and line breaks result in invalid XML,
+// which MarshalJSON refuses to encode
+func (n Note) XML() string {
+	return `<note xml:space="preserve">` + noteEscaper.Replace(n.Text) + `</note>`
+}
+
+// String returns the plain text of the note
+func (n Note) String() string {
+	return n.Text
+}
+
+var (
+	noteURLPattern      = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s<>]+`)
+	markdownEscaper     = strings.NewReplacer(`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`, `<`, `\<`, `>`, `\>`, `#`, `\#`, `|`, `\|`)
+	markdownListPattern = regexp.MustCompile(`^(\s*)([-+])(\s)`)
+	markdownEnumPattern = regexp.MustCompile(`^(\s*)(\d+)\.(\s)`)
+)
+
+// Markdown returns the note as markdown which renders to the same text.
+// Line breaks are kept and links are turned into autolinks.
+func (n Note) Markdown() string {
+	lines := strings.Split(strings.ReplaceAll(n.Text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		var b strings.Builder
+		last := 0
+		for _, loc := range noteURLPattern.FindAllStringIndex(line, -1) {
+			b.WriteString(markdownEscaper.Replace(line[last:loc[0]]))
+			b.WriteString("<" + line[loc[0]:loc[1]] + ">")
+			last = loc[1]
+		}
+		b.WriteString(markdownEscaper.Replace(line[last:]))
+		line = markdownListPattern.ReplaceAllString(b.String(), `${1}\${2}${3}`)
+		lines[i] = markdownEnumPattern.ReplaceAllString(line, `${1}${2}\.${3}`)
+	}
+
+	var b strings.Builder
+	for i, line := range lines {
+		b.WriteString(line)
+		if i == len(lines)-1 {
+			break
+		}
+		if line != "" && lines[i+1] != "" {
+			b.WriteString("  ")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
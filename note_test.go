@@ -0,0 +1,133 @@
+package thingscloud
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNote_UnmarshalJSON(t *testing.T) {
+	testCases := []struct {
+		Title          string
+		JSON           string
+		ExpectedText   string
+		ExpectedFormat NoteFormat
+	}{
+		{"xml", `"<note xml:space=\"preserve\">test body pm</note>"`, "test body pm", NoteFormatXML},
+		{"xml escaped", `"<note xml:space=\"preserve\">a &lt;b&gt; &amp; \"c\"</note>"`, `a <b> & "c"`, NoteFormatXML},
+		{"xml whitespace", `"<note xml:space=\"preserve\">  line 1\n\n\tline 2  </note>"`, "  line 1\n\n\tline 2  ", NoteFormatXML},
+		{"xml empty", `"<note xml:space=\"preserve\"></note>"`, "", NoteFormatXML},
+		{"plain", `"just text"`, "just text", NoteFormatPlain},
+		{"xml carriage return", `"<note xml:space=\"preserve\">line 1&#xD;\nline 2</note>"`, "line 1\r\nline 2", NoteFormatXML},
+		{"text", `{"_t":"tx","ch":1234,"v":"structured\ntext","t":1}`, "structured\ntext", NoteFormatText},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Title, func(t *testing.T) {
+			var n Note
+			if err := json.Unmarshal([]byte(testCase.JSON), &n); err != nil {
+				t.Fatal(err.Error())
+			}
+			if n.Text != testCase.ExpectedText {
+				t.Errorf("Expected text %q, but got %q", testCase.ExpectedText, n.Text)
+			}
+			if n.Format != testCase.ExpectedFormat {
+				t.Errorf("Expected format %d, but got %d", testCase.ExpectedFormat, n.Format)
+			}
+		})
+	}
+}
+
+func TestNote_UnmarshalJSON_Invalid(t *testing.T) {
+	testCases := []struct {
+		Title string
+		JSON  string
+	}{
+		{"unterminated", `"<note>unterminated"`},
+		{"control character", `"<note xml:space=\"preserve\">bell \u0007</note>"`},
+		{"unsupported type", `{"_t":"xx","v":"text"}`},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Title, func(t *testing.T) {
+			var n Note
+			if err := json.Unmarshal([]byte(testCase.JSON), &n); err == nil {
+				t.Fatalf("Expected error, but got %#v", n)
+			}
+		})
+	}
+}
+
+func TestNote_RoundTrip(t *testing.T) {
+	testCases := []Note{
+		{Text: "simple", Format: NoteFormatXML},
+		{Text: `escaped <tags> & "quotes" 'apostrophes'`, Format: NoteFormatXML},
+		{Text: "  leading\n\n\ttabs and trailing  \n", Format: NoteFormatXML},
+		{Text: "windows\r\nline\rbreaks\r", Format: NoteFormatXML},
+		{Text: "</note> inside", Format: NoteFormatXML},
+		{Text: "ünïcödé ✓", Format: NoteFormatXML},
+		{Text: "plain <text>", Format: NoteFormatPlain},
+		{Text: "structured <text>\n", Format: NoteFormatText},
+		{Text: "control \x07 \x1b characters\r\n", Format: NoteFormatPlain},
+		{Text: "control \x07 \x1b characters\r\n", Format: NoteFormatText},
+	}
+	for _, testCase := range testCases {
+		bs, err := json.Marshal(testCase)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		var n Note
+		if err := json.Unmarshal(bs, &n); err != nil {
+			t.Fatal(err.Error())
+		}
+		if n != testCase {
+			t.Errorf("Expected %#v after round trip via %s, but got %#v", testCase, string(bs), n)
+		}
+	}
+}
+
+func TestNote_MarshalJSON_ControlCharacters(t *testing.T) {
+	for _, text := range []string{"bell \x07", "escape \x1b", "null \x00", "invalid \xff utf-8"} {
+		if bs, err := json.Marshal(Note{Text: text, Format: NoteFormatXML}); err == nil {
+			t.Errorf("Expected %q to be rejected, but got %s", text, string(bs))
+		}
+	}
+}
+
+func TestNote_XML(t *testing.T) {
+	n := NewNote("a < b & c")
+	expected := `<note xml:space="preserve">a &lt; b &amp; c</note>`
+	if n.XML() != expected {
+		t.Fatalf("Expected %q but got %q", expected, n.XML())
+	}
+
+	p := TaskActionItemPayload{Note: Some(n)}
+	bs, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var raw map[string]string
+	if err := json.Unmarshal(bs, &raw); err != nil {
+		t.Fatal(err.Error())
+	}
+	if raw["nt"] != expected {
+		t.Fatalf("Expected payload note %q but got %q", expected, raw["nt"])
+	}
+}
+
+func TestNote_Markdown(t *testing.T) {
+	testCases := []struct {
+		Text     string
+		Expected string
+	}{
+		{"plain", "plain"},
+		{"*bold* and _em_", `\*bold\* and \_em\_`},
+		{"line 1\nline 2", "line 1  \nline 2"},
+		{"para 1\n\npara 2", "para 1\n\npara 2"},
+		{"- not a list\n1. nor this", "\\- not a list  \n1\\. nor this"},
+		{"see https://example.com/a_b?c=1", "see <https://example.com/a_b?c=1>"},
+	}
+	for _, testCase := range testCases {
+		n := Note{Text: testCase.Text}
+		if n.Markdown() != testCase.Expected {
+			t.Errorf("Expected markdown %q, but got %q", testCase.Expected, n.Markdown())
+		}
+	}
+}
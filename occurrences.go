@@ -0,0 +1,266 @@
+package thingscloud
+
+import (
+	"sort"
+	"time"
+)
+
+// maxEmptyPeriods stops iterating rules whose periods never contain a matching day
+const maxEmptyPeriods = 1000
+
+// OccurrenceIterator walks all occurrences of a repeater configuration in order, starting at FirstScheduledAt.
+// In contrast to NextScheduledAt every occurrence is computed only once.
+type OccurrenceIterator struct {
+	c       RepeaterConfiguration
+	start   Day
+	period  int
+	pending []Day
+	count   int
+	ended   bool
+}
+
+// Iterator returns an iterator over all occurrences of the rule.
+// Rules failing Validate return an error wrapping ErrInvalidRepeater
+func (c RepeaterConfiguration) Iterator() (*OccurrenceIterator, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &OccurrenceIterator{c: c, start: c.firstScheduledDay()}, nil
+}
+
+// Next returns the next occurrence as midnight UTC, like things stores start dates.
+// Once the rule has ended, Next returns false
+func (it *OccurrenceIterator) Next() (time.Time, bool) {
+	return it.NextIn(time.UTC)
+}
+
+// NextIn returns the next occurrence as start of the day in loc, e.g. the time zone of the user
+func (it *OccurrenceIterator) NextIn(loc *time.Location) (time.Time, bool) {
+	d, ok := it.NextDay()
+	if !ok {
+		return time.Time{}, false
+	}
+	return d.In(loc), true
+}
+
+// Ended reports whether the rule has no further occurrences, because RepeatCount or LastScheduledAt were reached
+func (it *OccurrenceIterator) Ended() bool {
+	if it.ended {
+		return true
+	}
+	if count := it.c.repeatCount(); !it.c.IsNeverending() && count > 0 && it.count >= count {
+		it.ended = true
+		return true
+	}
+	if len(it.pending) == 0 {
+		it.fill()
+		if it.ended {
+			return true
+		}
+	}
+	if !it.c.IsNeverending() && it.c.LastScheduledAt != nil && it.pending[0].After(it.c.lastScheduledDay()) {
+		it.ended = true
+	}
+	return it.ended
+}
+
+// NextDay returns the next occurrence as calendar day
+func (it *OccurrenceIterator) NextDay() (Day, bool) {
+	if it.Ended() {
+		return Day{}, false
+	}
+	d := it.pending[0]
+	it.pending = it.pending[1:]
+	it.count++
+	return d, true
+}
+
+// fill expands periods until one contains occurrences
+func (it *OccurrenceIterator) fill() {
+	// every period of a rule without amplitude yields the same days, which would never end.
+	// Iterator rejects these rules already, this guards against rules changed afterwards
+	if it.c.FrequencyAmplitude < 1 {
+		it.ended = true
+		return
+	}
+	for empty := 0; len(it.pending) == 0; empty++ {
+		if empty >= maxEmptyPeriods {
+			it.ended = true
+			return
+		}
+		days := it.periodDays(it.period)
+		it.period++
+		sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+		for i, d := range days {
+			if d.Before(it.start) || (i > 0 && d == days[i-1]) {
+				continue
+			}
+			it.pending = append(it.pending, d)
+		}
+	}
+}
+
+// periodDays returns the matching days of the nth period of the rule, e.g. the nth matching week
+func (it *OccurrenceIterator) periodDays(n int) []Day {
+	c := it.c
+	amplitude := int(c.FrequencyAmplitude) * n
+	if c.IsAfterCompletion() {
+		return []Day{c.addInterval(it.start, n)}
+	}
+
+	days := []Day{}
+	switch c.FrequencyUnit {
+	case FrequencyUnitDaily:
+		days = append(days, it.start.AddDays(amplitude))
+	case FrequencyUnitWeekly:
+		week := it.start.AddDays(-int(it.start.Weekday()) + amplitude*7)
+		for _, dc := range c.DetailConfiguration {
+			if dc.Weekday != nil {
+				days = append(days, week.AddDays(int(*dc.Weekday)))
+			}
+		}
+	case FrequencyUnitMonthly:
+		month := NewDay(it.start.Year, it.start.Month+time.Month(amplitude), 1)
+		for _, dc := range c.DetailConfiguration {
+			if d, ok := dayOfMonth(month.Year, month.Month, dc); ok {
+				days = append(days, d)
+			}
+		}
+	case FrequencyUnitYearly:
+		for _, dc := range c.DetailConfiguration {
+			if dc.Month == nil {
+				continue
+			}
+			if d, ok := dayOfMonth(it.start.Year+amplitude, time.Month(*dc.Month+1), dc); ok {
+				days = append(days, d)
+			}
+		}
+	}
+	return days
+}
+
+// dayOfMonth returns the day described by dc within a month. Days beyond the end of the month
+// are moved to the last day of the month, like NextScheduledAt does. Missing weekdays, e.g. a fifth
+// monday, are skipped
+func dayOfMonth(year int, month time.Month, dc RepeaterDetailConfiguration) (Day, bool) {
+	first := NewDay(year, month, 1)
+	last := NewDay(year, month+1, 0)
+	if dc.Weekday != nil && dc.MonthOf != nil {
+		if *dc.MonthOf == -1 {
+			return last.AddDays(-((int(last.Weekday()) - int(*dc.Weekday) + 7) % 7)), true
+		}
+		d := first.AddDays((int(*dc.Weekday)-int(first.Weekday())+7)%7 + 7*int(*dc.MonthOf-1))
+		return d, d.Month == month
+	}
+	if dc.Day == nil {
+		return Day{}, false
+	}
+	if *dc.Day < 0 || int(*dc.Day) >= last.Day {
+		return last, true
+	}
+	return NewDay(year, month, int(*dc.Day)+1), true
+}
+
+// Occurrences returns all occurrences within [from, to). ended reports whether the rule has
+// no occurrences after to, because RepeatCount or LastScheduledAt were reached.
+// Rules failing Validate return an error wrapping ErrInvalidRepeater
+func (c RepeaterConfiguration) Occurrences(from, to time.Time) (occurrences []time.Time, ended bool, err error) {
+	return c.OccurrencesIn(from, to, time.UTC)
+}
+
+// OccurrencesIn is like Occurrences, but compares calendar days in loc, e.g. the time zone of the user.
+// Occurrences are returned as start of the day in loc
+func (c RepeaterConfiguration) OccurrencesIn(from, to time.Time, loc *time.Location) (occurrences []time.Time, ended bool, err error) {
+	it, err := c.Iterator()
+	if err != nil {
+		return nil, false, err
+	}
+	occurrences = []time.Time{}
+	first, last := DayIn(from, loc), DayIn(to, loc)
+	if !to.Equal(last.In(loc)) {
+		// to falls within last, which is part of the window
+		last = last.AddDays(1)
+	}
+	for {
+		d, ok := it.NextDay()
+		if !ok {
+			return occurrences, true, nil
+		}
+		if !d.Before(last) {
+			return occurrences, false, nil
+		}
+		if !d.Before(first) {
+			occurrences = append(occurrences, d.In(loc))
+		}
+	}
+}
+
+// Occurrence is a single instance of a repeating task
+type Occurrence struct {
+	Start    Day
+	Deadline *Day
+	Reminder *time.Time
+}
+
+// InstanceOffsets derive the deadline and reminder of every instance from its start date
+type InstanceOffsets struct {
+	// Deadline is the number of days between start and deadline, nil for instances without deadline
+	Deadline *int
+	// DeadlineSuppressedUntil drops the deadline of instances starting on or before this day
+	DeadlineSuppressedUntil *Day
+	// Reminder is the wall clock time of the reminder on the start date, nil for instances without reminder
+	Reminder *time.Duration
+}
+
+// occurrence derives deadline and reminder of the instance starting on start
+func (o InstanceOffsets) occurrence(start Day, loc *time.Location) Occurrence {
+	occurrence := Occurrence{Start: start}
+	if o.Deadline != nil && (o.DeadlineSuppressedUntil == nil || start.After(*o.DeadlineSuppressedUntil)) {
+		deadline := start.AddDays(*o.Deadline)
+		occurrence.Deadline = &deadline
+	}
+	if o.Reminder != nil {
+		at := reminderAt(start, *o.Reminder, loc)
+		occurrence.Reminder = &at
+	}
+	return occurrence
+}
+
+// InstancesIn returns the instances starting within [from, to) in loc, with deadline and reminder derived
+// from offsets. ended reports whether the rule has no occurrences after to
+func (c RepeaterConfiguration) InstancesIn(from, to time.Time, loc *time.Location, offsets InstanceOffsets) (instances []Occurrence, ended bool, err error) {
+	starts, ended, err := c.OccurrencesIn(from, to, loc)
+	if err != nil {
+		return nil, false, err
+	}
+	instances = make([]Occurrence, 0, len(starts))
+	for _, start := range starts {
+		instances = append(instances, offsets.occurrence(DayOf(start), loc))
+	}
+	return instances, ended, nil
+}
+
+// InstanceOffsets returns how a repeating template derives deadline and reminder of its instances.
+// Templates with a deadline store the days between start and deadline as DeadlineOffset (do),
+// deadlines of instances up to DeadlineSuppressionDate (dds) are dropped. Reminders use AlarmTimeOffset (ato)
+func (t *Task) InstanceOffsets() InstanceOffsets {
+	offsets := InstanceOffsets{Reminder: t.AlarmTimeOffset}
+	if t.DeadlineDate != nil {
+		days := t.DeadlineOffset
+		offsets.Deadline = &days
+	}
+	if t.DeadlineSuppressionDate != nil {
+		day := DayOf(t.DeadlineSuppressionDate.UTC())
+		offsets.DeadlineSuppressedUntil = &day
+	}
+	return offsets
+}
+
+// Occurrences returns the instances a repeating template creates within [from, to) in loc, e.g. the
+// time zone of the user. Tasks which are not repeating templates have no occurrences
+func (t *Task) Occurrences(from, to time.Time, loc *time.Location) (occurrences []Occurrence, ended bool, err error) {
+	if !t.IsRepeatingTemplate() {
+		return []Occurrence{}, true, nil
+	}
+	return t.Repeater.InstancesIn(from, to, loc, t.InstanceOffsets())
+}
@@ -0,0 +1,252 @@
+package thingscloud
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRepeaterConfiguration_Iterator(t *testing.T) {
+	testCases := []struct {
+		Title         string
+		Data          []byte
+		ExpectedDates []string
+		ExpectedEnded bool
+	}{
+		{"Every 2nd day", rcEvery2ndDay, []string{"2017-09-03", "2017-09-05", "2017-09-07"}, false},
+		{"Every day w/ date", rcEveryDayEndDate, []string{"2018-02-28", "2018-03-01"}, true},
+		{"Every day w/ count", rcEveryDayEndRepeat, []string{"2018-02-28", "2018-03-01"}, true},
+		{"Every 2n week on monday and tuesday", rcEvery2ndWeekOnMondayAndTuesday, []string{"2017-09-04", "2017-09-05", "2017-09-18", "2017-09-19"}, false},
+		{"Every week on monday w/ date", rcEveryWeekOnMondayEndDate, []string{"2018-03-05", "2018-03-12"}, true},
+		{"Every week on monday w/ count", rcEveryWeekOnMondayEndRepeat, []string{"2018-03-05", "2018-03-12"}, true},
+		{"Every first day and 2nd monday of every month", rc1stDayAnd2ndMondayEveryMonth, []string{"2017-09-01", "2017-09-11", "2017-10-01", "2017-10-09"}, false},
+		{"Every last and first day of every month", rc1stAndLastDayEveryMonth, []string{"2017-07-31", "2017-08-01", "2017-08-31", "2017-09-01", "2017-09-30"}, false},
+		{"Every last Monday of every 2nd month", rcLastMondayEvery2ndMonth, []string{"2017-09-25", "2017-11-27", "2018-01-29", "2018-03-26"}, false},
+		{"Every first Monday of every 2nd month", rcFirstMondayEvery2ndMonth, []string{"2017-08-07", "2017-10-02", "2017-12-04"}, false},
+		{"Every 1st day of every month w/ date", rc1stDayEveryMonthEndDate, []string{"2018-02-01", "2018-03-01"}, true},
+		{"Every 1st day of every month w/ count", rc1stDayEveryMonthEndRepeat, []string{"2018-02-01", "2018-03-01"}, true},
+		{"Every last day of february of every year", rcLastDayFebuaryEveryYear, []string{"2018-02-28", "2019-02-28", "2020-02-29", "2021-02-28"}, false},
+		{"Every first day of january and last Wednesday of febuary of every year", rc1stJanuaryAndLastWednesdayFebuaryEveryYear, []string{"2018-01-01", "2018-02-28", "2019-01-01", "2019-02-27", "2020-01-01", "2020-02-26"}, false},
+		{"Every last day of january every year w/ date", rcLastDayJanuaryEveryYearEndDate, []string{"2018-01-31", "2019-01-31"}, true},
+		{"Every last day of january every year w/ count", rcLastDayJanuaryEveryYearEndRepeat, []string{"2018-01-31", "2019-01-31"}, true},
+		{"Every 3 days after completion", rcEvery3DaysAfterCompletion, []string{"2018-02-28", "2018-03-03", "2018-03-06"}, false},
+		{"Every month after completion w/ date", rcEveryMonthAfterCompletionEndDate, []string{"2018-02-28", "2018-03-28", "2018-04-28"}, true},
+		{"Every year after completion w/ count", rcEveryYearAfterCompletionEndRepeat, []string{"2018-02-28", "2019-02-28"}, true},
+	}
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("testCase %q", testCase.Title), func(t *testing.T) {
+			var rc RepeaterConfiguration
+			if err := json.Unmarshal(testCase.Data, &rc); err != nil {
+				t.Fatalf("Failed to deserialize repeater configuration: %v", err)
+			}
+
+			it, err := rc.Iterator()
+			if err != nil {
+				t.Fatalf("Expected valid rule, but got %v", err)
+			}
+			for i, date := range testCase.ExpectedDates {
+				next, ok := it.Next()
+				if !ok {
+					t.Fatalf("Expected %q for next %d date, but the rule ended", date, i+1)
+				}
+				if next.Format("2006-01-02") != date {
+					t.Errorf("Expected %q for next %d date, but got %q", date, i+1, next.Format("2006-01-02"))
+				}
+			}
+			if it.Ended() != testCase.ExpectedEnded {
+				t.Fatalf("Expected ended to be %v, but got %v", testCase.ExpectedEnded, it.Ended())
+			}
+			if _, ok := it.Next(); ok == testCase.ExpectedEnded {
+				t.Fatalf("Expected another occurrence to be %v, but got %v", !testCase.ExpectedEnded, ok)
+			}
+		})
+	}
+}
+
+func TestRepeaterConfiguration_IteratorMatchesNextScheduledAt(t *testing.T) {
+	for _, data := range [][]byte{
+		rcEveryDay, rcEveryWeekOnMondayAndTuesday, rc1stDayAnd3rdDayEveryMonth, rcLastDayEvery2ndMonth, rcLastMondayEvery2ndMonth,
+		rc1stAndLastDayFebuaryEveryYear, rc1stJanuaryAnd1stMarchEveryYear, rcLastWednesdayFebuaryEveryYear,
+		// days beyond the end of a month
+		rc30thDayEveryMonth, rc1stAnd30thDayEveryMonth, rc29thFebuaryEveryYear,
+	} {
+		var rc RepeaterConfiguration
+		if err := json.Unmarshal(data, &rc); err != nil {
+			t.Fatalf("Failed to deserialize repeater configuration: %v", err)
+		}
+		it, err := rc.Iterator()
+		if err != nil {
+			t.Fatalf("Expected valid rule, but got %v", err)
+		}
+		for i := 0; i < 24; i++ {
+			next, _ := it.Next()
+			if expected, _ := rc.NextScheduledAt(i); !next.Equal(expected) {
+				t.Fatalf("Expected %s for next %d date of %s, but got %s", expected, i+1, data, next)
+			}
+		}
+	}
+}
+
+func TestOccurrenceIterator_NeverendingIgnoresRepeatCount(t *testing.T) {
+	var rc RepeaterConfiguration
+	if err := json.Unmarshal(rcEveryDayEndRepeat, &rc); err != nil {
+		t.Fatalf("Failed to deserialize repeater configuration: %v", err)
+	}
+	neverending := Timestamp(time.Date(4001, time.January, 1, 0, 0, 0, 0, time.UTC))
+	rc.LastScheduledAt = &neverending
+
+	it, err := rc.Iterator()
+	if err != nil {
+		t.Fatalf("Expected valid rule, but got %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		next, ok := it.Next()
+		if !ok {
+			t.Fatalf("Expected neverending rule to ignore its repeat count, but ended after %d occurrences", i)
+		}
+		if expected, _ := rc.NextScheduledAt(i); !next.Equal(expected) {
+			t.Fatalf("Expected %s for next %d date, but got %s", expected, i+1, next)
+		}
+	}
+}
+
+func TestOccurrenceIterator_WithoutAmplitude(t *testing.T) {
+	first := Timestamp(time.Date(2018, time.May, 1, 0, 0, 0, 0, time.UTC))
+	rc := RepeaterConfiguration{FirstScheduledAt: &first, FrequencyUnit: FrequencyUnitDaily}
+	if _, err := rc.Iterator(); !errors.Is(err, ErrInvalidRepeater) {
+		t.Fatalf("Expected %v, but got %v", ErrInvalidRepeater, err)
+	}
+
+	it := &OccurrenceIterator{c: rc, start: rc.firstScheduledDay()}
+	if next, ok := it.Next(); ok {
+		t.Fatalf("Expected iterator to end, but got %s", next)
+	}
+}
+
+func TestRepeaterConfiguration_Occurrences(t *testing.T) {
+	var rc RepeaterConfiguration
+	if err := json.Unmarshal(rcEveryWeekOnMondayAndTuesday, &rc); err != nil {
+		t.Fatalf("Failed to deserialize repeater configuration: %v", err)
+	}
+	from := time.Date(2018, time.May, 1, 0, 0, 0, 0, time.UTC)
+	occurrences, ended, err := rc.Occurrences(from, from.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("Expected valid rule, but got %v", err)
+	}
+	if ended {
+		t.Fatalf("Expected neverending rule to continue")
+	}
+	expected := []string{"2018-05-01", "2018-05-07", "2018-05-08", "2018-05-14", "2018-05-15", "2018-05-21", "2018-05-22", "2018-05-28", "2018-05-29"}
+	if len(occurrences) != len(expected) {
+		t.Fatalf("Expected %d occurrences, but got %v", len(expected), occurrences)
+	}
+	for i, occurrence := range occurrences {
+		if occurrence.Format("2006-01-02") != expected[i] {
+			t.Errorf("Expected %q for occurrence %d, but got %q", expected[i], i+1, occurrence.Format("2006-01-02"))
+		}
+	}
+
+	if err := json.Unmarshal(rcEveryWeekOnMondayEndRepeat, &rc); err != nil {
+		t.Fatalf("Failed to deserialize repeater configuration: %v", err)
+	}
+	from = time.Date(2018, time.March, 1, 0, 0, 0, 0, time.UTC)
+	occurrences, ended, _ = rc.Occurrences(from, from.AddDate(0, 1, 0))
+	if !ended || len(occurrences) != 2 {
+		t.Fatalf("Expected 2 occurrences and the rule to end, but got %v and %v", occurrences, ended)
+	}
+	occurrences, ended, _ = rc.Occurrences(from.AddDate(0, 1, 0), from.AddDate(0, 2, 0))
+	if !ended || len(occurrences) != 0 {
+		t.Fatalf("Expected no occurrences after the end, but got %v and %v", occurrences, ended)
+	}
+}
+
+func TestRepeaterConfiguration_OccurrencesIn(t *testing.T) {
+	var rc RepeaterConfiguration
+	if err := json.Unmarshal(rcEveryDay, &rc); err != nil {
+		t.Fatalf("Failed to deserialize repeater configuration: %v", err)
+	}
+	testCases := []struct {
+		Location string
+		From     Day
+		Expected []string
+	}{
+		{"Europe/Berlin", NewDay(2018, time.March, 24), []string{"2018-03-24", "2018-03-25", "2018-03-26"}},
+		{"Europe/Berlin", NewDay(2018, time.October, 27), []string{"2018-10-27", "2018-10-28", "2018-10-29"}},
+		{"America/Sao_Paulo", NewDay(2018, time.November, 3), []string{"2018-11-03", "2018-11-04", "2018-11-05"}},
+		{"Pacific/Auckland", NewDay(2018, time.September, 29), []string{"2018-09-29", "2018-09-30", "2018-10-01"}},
+	}
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%s %s", testCase.Location, testCase.From), func(t *testing.T) {
+			loc := mustLoadLocation(t, testCase.Location)
+			from := testCase.From.In(loc)
+			occurrences, ended, err := rc.OccurrencesIn(from, from.AddDate(0, 0, 3), loc)
+			if err != nil {
+				t.Fatalf("Expected valid rule, but got %v", err)
+			}
+			if ended {
+				t.Fatalf("Expected neverending rule to continue")
+			}
+			if len(occurrences) != len(testCase.Expected) {
+				t.Fatalf("Expected %d occurrences, but got %v", len(testCase.Expected), occurrences)
+			}
+			for i, occurrence := range occurrences {
+				if occurrence.Location() != loc || DayIn(occurrence, loc).String() != testCase.Expected[i] {
+					t.Errorf("Expected occurrence %d on %s in %s, but got %v", i+1, testCase.Expected[i], testCase.Location, occurrence)
+				}
+			}
+		})
+	}
+}
+
+func TestTask_Occurrences(t *testing.T) {
+	var rc RepeaterConfiguration
+	if err := json.Unmarshal(rcEveryWeekOnMonday, &rc); err != nil {
+		t.Fatalf("Failed to deserialize repeater configuration: %v", err)
+	}
+	loc := mustLoadLocation(t, "Europe/Berlin")
+	reminder := 9 * time.Hour
+	suppressed := time.Date(2018, time.March, 19, 0, 0, 0, 0, time.UTC)
+	deadline := NewDay(2017, time.September, 6)
+	template := &Task{
+		Repeater:                &rc,
+		DeadlineDate:            &deadline,
+		DeadlineOffset:          2,
+		DeadlineSuppressionDate: &suppressed,
+		AlarmTimeOffset:         &reminder,
+	}
+
+	from := time.Date(2018, time.March, 19, 0, 0, 0, 0, loc)
+	occurrences, ended, err := template.Occurrences(from, from.AddDate(0, 0, 14), loc)
+	if err != nil {
+		t.Fatalf("Expected valid rule, but got %v", err)
+	}
+	if ended || len(occurrences) != 2 {
+		t.Fatalf("Expected 2 occurrences, but got %v (ended %v)", occurrences, ended)
+	}
+	if occurrences[0].Deadline != nil {
+		t.Errorf("Expected deadline of suppressed occurrence to be dropped, but got %s", occurrences[0].Deadline)
+	}
+	if occurrences[1].Deadline == nil || occurrences[1].Deadline.String() != "2018-03-28" {
+		t.Errorf("Expected deadline 2 days after the start, but got %v", occurrences[1].Deadline)
+	}
+	for i, expected := range []time.Time{
+		time.Date(2018, time.March, 19, 8, 0, 0, 0, time.UTC),
+		time.Date(2018, time.March, 26, 7, 0, 0, 0, time.UTC),
+	} {
+		if occurrences[i].Reminder == nil || !occurrences[i].Reminder.Equal(expected) {
+			t.Errorf("Expected reminder at 9:00 in Berlin (%v), but got %v", expected, occurrences[i].Reminder)
+		}
+	}
+
+	template.DeadlineDate, template.AlarmTimeOffset = nil, nil
+	occurrences, _, _ = template.Occurrences(from, from.AddDate(0, 0, 14), loc)
+	if occurrences[1].Deadline != nil || occurrences[1].Reminder != nil {
+		t.Errorf("Expected occurrences without deadline and reminder, but got %+v", occurrences[1])
+	}
+
+	if occurrences, ended, _ := (&Task{}).Occurrences(from, from.AddDate(0, 0, 14), loc); len(occurrences) != 0 || !ended {
+		t.Errorf("Expected tasks without repeater to have no occurrences")
+	}
+}
@@ -0,0 +1,88 @@
+package thingscloud
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+type optionalState int
+
+const (
+	optionalUnset optionalState = iota
+	optionalNull
+	optionalValue
+)
+
+// Optional describes a nullable payload field. In contrast to a pointer it distinguishes
+// between a field which is not part of the payload, meaning unchanged, and a field explicitly
+// set to null, meaning cleared.
+// The zero value is unset.
+type Optional[T any] struct {
+	value T
+	state optionalState
+}
+
+// Some returns an Optional holding v
+func Some[T any](v T) Optional[T] {
+	return Optional[T]{value: v, state: optionalValue}
+}
+
+// Null returns an Optional which clears the field
+func Null[T any]() Optional[T] {
+	return Optional[T]{state: optionalNull}
+}
+
+// IsSet reports whether the field is part of the payload, either as value or as null
+func (o Optional[T]) IsSet() bool {
+	return o.state != optionalUnset
+}
+
+// IsNull reports whether the field is explicitly set to null
+func (o Optional[T]) IsNull() bool {
+	return o.state == optionalNull
+}
+
+// Get returns the value and whether one is present
+func (o Optional[T]) Get() (T, bool) {
+	return o.value, o.state == optionalValue
+}
+
+// Ptr returns a pointer to a copy of the value, or nil if no value is present
+func (o Optional[T]) Ptr() *T {
+	if o.state != optionalValue {
+		return nil
+	}
+	v := o.value
+	return &v
+}
+
+// isUnset is used to omit unset fields when marshalling payloads
+func (o Optional[T]) isUnset() bool {
+	return o.state == optionalUnset
+}
+
+// UnmarshalJSON distinguishes null from values
+func (o *Optional[T]) UnmarshalJSON(bs []byte) error {
+	if bytes.Equal(bytes.TrimSpace(bs), []byte("null")) {
+		*o = Null[T]()
+		return nil
+	}
+	var v T
+	if err := json.Unmarshal(bs, &v); err != nil {
+		return err
+	}
+	*o = Some(v)
+	return nil
+}
+
+// MarshalJSON encodes the value, or null. Unset fields are omitted by the payloads
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if o.state != optionalValue {
+		return []byte("null"), nil
+	}
+	return json.Marshal(&o.value)
+}
+
+type unsettable interface {
+	isUnset() bool
+}
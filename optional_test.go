@@ -0,0 +1,65 @@
+package thingscloud
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestOptional_UnmarshalJSON(t *testing.T) {
+	testCases := []struct {
+		JSON          string
+		ExpectedSet   bool
+		ExpectedNull  bool
+		ExpectedValue bool
+	}{
+		{`{}`, false, false, false},
+		{`{"dd":null}`, true, true, false},
+		{`{"dd":1495843200}`, true, false, true},
+	}
+	for _, testCase := range testCases {
+		var p TaskActionItemPayload
+		if err := json.Unmarshal([]byte(testCase.JSON), &p); err != nil {
+			t.Fatal(err.Error())
+		}
+		if p.DeadlineDate.IsSet() != testCase.ExpectedSet {
+			t.Errorf("%s: Expected IsSet to be %t", testCase.JSON, testCase.ExpectedSet)
+		}
+		if p.DeadlineDate.IsNull() != testCase.ExpectedNull {
+			t.Errorf("%s: Expected IsNull to be %t", testCase.JSON, testCase.ExpectedNull)
+		}
+		if _, ok := p.DeadlineDate.Get(); ok != testCase.ExpectedValue {
+			t.Errorf("%s: Expected value to be present: %t", testCase.JSON, testCase.ExpectedValue)
+		}
+	}
+}
+
+func TestOptional_MarshalJSON(t *testing.T) {
+	testCases := []struct {
+		Payload  TaskActionItemPayload
+		Expected string
+	}{
+		{TaskActionItemPayload{}, `{}`},
+		{TaskActionItemPayload{DeadlineDate: Null[Day]()}, `{"dd":null}`},
+		{TaskActionItemPayload{DeadlineDate: Some(NewDay(2017, time.May, 27))}, `{"dd":1495843200}`},
+		{TaskActionItemPayload{AlarmTimeOffset: Some(32400.0), Note: Null[Note]()}, `{"ato":32400,"nt":null}`},
+	}
+	for _, testCase := range testCases {
+		bs, err := json.Marshal(testCase.Payload)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if string(bs) != testCase.Expected {
+			t.Errorf("Expected %s, but got %s", testCase.Expected, string(bs))
+		}
+	}
+}
+
+func TestOptional_Ptr(t *testing.T) {
+	if Null[int]().Ptr() != nil {
+		t.Fatal("Expected null to have no value")
+	}
+	if v := Some(1).Ptr(); v == nil || *v != 1 {
+		t.Fatalf("Expected value 1, but got %v", v)
+	}
+}
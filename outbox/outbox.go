@@ -0,0 +1,326 @@
+// Package outbox implements a durable queue for writes to a things history.
+// Pending items are persisted on disk and applied optimistically to a local
+// state, so changes survive flaky connections and application restarts.
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	things "github.com/nicolai86/things-cloud-sdk"
+	"github.com/nicolai86/things-cloud-sdk/state"
+)
+
+// ErrNotSynced is returned by Enqueue if the server index of the history is unknown,
+// e.g. because the history was never synced
+var ErrNotSynced = errors.New("history has not been synced")
+
+// Entry is a pending write
+type Entry struct {
+	things.Item
+	// AncestorIndex is the server index the entry was based on when it was enqueued
+	AncestorIndex int       `json:"-"`
+	QueuedAt      time.Time `json:"-"`
+}
+
+// UUID returns the UUID of the modified object
+func (e Entry) UUID() string {
+	return e.Item.UUID
+}
+
+// Validate decodes the entry and validates it according to its kind
+func (e Entry) Validate() error {
+	return e.ValidateAgainst(nil)
+}
+
+// ValidateAgainst decodes the entry and validates it according to its kind, ensuring that all
+// referenced objects exist in refs. Entries of kinds unknown to the SDK can't be validated and are rejected
+func (e Entry) ValidateAgainst(refs things.References) error {
+	var (
+		v things.Validator
+		p interface{}
+	)
+	switch e.Kind {
+	case things.ItemKindTask:
+		item := &things.TaskActionItem{Item: e.Item}
+		v, p = item, &item.P
+	case things.ItemKindChecklistItem:
+		item := &things.CheckListActionItem{Item: e.Item}
+		v, p = item, &item.P
+	case things.ItemKindArea:
+		item := &things.AreaActionItem{Item: e.Item}
+		v, p = item, &item.P
+	case things.ItemKindTag:
+		item := &things.TagActionItem{Item: e.Item}
+		v, p = item, &item.P
+	case things.ItemKindSettings:
+		item := &things.SettingsActionItem{Item: e.Item}
+		v, p = item, &item.P
+	default:
+		return things.ValidationErrors{{UUID: e.UUID(), Kind: e.Kind, Field: "e", Reason: "is unknown"}}
+	}
+	if len(e.P) != 0 {
+		if err := json.Unmarshal(e.P, p); err != nil {
+			return err
+		}
+	}
+	return v.ValidateAgainst(refs)
+}
+
+type record struct {
+	UUID          string            `json:"uuid"`
+	Kind          things.ItemKind   `json:"e"`
+	Action        things.ItemAction `json:"t"`
+	P             json.RawMessage   `json:"p"`
+	AncestorIndex int               `json:"ancestor-index"`
+	QueuedAt      time.Time         `json:"queued-at"`
+}
+
+type file struct {
+	HistoryID string   `json:"history-key"`
+	Entries   []record `json:"entries"`
+}
+
+// Conflict describes a pending entry whose object was modified remotely after the entry was enqueued
+type Conflict struct {
+	Entry  Entry
+	Remote []things.Item
+}
+
+// Outbox stores pending writes on disk until they are flushed to the history.
+// Note that the outbox is not safe for concurrent use.
+type Outbox struct {
+	path    string
+	history *things.History
+	state   state.Store
+	entries []Entry
+
+	// OnConflict is invoked for every conflict detected during Flush.
+	// Returning false drops the pending entry instead of writing it.
+	// If nil, all conflicting entries are written.
+	OnConflict func(Conflict) bool
+}
+
+// Open loads the outbox stored at path, or creates a new one, and applies
+// all pending entries to the store.
+func Open(path string, history *things.History, store state.Store) (*Outbox, error) {
+	o := &Outbox{
+		path:    path,
+		history: history,
+		state:   store,
+		entries: []Entry{},
+	}
+
+	bs, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		var f file
+		if err := json.Unmarshal(bs, &f); err != nil {
+			return nil, err
+		}
+		for _, r := range f.Entries {
+			o.entries = append(o.entries, Entry{
+				Item: things.Item{
+					UUID:   r.UUID,
+					Kind:   r.Kind,
+					Action: r.Action,
+					P:      r.P,
+				},
+				AncestorIndex: r.AncestorIndex,
+				QueuedAt:      r.QueuedAt,
+			})
+		}
+	}
+
+	if err := o.apply(o.Pending()...); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Pending returns all entries which have not been written yet, in order
+func (o *Outbox) Pending() []things.Item {
+	items := make([]things.Item, len(o.entries))
+	for i, e := range o.entries {
+		items[i] = e.Item
+	}
+	return items
+}
+
+// Enqueue persists items and applies them to the local state.
+// The history must have been synced before, as the entries are based on its latest server index;
+// only remote changes after that index are reported as conflicts.
+func (o *Outbox) Enqueue(items ...things.Identifiable) error {
+	if o.history.LatestServerIndex == 0 && !o.history.IsEmpty {
+		return ErrNotSynced
+	}
+	entries := make([]Entry, 0, len(items))
+	for _, item := range items {
+		bs, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		var i things.Item
+		if err := json.Unmarshal(bs, &i); err != nil {
+			return err
+		}
+		i.UUID = item.UUID()
+		entries = append(entries, Entry{
+			Item:          i,
+			AncestorIndex: o.history.LatestServerIndex,
+			QueuedAt:      time.Now(),
+		})
+	}
+
+	o.entries = append(o.entries, entries...)
+	if err := o.save(); err != nil {
+		o.entries = o.entries[:len(o.entries)-len(entries)]
+		return err
+	}
+
+	for _, e := range entries {
+		if err := o.apply(e.Item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush fetches remote changes made since the pending entries were enqueued, reports conflicts
+// and writes all remaining entries in order. If a write fails, the failed entry and all following
+// entries stay in the outbox. Entries written by a previous, partially failed Flush are not reported
+// as conflicts of the remaining entries.
+func (o *Outbox) Flush() ([]Conflict, error) {
+	if len(o.entries) == 0 {
+		return nil, nil
+	}
+
+	remote, err := o.fetch()
+	if err != nil {
+		return nil, err
+	}
+	if err := o.apply(remote...); err != nil {
+		return nil, err
+	}
+
+	conflicts := []Conflict{}
+	entries := []Entry{}
+	for _, e := range o.entries {
+		c := Conflict{Entry: e}
+		for _, item := range remote {
+			if item.UUID == e.UUID() {
+				c.Remote = append(c.Remote, item)
+			}
+		}
+		if len(c.Remote) != 0 {
+			conflicts = append(conflicts, c)
+			if o.OnConflict != nil && !o.OnConflict(c) {
+				continue
+			}
+		}
+		entries = append(entries, e)
+	}
+	o.entries = entries
+	if err := o.save(); err != nil {
+		return conflicts, err
+	}
+
+	// re-apply local changes on top of remote changes to keep the optimistic view
+	if err := o.apply(o.Pending()...); err != nil {
+		return conflicts, err
+	}
+
+	for len(o.entries) > 0 {
+		if err := o.history.Write(o.entries[0]); err != nil {
+			return conflicts, err
+		}
+		o.entries = o.entries[1:]
+		// remote changes up to the write were checked above, so the next flush must not
+		// report the written entry as conflict of the remaining ones
+		for i := range o.entries {
+			o.entries[i].AncestorIndex = o.history.LatestServerIndex
+		}
+		if err := o.save(); err != nil {
+			return conflicts, err
+		}
+	}
+	return conflicts, nil
+}
+
+// apply updates the store with items without moving its last index, as the outbox
+// does not load every item of the history
+func (o *Outbox) apply(items ...things.Item) error {
+	return o.state.Apply(o.state.LastIndex(), items...)
+}
+
+// fetch loads all remote items since the oldest pending entry was enqueued
+func (o *Outbox) fetch() ([]things.Item, error) {
+	start := o.entries[0].AncestorIndex
+	for _, e := range o.entries {
+		if e.AncestorIndex < start {
+			start = e.AncestorIndex
+		}
+	}
+
+	o.history.LoadedServerIndex = start
+	items := []things.Item{}
+	for {
+		page, hasMoreItems, err := o.history.Items(things.ItemsOptions{StartIndex: o.history.LoadedServerIndex})
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+		if !hasMoreItems || len(page) == 0 {
+			break
+		}
+	}
+	return items, nil
+}
+
+// save atomically replaces the outbox file
+func (o *Outbox) save() error {
+	f := file{
+		HistoryID: o.history.ID,
+		Entries:   make([]record, len(o.entries)),
+	}
+	for i, e := range o.entries {
+		f.Entries[i] = record{
+			UUID:          e.UUID(),
+			Kind:          e.Kind,
+			Action:        e.Action,
+			P:             e.P,
+			AncestorIndex: e.AncestorIndex,
+			QueuedAt:      e.QueuedAt,
+		}
+	}
+	bs, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(o.path), filepath.Base(o.path))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), o.path)
+}
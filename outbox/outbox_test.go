@@ -0,0 +1,319 @@
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	things "github.com/nicolai86/things-cloud-sdk"
+	"github.com/nicolai86/things-cloud-sdk/state/memory"
+)
+
+const historyID = "33333abb-bfe4-4b03-a5c9-106d42220c72"
+
+type fakeHistory struct {
+	items   []map[string]things.Item
+	commits []map[string]json.RawMessage
+	offline bool
+	// commitLimit makes all commits beyond the limit fail, if set
+	commitLimit int
+}
+
+func (f *fakeHistory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.offline {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	switch r.URL.Path {
+	case fmt.Sprintf("/version/1/history/%s/items", historyID):
+		start, _ := strconv.Atoi(r.URL.Query().Get("start-index"))
+		items := []map[string]things.Item{}
+		if start < len(f.items) {
+			items = f.items[start:]
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"items":              items,
+			"current-item-index": len(f.items),
+		})
+	case fmt.Sprintf("/version/1/history/%s/commit", historyID):
+		if f.commitLimit != 0 && len(f.commits) >= f.commitLimit {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		bs, _ := ioutil.ReadAll(r.Body)
+		var commit map[string]json.RawMessage
+		json.Unmarshal(bs, &commit)
+		f.commits = append(f.commits, commit)
+		var items map[string]things.Item
+		json.Unmarshal(bs, &items)
+		f.items = append(f.items, items)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"server-head-index": len(f.items),
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTask(uuid, title string) things.TaskActionItem {
+	return things.TaskActionItem{
+		Item: things.Item{
+			UUID:   uuid,
+			Kind:   things.ItemKindTask,
+			Action: things.ItemActionCreated,
+		},
+		P: things.TaskActionItemPayload{
+			Title: things.String(title),
+		},
+	}
+}
+
+func remoteChange(uuid, title string) map[string]things.Item {
+	return map[string]things.Item{
+		uuid: {Kind: things.ItemKindTask, Action: things.ItemActionModified, P: json.RawMessage(fmt.Sprintf(`{"tt":%q}`, title))},
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	t.Run("requires a synced history", func(t *testing.T) {
+		t.Parallel()
+		fake := &fakeHistory{}
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		path := filepath.Join(t.TempDir(), "outbox.json")
+		c := things.New(server.URL, "martin@example.com", "")
+		h := &things.History{Client: c, ID: historyID}
+
+		o, err := Open(path, h, memory.NewState())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := o.Enqueue(newTask("A", "first")); err != ErrNotSynced {
+			t.Fatalf("Expected %v, but got %v", ErrNotSynced, err)
+		}
+		if err := h.Sync(); err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := o.Enqueue(newTask("A", "first")); err != nil {
+			t.Fatal(err.Error())
+		}
+	})
+
+	t.Run("survives restarts while offline", func(t *testing.T) {
+		t.Parallel()
+		fake := &fakeHistory{}
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		path := filepath.Join(t.TempDir(), "outbox.json")
+		c := things.New(server.URL, "martin@example.com", "")
+		h := &things.History{Client: c, ID: historyID}
+		if err := h.Sync(); err != nil {
+			t.Fatal(err.Error())
+		}
+		fake.offline = true
+
+		o, err := Open(path, h, memory.NewState())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := o.Enqueue(newTask("A", "first"), newTask("B", "second")); err != nil {
+			t.Fatal(err.Error())
+		}
+		if _, err := o.Flush(); err == nil {
+			t.Fatal("Expected flush to fail while offline, but didn't")
+		}
+
+		s := memory.NewState()
+		o, err = Open(path, h, s)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(o.Pending()) != 2 {
+			t.Fatalf("Expected %d pending entries, but got %d", 2, len(o.Pending()))
+		}
+		if s.Tasks["A"] == nil || s.Tasks["A"].Title != "first" {
+			t.Fatalf("Expected pending entries to be applied to the state")
+		}
+
+		fake.offline = false
+		if _, err := o.Flush(); err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(o.Pending()) != 0 {
+			t.Fatalf("Expected outbox to be empty, but got %d entries", len(o.Pending()))
+		}
+		if len(fake.commits) != 2 {
+			t.Fatalf("Expected %d commits, but got %d", 2, len(fake.commits))
+		}
+		if _, ok := fake.commits[0]["A"]; !ok {
+			t.Errorf("Expected entries to be written in order, but got %v", fake.commits)
+		}
+
+		o, err = Open(path, h, memory.NewState())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(o.Pending()) != 0 {
+			t.Fatalf("Expected persisted outbox to be empty, but got %d entries", len(o.Pending()))
+		}
+	})
+
+	t.Run("surfaces conflicts", func(t *testing.T) {
+		t.Parallel()
+		fake := &fakeHistory{}
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		path := filepath.Join(t.TempDir(), "outbox.json")
+		c := things.New(server.URL, "martin@example.com", "")
+		h := &things.History{Client: c, ID: historyID}
+		if err := h.Sync(); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		s := memory.NewState()
+		o, err := Open(path, h, s)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		o.OnConflict = func(c Conflict) bool {
+			return false
+		}
+		if err := o.Enqueue(newTask("A", "local"), newTask("B", "other")); err != nil {
+			t.Fatal(err.Error())
+		}
+		fake.items = append(fake.items, remoteChange("A", "remote"))
+		conflicts, err := o.Flush()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(conflicts) != 1 || conflicts[0].Entry.UUID() != "A" {
+			t.Fatalf("Expected a single conflict for %q, but got %v", "A", conflicts)
+		}
+		if len(fake.commits) != 1 {
+			t.Fatalf("Expected conflicting entry to be dropped, but got %d commits", len(fake.commits))
+		}
+		if s.Tasks["A"].Title != "remote" {
+			t.Errorf("Expected remote title, but got %q", s.Tasks["A"].Title)
+		}
+	})
+
+	t.Run("ignores changes before the ancestor index", func(t *testing.T) {
+		t.Parallel()
+		fake := &fakeHistory{
+			items: []map[string]things.Item{
+				remoteChange("A", "first"),
+				remoteChange("A", "second"),
+			},
+		}
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		path := filepath.Join(t.TempDir(), "outbox.json")
+		c := things.New(server.URL, "martin@example.com", "")
+		h := &things.History{Client: c, ID: historyID}
+		if err := h.Sync(); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		o, err := Open(path, h, memory.NewState())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		o.OnConflict = func(c Conflict) bool {
+			return false
+		}
+		if err := o.Enqueue(newTask("A", "local")); err != nil {
+			t.Fatal(err.Error())
+		}
+		conflicts, err := o.Flush()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(conflicts) != 0 {
+			t.Fatalf("Expected no conflicts, but got %v", conflicts)
+		}
+		if len(fake.commits) != 1 {
+			t.Fatalf("Expected entry to be written, but got %d commits", len(fake.commits))
+		}
+	})
+	t.Run("does not report own writes as conflicts", func(t *testing.T) {
+		t.Parallel()
+		fake := &fakeHistory{commitLimit: 1}
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		path := filepath.Join(t.TempDir(), "outbox.json")
+		c := things.New(server.URL, "martin@example.com", "")
+		h := &things.History{Client: c, ID: historyID}
+		if err := h.Sync(); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		o, err := Open(path, h, memory.NewState())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		modify := newTask("A", "second")
+		modify.Action = things.ItemActionModified
+		if err := o.Enqueue(newTask("A", "first"), modify); err != nil {
+			t.Fatal(err.Error())
+		}
+		if _, err := o.Flush(); err == nil {
+			t.Fatal("Expected second write to fail, but didn't")
+		}
+
+		fake.commitLimit = 0
+		conflicts, err := o.Flush()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(conflicts) != 0 {
+			t.Fatalf("Expected no conflicts, but got %v", conflicts)
+		}
+		if len(fake.commits) != 2 {
+			t.Fatalf("Expected %d commits, but got %d", 2, len(fake.commits))
+		}
+	})
+
+	t.Run("validates entries of strict histories", func(t *testing.T) {
+		t.Parallel()
+		fake := &fakeHistory{}
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		path := filepath.Join(t.TempDir(), "outbox.json")
+		c := things.New(server.URL, "martin@example.com", "")
+		h := &things.History{Client: c, ID: historyID, Strict: true}
+		if err := h.Sync(); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		o, err := Open(path, h, memory.NewState())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		today := newTask("A", "today")
+		today.P.Schedule = things.Schedule(things.TaskScheduleToday)
+		if err := o.Enqueue(today); err != nil {
+			t.Fatal(err.Error())
+		}
+		_, err = o.Flush()
+		if _, ok := err.(things.ValidationErrors); !ok {
+			t.Fatalf("Expected validation errors, but got %v", err)
+		}
+		if len(fake.commits) != 0 {
+			t.Fatalf("Expected invalid entry not to be written, but got %d commits", len(fake.commits))
+		}
+		if len(o.Pending()) != 1 {
+			t.Fatalf("Expected entry to stay in the outbox, but got %d entries", len(o.Pending()))
+		}
+	})
+}
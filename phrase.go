@@ -0,0 +1,630 @@
+package thingscloud
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// PhraseError describes why a recurrence phrase could not be parsed. Offset is the byte offset
+// of the offending word within Phrase, or its length if the phrase ended unexpectedly
+type PhraseError struct {
+	Phrase string
+	Offset int
+	Reason string
+}
+
+func (e *PhraseError) Error() string {
+	return fmt.Sprintf("%v: %q at offset %d: %s", ErrUnsupportedRule, e.Phrase, e.Offset, e.Reason)
+}
+
+// Unwrap allows errors.Is(err, ErrUnsupportedRule)
+func (e *PhraseError) Unwrap() error {
+	return ErrUnsupportedRule
+}
+
+type phraseWord struct {
+	text   string
+	offset int
+}
+
+// phraseParser is a recursive descent parser over the lower cased words of a phrase
+type phraseParser struct {
+	phrase string
+	words  []phraseWord
+	pos    int
+	start  Day
+
+	unit            FrequencyUnit
+	amplitude       int64
+	details         []RepeaterDetailConfiguration
+	months          []int64
+	explicit        bool
+	count           int64
+	until           *Day
+	afterCompletion bool
+	// completionAt is the offset of "after completion" within the phrase
+	completionAt int
+}
+
+var phraseNumbers = map[string]int64{
+	"one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+}
+
+var phraseOrdinals = map[string]int64{
+	"first": 1, "second": 2, "third": 3, "fourth": 4, "fifth": 5, "last": -1,
+}
+
+var phraseUnits = map[string]FrequencyUnit{
+	"day": FrequencyUnitDaily, "days": FrequencyUnitDaily,
+	"week": FrequencyUnitWeekly, "weeks": FrequencyUnitWeekly,
+	"month": FrequencyUnitMonthly, "months": FrequencyUnitMonthly,
+	"year": FrequencyUnitYearly, "years": FrequencyUnitYearly,
+}
+
+var phraseAdverbs = map[string]FrequencyUnit{
+	"daily":    FrequencyUnitDaily,
+	"weekly":   FrequencyUnitWeekly,
+	"monthly":  FrequencyUnitMonthly,
+	"yearly":   FrequencyUnitYearly,
+	"annually": FrequencyUnitYearly,
+}
+
+var phraseWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "tues": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+var phraseMonths = map[string]time.Month{"sept": time.September}
+
+func init() {
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		name := strings.ToLower(wd.String())
+		phraseWeekdays[name] = wd
+		phraseWeekdays[name+"s"] = wd
+	}
+	for m := time.January; m <= time.December; m++ {
+		name := strings.ToLower(m.String())
+		phraseMonths[name] = m
+		phraseMonths[name[:3]] = m
+	}
+}
+
+// ParseRecurrence converts an english phrase like "every 3 weeks on tue and thu until march" into a
+// configuration, starting on the day of start in its location. FirstScheduledAt is the first matching day.
+//
+// Supported are daily, weekly, monthly and yearly intervals ("every other week", "every 2 months"),
+// weekdays ("every weekday", "mondays and fridays"), days and weekdays of a month ("the 1st and 15th",
+// "the last friday of every 2 months"), days of a year ("every march 3rd", "the last day of february"),
+// ends ("until 2019-03-01", "for 5 times") and "after completion".
+// Ordinals followed by a unit or weekday are intervals: "every 2nd monday" repeats every other week,
+// "the 2nd monday of the month" monthly. Without explicit days, the rule repeats on the day of start.
+//
+// Things repeats on specific days or weekdays of a month only, so phrases like "the last weekday of the month"
+// or "the 1st weekend of the month" cannot be represented and are rejected.
+func ParseRecurrence(phrase string, start time.Time) (RepeaterConfiguration, error) {
+	p := &phraseParser{phrase: phrase, start: DayOf(start), amplitude: 1}
+	p.tokenize()
+	if err := p.parse(); err != nil {
+		return RepeaterConfiguration{}, err
+	}
+	return p.configuration()
+}
+
+func (p *phraseParser) tokenize() {
+	begin := -1
+	for i, r := range p.phrase + " " {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+			if begin == -1 {
+				begin = i
+			}
+			continue
+		}
+		if begin != -1 {
+			p.words = append(p.words, phraseWord{text: strings.ToLower(p.phrase[begin:i]), offset: begin})
+			begin = -1
+		}
+		if r == '&' {
+			p.words = append(p.words, phraseWord{text: "and", offset: i})
+		}
+	}
+}
+
+func (p *phraseParser) peekAt(n int) string {
+	if p.pos+n >= len(p.words) {
+		return ""
+	}
+	return p.words[p.pos+n].text
+}
+
+func (p *phraseParser) peek() string {
+	return p.peekAt(0)
+}
+
+func (p *phraseParser) done() bool {
+	return p.pos >= len(p.words)
+}
+
+// accept consumes the next word if it is one of words
+func (p *phraseParser) accept(words ...string) bool {
+	for _, w := range words {
+		if p.peek() == w {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+// fail reports an error at the current word
+func (p *phraseParser) fail(format string, args ...interface{}) error {
+	offset := len(p.phrase)
+	if !p.done() {
+		offset = p.words[p.pos].offset
+	}
+	return &PhraseError{Phrase: p.phrase, Offset: offset, Reason: fmt.Sprintf(format, args...)}
+}
+
+// failAt reports an error at the word at pos
+func (p *phraseParser) failAt(pos int, format string, args ...interface{}) error {
+	p.pos = pos
+	return p.fail(format, args...)
+}
+
+// number parses cardinal numbers, e.g. 3 or three
+func number(w string) (int64, bool) {
+	if n, ok := phraseNumbers[w]; ok {
+		return n, true
+	}
+	n, err := strconv.ParseInt(w, 10, 64)
+	return n, err == nil
+}
+
+// ordinal parses ordinal numbers, e.g. 3rd, third or last
+func ordinal(w string) (int64, bool) {
+	if n, ok := phraseOrdinals[w]; ok {
+		return n, true
+	}
+	for _, suffix := range []string{"st", "nd", "rd", "th"} {
+		if strings.HasSuffix(w, suffix) {
+			n, err := strconv.ParseInt(strings.TrimSuffix(w, suffix), 10, 64)
+			return n, err == nil && n > 0
+		}
+	}
+	return 0, false
+}
+
+func (p *phraseParser) parse() error {
+	p.accept("repeat", "repeats", "repeating")
+	p.accept("every", "each")
+	if p.done() {
+		return p.fail("missing frequency, e.g. \"every day\"")
+	}
+	if err := p.parseFrequency(); err != nil {
+		return err
+	}
+	for !p.done() {
+		switch w := p.peek(); {
+		case p.accept("until", "till", "through", "ending", "ends"):
+			if p.until != nil || p.count != 0 {
+				return p.failAt(p.pos-1, "the end of the rule is specified twice")
+			}
+			p.accept("on")
+			if err := p.parseUntil(); err != nil {
+				return err
+			}
+		case w == "for" || p.peekAt(1) == "times" || p.peekAt(1) == "occurrences":
+			if p.until != nil || p.count != 0 {
+				return p.fail("the end of the rule is specified twice")
+			}
+			p.accept("for")
+			if err := p.parseCount(); err != nil {
+				return err
+			}
+		case p.accept("after"):
+			p.completionAt = p.words[p.pos-1].offset
+			if !p.accept("completion", "completing", "done") {
+				return p.fail("expected \"completion\" after \"after\"")
+			}
+			p.afterCompletion = true
+		default:
+			return p.fail("unexpected %q, expected \"until\", \"for n times\" or \"after completion\"", w)
+		}
+	}
+	return nil
+}
+
+func (p *phraseParser) parseFrequency() error {
+	w := p.peek()
+	if unit, ok := phraseAdverbs[w]; ok {
+		p.pos++
+		p.unit = unit
+		return p.parseDetails()
+	}
+	if unit, ok := phraseUnits[w]; ok {
+		p.pos++
+		p.unit = unit
+		return p.parseDetails()
+	}
+	if w == "other" {
+		p.pos++
+		return p.parseInterval(2)
+	}
+	if n, ok := number(w); ok {
+		if _, isUnit := phraseUnits[p.peekAt(1)]; isUnit {
+			p.pos++
+			return p.parseInterval(n)
+		}
+	}
+	if n, ok := ordinal(w); ok && n > 1 && p.peekAt(2) != "of" && p.peekAt(2) != "in" {
+		// every 2nd week, every 3rd monday
+		_, isUnit := phraseUnits[p.peekAt(1)]
+		_, isWeekday := phraseWeekdays[p.peekAt(1)]
+		if isUnit || isWeekday {
+			p.pos++
+			return p.parseInterval(n)
+		}
+	}
+	if _, ok := phraseWeekdays[w]; ok || w == "weekday" || w == "weekdays" || w == "weekend" || w == "weekends" {
+		p.unit = FrequencyUnitWeekly
+		return p.parseWeekdays()
+	}
+	if _, ok := phraseMonths[w]; ok {
+		p.unit = FrequencyUnitYearly
+		return p.parseMonthDays()
+	}
+	if _, ok := ordinal(w); ok || w == "the" {
+		if err := p.parseDaysOfMonth(); err != nil {
+			return err
+		}
+		return p.parseOf()
+	}
+	return p.fail("unknown frequency %q, expected e.g. \"day\", \"2 weeks\", \"monday\" or \"1st\"", w)
+}
+
+// parseInterval parses the unit following an interval of n
+func (p *phraseParser) parseInterval(n int64) error {
+	if n < 1 {
+		return p.failAt(p.pos-1, "the interval must be positive")
+	}
+	p.amplitude = n
+	if _, ok := phraseWeekdays[p.peek()]; ok {
+		p.unit = FrequencyUnitWeekly
+		return p.parseWeekdays()
+	}
+	unit, ok := phraseUnits[p.peek()]
+	if !ok {
+		return p.fail("expected \"days\", \"weeks\", \"months\" or \"years\" after the interval")
+	}
+	p.pos++
+	p.unit = unit
+	return p.parseDetails()
+}
+
+// parseDetails parses the days a rule repeats on, following its unit
+func (p *phraseParser) parseDetails() error {
+	on := p.accept("on", "in")
+	switch p.unit {
+	case FrequencyUnitDaily:
+		if on {
+			return p.failAt(p.pos-1, "daily rules cannot be limited to specific days")
+		}
+	case FrequencyUnitWeekly:
+		_, ok := phraseWeekdays[p.peek()]
+		if ok || p.peek() == "weekday" || p.peek() == "weekdays" || p.peek() == "weekend" || p.peek() == "weekends" {
+			return p.parseWeekdays()
+		}
+		if on {
+			return p.fail("expected weekdays, e.g. \"on monday and friday\"")
+		}
+	case FrequencyUnitMonthly:
+		if _, ok := ordinal(p.peek()); ok || p.peek() == "the" {
+			return p.parseDaysOfMonth()
+		}
+		if on {
+			return p.fail("expected days of the month, e.g. \"on the 1st\" or \"on the last friday\"")
+		}
+	case FrequencyUnitYearly:
+		if _, ok := phraseMonths[p.peek()]; ok {
+			return p.parseMonthDays()
+		}
+		if _, ok := ordinal(p.peek()); ok || p.peek() == "the" {
+			if err := p.parseDaysOfMonth(); err != nil {
+				return err
+			}
+			if !p.accept("of", "in") {
+				return p.fail("expected the month, e.g. \"of march\"")
+			}
+			return p.parseMonths()
+		}
+		if on {
+			return p.fail("expected a day of the year, e.g. \"on march 3rd\"")
+		}
+	}
+	return nil
+}
+
+func (p *phraseParser) addWeekday(wd time.Weekday) {
+	for _, dc := range p.details {
+		if *dc.Weekday == wd {
+			return
+		}
+	}
+	p.explicit = true
+	p.details = append(p.details, RepeaterDetailConfiguration{Weekday: &wd})
+}
+
+// parseWeekdays parses a list of weekdays, e.g. "tue and thu"
+func (p *phraseParser) parseWeekdays() error {
+	for {
+		w := p.peek()
+		switch {
+		case w == "weekday" || w == "weekdays":
+			for wd := time.Monday; wd <= time.Friday; wd++ {
+				p.addWeekday(wd)
+			}
+		case w == "weekend" || w == "weekends":
+			p.addWeekday(time.Saturday)
+			p.addWeekday(time.Sunday)
+		default:
+			wd, ok := phraseWeekdays[w]
+			if !ok {
+				return p.fail("expected a weekday, got %q", w)
+			}
+			p.addWeekday(wd)
+		}
+		p.pos++
+		if p.accept("of", "in") {
+			return p.failAt(p.pos-1, "weekdays of a month require an ordinal, e.g. \"the 2nd monday of the month\"")
+		}
+		if !p.accept("and", "or") {
+			if _, ok := phraseWeekdays[p.peek()]; !ok {
+				return nil
+			}
+		}
+	}
+}
+
+// parseDaysOfMonth parses a list of days within a month, e.g. "the 1st and the last friday"
+func (p *phraseParser) parseDaysOfMonth() error {
+	for {
+		p.accept("the")
+		pos := p.pos
+		n, ok := ordinal(p.peek())
+		if !ok {
+			return p.fail("expected a day of the month, e.g. \"1st\" or \"last\", got %q", p.peek())
+		}
+		p.pos++
+		w := p.peek()
+		switch wd, isWeekday := phraseWeekdays[w]; {
+		case isWeekday:
+			p.pos++
+			if n > 5 {
+				return p.failAt(pos, "only the 1st to 5th and the last weekday of a month are supported")
+			}
+			p.details = append(p.details, RepeaterDetailConfiguration{Weekday: &wd, MonthOf: &n})
+		case w == "weekday" || w == "weekdays" || w == "weekend":
+			return p.fail("things repeats on a specific weekday of the month, e.g. \"the %s friday\"", p.words[pos].text)
+		default:
+			if w == "day" {
+				p.pos++
+			}
+			if n > 31 {
+				return p.failAt(pos, "only days 1 to 31 and the last day of a month are supported")
+			}
+			dy := n - 1
+			if n == -1 {
+				dy = -1
+			}
+			p.details = append(p.details, RepeaterDetailConfiguration{Day: &dy})
+		}
+		p.explicit = true
+		if !p.accept("and") {
+			if _, ok := ordinal(p.peek()); !ok && p.peek() != "the" {
+				return nil
+			}
+		}
+	}
+}
+
+// parseOf parses which months days of a month repeat in: "of the month", "of every 2 months" or "of march"
+func (p *phraseParser) parseOf() error {
+	p.unit = FrequencyUnitMonthly
+	if !p.accept("of", "in") {
+		return nil
+	}
+	if _, ok := phraseMonths[p.peek()]; ok {
+		p.unit = FrequencyUnitYearly
+		return p.parseMonths()
+	}
+	p.accept("the", "each", "a")
+	if p.accept("every") {
+		if p.accept("other") {
+			p.amplitude = 2
+		} else if n, ok := number(p.peek()); ok {
+			if n < 1 {
+				return p.fail("the interval must be positive")
+			}
+			p.pos++
+			p.amplitude = n
+		}
+	}
+	if !p.accept("month", "months") {
+		return p.fail("expected \"the month\", \"every n months\" or a month, got %q", p.peek())
+	}
+	return nil
+}
+
+// parseMonths parses a list of months, e.g. "march and september"
+func (p *phraseParser) parseMonths() error {
+	for {
+		m, ok := phraseMonths[p.peek()]
+		if !ok {
+			return p.fail("expected a month, got %q", p.peek())
+		}
+		p.pos++
+		p.months = append(p.months, int64(m-1))
+		if !p.accept("and") {
+			if _, ok := phraseMonths[p.peek()]; !ok {
+				return nil
+			}
+		}
+	}
+}
+
+// parseMonthDays parses a list of days of the year, e.g. "march 3rd and september 1st"
+func (p *phraseParser) parseMonthDays() error {
+	for {
+		m := phraseMonths[p.peek()]
+		p.pos++
+		p.accept("the")
+		pos := p.pos
+		n, ok := ordinal(p.peek())
+		if !ok {
+			n, ok = number(p.peek())
+		}
+		if !ok {
+			return p.fail("expected a day of %s, e.g. \"%s 1st\"", m, strings.ToLower(m.String()))
+		}
+		p.pos++
+		if n == -1 {
+			p.accept("day")
+		} else if n < 1 || n > 31 {
+			return p.failAt(pos, "only days 1 to 31 and the last day of a month are supported")
+		} else {
+			n--
+		}
+		mo := int64(m - 1)
+		p.details = append(p.details, RepeaterDetailConfiguration{Day: &n, Month: &mo})
+		p.explicit = true
+		if !p.accept("and") {
+			if _, ok := phraseMonths[p.peek()]; !ok {
+				return nil
+			}
+		} else if _, ok := phraseMonths[p.peek()]; !ok {
+			return p.fail("expected a month, got %q", p.peek())
+		}
+	}
+}
+
+// parseCount parses the number of occurrences, e.g. "5 times"
+func (p *phraseParser) parseCount() error {
+	n, ok := number(p.peek())
+	if !ok || n < 1 {
+		return p.fail("expected a positive number of occurrences, got %q", p.peek())
+	}
+	p.pos++
+	if !p.accept("times", "time", "occurrences", "occurrence") {
+		return p.fail("expected \"times\" after the number of occurrences")
+	}
+	p.count = n
+	return nil
+}
+
+// parseUntil parses the last day of the rule: 2019-03-01, march, march 3rd or march 3 2019.
+// Without year the next such day is used, without day the first day of the month
+func (p *phraseParser) parseUntil() error {
+	if t, err := time.Parse("2006-01-02", p.peek()); err == nil {
+		p.pos++
+		day := DayOf(t)
+		p.until = &day
+		return nil
+	}
+	m, ok := phraseMonths[p.peek()]
+	if !ok {
+		return p.fail("expected an end date like \"2019-03-01\" or \"march 3rd\", got %q", p.peek())
+	}
+	p.pos++
+	d, year := int64(1), int64(0)
+	if n, ok := ordinal(p.peek()); ok && n > 0 {
+		d = n
+		p.pos++
+	} else if n, ok := number(p.peek()); ok && n >= 1 && n <= 31 {
+		d = n
+		p.pos++
+	}
+	if n, ok := number(p.peek()); ok && n > 31 {
+		year = n
+		p.pos++
+	}
+	day := NewDay(int(year), m, int(d))
+	if year == 0 {
+		day = NewDay(p.start.Year, m, int(d))
+		if day.Before(p.start) {
+			day = NewDay(p.start.Year+1, m, int(d))
+		}
+	}
+	if day.Month != m {
+		return p.failAt(p.pos-1, "%s has no day %d", m, d)
+	}
+	p.until = &day
+	return nil
+}
+
+// configuration validates the parsed phrase and converts it into a configuration
+func (p *phraseParser) configuration() (RepeaterConfiguration, error) {
+	if p.afterCompletion && p.explicit {
+		return RepeaterConfiguration{}, &PhraseError{Phrase: p.phrase, Offset: p.completionAt, Reason: "rules repeating after completion cannot be limited to specific days"}
+	}
+	details := p.details
+	if len(p.months) > 0 {
+		details = []RepeaterDetailConfiguration{}
+		for _, mo := range p.months {
+			mo := mo
+			for _, dc := range p.details {
+				dc.Month = &mo
+				details = append(details, dc)
+			}
+		}
+	}
+	if len(details) == 0 {
+		// repeat on the day of start
+		switch p.unit {
+		case FrequencyUnitDaily:
+			var dy int64
+			details = append(details, RepeaterDetailConfiguration{Day: &dy})
+		case FrequencyUnitWeekly:
+			wd := p.start.Weekday()
+			details = append(details, RepeaterDetailConfiguration{Weekday: &wd})
+		case FrequencyUnitMonthly:
+			dy := int64(p.start.Day - 1)
+			details = append(details, RepeaterDetailConfiguration{Day: &dy})
+		case FrequencyUnitYearly:
+			dy, mo := int64(p.start.Day-1), int64(p.start.Month-1)
+			details = append(details, RepeaterDetailConfiguration{Day: &dy, Month: &mo})
+		}
+	}
+
+	c := RepeaterConfiguration{
+		FrequencyUnit:       p.unit,
+		FrequencyAmplitude:  p.amplitude,
+		DetailConfiguration: details,
+	}
+	if p.afterCompletion {
+		c.Mode = RepeatModeAfterCompletion
+	}
+	rc := p.count
+	c.RepeatCount = &rc
+	if p.until != nil {
+		c.LastScheduledAt = Time(p.until.Time())
+	} else if p.count == 0 {
+		c.LastScheduledAt = Time(neverending)
+	}
+
+	first := p.start
+	if !c.IsAfterCompletion() {
+		t, err := c.ComputeFirstScheduledAt(p.start.Time())
+		if err != nil {
+			return RepeaterConfiguration{}, err
+		}
+		first = DayOf(t)
+	}
+	if p.until != nil && first.After(*p.until) {
+		return RepeaterConfiguration{}, &PhraseError{Phrase: p.phrase, Offset: len(p.phrase), Reason: fmt.Sprintf("the rule ends on %s before its first occurrence on %s", p.until, first)}
+	}
+	c.FirstScheduledAt = Time(first.Time())
+	return c, nil
+}
@@ -0,0 +1,113 @@
+package thingscloud
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	// a wednesday
+	start := time.Date(2018, time.May, 9, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		Phrase           string
+		ExpectedRule     string
+		FirstScheduledAt string
+	}{
+		{"every day", "FREQ=DAILY", "2018-05-09"},
+		{"Every other day", "FREQ=DAILY;INTERVAL=2", "2018-05-09"},
+		{"daily for 5 times", "FREQ=DAILY;COUNT=5", "2018-05-09"},
+		{"every week", "FREQ=WEEKLY;BYDAY=WE", "2018-05-09"},
+		{"every 3 weeks on Tue and Thu until March", "FREQ=WEEKLY;INTERVAL=3;BYDAY=TU,TH;UNTIL=20190301", "2018-05-10"},
+		{"every 2nd Monday", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO", "2018-05-14"},
+		{"every weekday", "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR", "2018-05-09"},
+		{"mondays & fridays", "FREQ=WEEKLY;BYDAY=MO,FR", "2018-05-11"},
+		{"every two weeks until 2018-06-30", "FREQ=WEEKLY;INTERVAL=2;BYDAY=WE;UNTIL=20180630", "2018-05-09"},
+		{"every month on the 1st and 15th", "FREQ=MONTHLY;BYMONTHDAY=1,15", "2018-05-15"},
+		{"monthly", "FREQ=MONTHLY;BYMONTHDAY=9", "2018-05-09"},
+		{"the last friday of every 2 months", "FREQ=MONTHLY;INTERVAL=2;BYDAY=-1FR", "2018-05-25"},
+		{"every 2nd monday of the month", "FREQ=MONTHLY;BYDAY=2MO", "2018-05-14"},
+		{"every first monday of the month", "FREQ=MONTHLY;BYDAY=1MO", "2018-06-04"},
+		{"every last day of february", "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=-1", "2019-02-28"},
+		{"every 1st of january and july", "FREQ=YEARLY;BYMONTH=1,7;BYMONTHDAY=1", "2018-07-01"},
+		{"every March 3rd", "FREQ=YEARLY;BYMONTH=3;BYMONTHDAY=3", "2019-03-03"},
+		{"every year", "FREQ=YEARLY;BYMONTH=5;BYMONTHDAY=9", "2018-05-09"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Phrase, func(t *testing.T) {
+			rc, err := ParseRecurrence(testCase.Phrase, start)
+			if err != nil {
+				t.Fatalf("Expected phrase to be parsed, but got %v", err)
+			}
+			rule, err := rc.ToRRULE()
+			if err != nil {
+				t.Fatalf("Expected rule, but got %v", err)
+			}
+			if rule != testCase.ExpectedRule {
+				t.Errorf("Expected %q, but got %q", testCase.ExpectedRule, rule)
+			}
+			if first := rc.FirstScheduledAt.Time().Format("2006-01-02"); first != testCase.FirstScheduledAt {
+				t.Errorf("Expected first occurrence on %s, but got %s", testCase.FirstScheduledAt, first)
+			}
+		})
+	}
+}
+
+func TestParseRecurrenceAfterCompletion(t *testing.T) {
+	start := time.Date(2018, time.February, 28, 0, 0, 0, 0, time.UTC)
+	rc, err := ParseRecurrence("every 3 days after completion", start)
+	if err != nil {
+		t.Fatalf("Expected phrase to be parsed, but got %v", err)
+	}
+	var expected RepeaterConfiguration
+	if err := expected.UnmarshalJSON(rcEvery3DaysAfterCompletion); err != nil {
+		t.Fatal(err.Error())
+	}
+	for i := 0; i < 3; i++ {
+		next, err := rc.NextScheduledAt(i)
+		if err != nil {
+			t.Fatalf("Expected valid rule, but got %v", err)
+		}
+		if expectedNext, _ := expected.NextScheduledAt(i); !next.Equal(expectedNext) {
+			t.Errorf("Expected %v for next %d date, but got %v", expectedNext, i+1, next)
+		}
+	}
+	if !rc.IsAfterCompletion() {
+		t.Errorf("Expected rule to repeat after completion")
+	}
+}
+
+func TestParseRecurrenceErrors(t *testing.T) {
+	start := time.Date(2018, time.May, 9, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		Phrase         string
+		ExpectedOffset int
+	}{
+		{"", 0},
+		{"every fortnight", 6},
+		{"last weekday of the month", 5},
+		{"every 6th monday of the month", 6},
+		{"every day on monday", 10},
+		{"every monday for 0 times", 17},
+		{"every week on monday after completion", 21},
+		{"every day until feb 30", 20},
+		{"every day until 2018-01-01", 26},
+		{"every week until march 1st for 3 times", 27},
+		{"every week at noon", 11},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Phrase, func(t *testing.T) {
+			_, err := ParseRecurrence(testCase.Phrase, start)
+			if !errors.Is(err, ErrUnsupportedRule) {
+				t.Fatalf("Expected unsupported rule, but got %v", err)
+			}
+			var phraseErr *PhraseError
+			if !errors.As(err, &phraseErr) {
+				t.Fatalf("Expected phrase error, but got %T", err)
+			}
+			if phraseErr.Offset != testCase.ExpectedOffset {
+				t.Errorf("Expected error at offset %d, but got %v", testCase.ExpectedOffset, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package thingscloud
+
+import "time"
+
+// reminderAt returns the time of a reminder offset from the start of day in loc.
+// The offset describes the wall clock time, so reminders keep their time of day across DST changes
+func reminderAt(day Day, offset time.Duration, loc *time.Location) time.Time {
+	return time.Date(day.Year, day.Month, day.Day, 0, 0, int(offset/time.Second), 0, loc)
+}
+
+// reminderOffset returns the wall clock time of t as offset from the start of its day
+func reminderOffset(t time.Time) time.Duration {
+	h, m, s := t.Clock()
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+}
+
+// Reminder returns when the reminder of the task fires in loc, e.g. the time zone of the user.
+// Reminders are relative to the start date, so tasks without start date have no reminder
+func (t *Task) Reminder(loc *time.Location) (time.Time, bool) {
+	if t.AlarmTimeOffset == nil || t.ScheduledDate == nil {
+		return time.Time{}, false
+	}
+	return reminderAt(*t.ScheduledDate, *t.AlarmTimeOffset, loc), true
+}
@@ -0,0 +1,78 @@
+package thingscloud
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTask_Reminder(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	offset := 9 * time.Hour
+
+	testCases := []struct {
+		Name     string
+		Task     Task
+		Expected time.Time
+		OK       bool
+	}{
+		{"without reminder", Task{ScheduledDate: &Day{2017, time.May, 27}}, time.Time{}, false},
+		{"without start date", Task{AlarmTimeOffset: &offset}, time.Time{}, false},
+		{"regular day", Task{ScheduledDate: &Day{2017, time.May, 27}, AlarmTimeOffset: &offset}, time.Date(2017, time.May, 27, 9, 0, 0, 0, berlin), true},
+		{"DST change", Task{ScheduledDate: &Day{2017, time.March, 26}, AlarmTimeOffset: &offset}, time.Date(2017, time.March, 26, 9, 0, 0, 0, berlin), true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			at, ok := testCase.Task.Reminder(berlin)
+			if ok != testCase.OK || !at.Equal(testCase.Expected) {
+				t.Fatalf("Expected reminder at %v (%v) but got %v (%v)", testCase.Expected, testCase.OK, at, ok)
+			}
+			if ok && at.Hour() != 9 {
+				t.Fatalf("Expected reminder to keep its wall clock time, but got %v", at)
+			}
+		})
+	}
+}
+
+func TestTaskBuilder_RemindAt(t *testing.T) {
+	defer withNow(time.Date(2017, time.May, 24, 22, 5, 17, 0, time.UTC))()
+
+	losAngeles := mustLoadLocation(t, "America/Los_Angeles")
+	item := EditTask("A").RemindAt(time.Date(2017, time.May, 27, 18, 30, 0, 0, losAngeles)).Build()
+	bs, err := json.Marshal(item.P)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := `{"md":1495663517,"sr":1495843200,"tir":1495843200,"ato":66600,"lai":null}`
+	if !jsonEqual(bs, []byte(expected)) {
+		t.Fatalf("Expected payload %s, but got %s", expected, string(bs))
+	}
+
+	bs, err = json.Marshal(EditTask("A").WithoutReminder().Build().P)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected = `{"md":1495663517,"ato":null,"lai":null}`
+	if !jsonEqual(bs, []byte(expected)) {
+		t.Fatalf("Expected payload %s, but got %s", expected, string(bs))
+	}
+}
+
+func TestTaskActionItem_ValidateReminder(t *testing.T) {
+	item := NewTask("a").RemindAt(time.Now()).Build()
+	if err := item.Validate(); err != nil {
+		t.Fatalf("Expected reminder to be valid, but got %v", err)
+	}
+
+	item = NewTask("a").Build()
+	item.P.AlarmTimeOffset = Some(float64(3600))
+	if fields := validationFields(item.Validate()); len(fields) != 1 || fields[0] != "ato" {
+		t.Fatalf("Expected reminder without start date to be rejected, but got %v", fields)
+	}
+
+	item = NewTask("a").ScheduledFor(time.Now()).Build()
+	item.P.AlarmTimeOffset = Some((25 * time.Hour).Seconds())
+	if fields := validationFields(item.Validate()); len(fields) != 1 || fields[0] != "ato" {
+		t.Fatalf("Expected reminder outside of the day to be rejected, but got %v", fields)
+	}
+}
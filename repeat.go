@@ -1,6 +1,11 @@
 package thingscloud
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
 // FrequencyUnit describes recurring frequencies
 type FrequencyUnit int64
@@ -16,22 +21,150 @@ var (
 	FrequencyUnitYearly FrequencyUnit = 4
 )
 
+// RepeatMode describes how the occurrences of a recurring rule are scheduled
+type RepeatMode int64
+
+const (
+	// RepeatModeFixedSchedule repeats on the dates described by the rule
+	RepeatModeFixedSchedule RepeatMode = 0
+	// RepeatModeAfterCompletion schedules the next occurrence relative to the completion of the previous one
+	RepeatModeAfterCompletion RepeatMode = 1
+)
+
 // RepeaterDetailConfiguration configures specifics of a repeater configuration.
 type RepeaterDetailConfiguration struct {
 	Day     *int64        `json:"dy,omitempty"`
 	Month   *int64        `json:"mo,omitempty"`
 	Weekday *time.Weekday `json:"wd,omitempty"`
 	MonthOf *int64        `json:"wdo,omitempty"`
+	Extras  Extras        `json:"-"`
 }
 
 // RepeaterConfiguration configures the recurring rules of a task/ project
 type RepeaterConfiguration struct {
 	FirstScheduledAt    *Timestamp                    `json:"ia,omitempty"`
 	RepeatCount         *int64                        `json:"rc,omitempty"`
+	Mode                RepeatMode                    `json:"tp"`
 	FrequencyUnit       FrequencyUnit                 `json:"fu"`
 	FrequencyAmplitude  int64                         `json:"fa"`
 	DetailConfiguration []RepeaterDetailConfiguration `json:"of"`
 	LastScheduledAt     *Timestamp                    `json:"ed,omitempty"`
+	Extras              Extras                        `json:"-"`
+}
+
+// ErrInvalidRepeater is returned for malformed repeater configurations, e.g. weekly rules without weekday
+var ErrInvalidRepeater = errors.New("invalid repeater configuration")
+
+func invalidRepeater(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidRepeater, fmt.Sprintf(format, args...))
+}
+
+// validate checks that the detail configuration describes a day of the given frequency unit
+func (dc RepeaterDetailConfiguration) validate(unit FrequencyUnit) error {
+	if dc.Weekday != nil && (*dc.Weekday < time.Sunday || *dc.Weekday > time.Saturday) {
+		return fmt.Errorf("unknown weekday %d", *dc.Weekday)
+	}
+	if unit == FrequencyUnitWeekly {
+		if dc.Weekday == nil {
+			return errors.New("weekly rules require a weekday")
+		}
+		return nil
+	}
+	if unit == FrequencyUnitYearly {
+		if dc.Month == nil {
+			return errors.New("yearly rules require a month")
+		}
+		if *dc.Month < 0 || *dc.Month > 11 {
+			return fmt.Errorf("unknown month %d", *dc.Month)
+		}
+	}
+	switch {
+	case dc.Weekday != nil:
+		if dc.MonthOf == nil {
+			return errors.New("weekdays require the week of the month")
+		}
+		if *dc.MonthOf == 0 || *dc.MonthOf < -1 || *dc.MonthOf > 5 {
+			return fmt.Errorf("unknown week of the month %d", *dc.MonthOf)
+		}
+	case dc.MonthOf != nil:
+		return errors.New("the week of the month requires a weekday")
+	case dc.Day == nil:
+		return errors.New("requires a day or weekday")
+	case *dc.Day < -1 || *dc.Day > 30:
+		return fmt.Errorf("unknown day %d", *dc.Day)
+	}
+	return nil
+}
+
+// validatePattern checks the fields required to compute the days of the rule. FirstScheduledAt is not required
+func (c RepeaterConfiguration) validatePattern() error {
+	switch c.Mode {
+	case RepeatModeFixedSchedule, RepeatModeAfterCompletion:
+	default:
+		return invalidRepeater("unknown mode %d", c.Mode)
+	}
+	if _, ok := rruleFrequencies[c.FrequencyUnit]; !ok {
+		return invalidRepeater("unknown frequency unit %d", c.FrequencyUnit)
+	}
+	if c.FrequencyAmplitude < 1 {
+		return invalidRepeater("frequency amplitude %d must be positive", c.FrequencyAmplitude)
+	}
+	if c.RepeatCount != nil && *c.RepeatCount < 0 {
+		return invalidRepeater("repeat count %d must not be negative", *c.RepeatCount)
+	}
+	// daily and after completion rules ignore their details
+	if c.FrequencyUnit == FrequencyUnitDaily || c.IsAfterCompletion() {
+		return nil
+	}
+	if len(c.DetailConfiguration) == 0 {
+		return invalidRepeater("%s rules require details", strings.ToLower(rruleFrequencies[c.FrequencyUnit]))
+	}
+	for i, dc := range c.DetailConfiguration {
+		if err := dc.validate(c.FrequencyUnit); err != nil {
+			return invalidRepeater("detail %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Validate reports malformed rules, which cannot be scheduled. Per thingscloud convention FirstScheduledAt
+// has to be the first day matching the pattern of rules on a fixed schedule, see Normalize
+func (c RepeaterConfiguration) Validate() error {
+	if err := c.validatePattern(); err != nil {
+		return err
+	}
+	if c.FirstScheduledAt == nil {
+		return invalidRepeater("first scheduled date is missing")
+	}
+	if c.FrequencyUnit == FrequencyUnitDaily || c.IsAfterCompletion() {
+		return nil
+	}
+	ia := c.firstScheduledDay()
+	if first := c.computeFirstScheduledAt(ia); first != ia {
+		return invalidRepeater("first scheduled date %s does not match the rule, which first occurs on %s", ia, first)
+	}
+	return nil
+}
+
+// Normalize moves FirstScheduledAt to the first day matching the pattern on or after it, so that the rule
+// passes Validate. Malformed rules are left untouched
+func (c *RepeaterConfiguration) Normalize() error {
+	if err := c.validatePattern(); err != nil {
+		return err
+	}
+	if c.FirstScheduledAt == nil {
+		return invalidRepeater("first scheduled date is missing")
+	}
+	c.FirstScheduledAt = Time(stamp(c.computeFirstScheduledAt(c.firstScheduledDay())))
+	return nil
+}
+
+// repeatCount returns the number of occurrences of the rule, 0 for rules without limit
+func (c RepeaterConfiguration) repeatCount() int {
+	if c.RepeatCount == nil {
+		return 0
+	}
+	return int(*c.RepeatCount)
 }
 
 // IsNeverending determines if a recurring rule has a specific end
@@ -39,12 +172,95 @@ func (c RepeaterConfiguration) IsNeverending() bool {
 	return c.LastScheduledAt != nil && c.LastScheduledAt.Time().Year() == 4001
 }
 
-func (c RepeaterConfiguration) nextScheduledAt(repeat int, dcF func(time.Time, RepeaterDetailConfiguration) time.Time, aF func(time.Time) time.Time) time.Time {
-	ia := *c.FirstScheduledAt.Time()
+// IsAfterCompletion determines if occurrences are scheduled relative to the completion of the previous one
+func (c RepeaterConfiguration) IsAfterCompletion() bool {
+	return c.Mode == RepeatModeAfterCompletion
+}
+
+// addInterval moves d by n times the frequency of the rule
+func (c RepeaterConfiguration) addInterval(d Day, n int) Day {
+	amplitude := int(c.FrequencyAmplitude) * n
+	switch c.FrequencyUnit {
+	case FrequencyUnitDaily:
+		return d.AddDays(amplitude)
+	case FrequencyUnitWeekly:
+		return d.AddDays(amplitude * 7)
+	case FrequencyUnitMonthly:
+		return d.AddDate(0, amplitude, 0)
+	case FrequencyUnitYearly:
+		return d.AddDate(amplitude, 0, 0)
+	}
+	return Day{}
+}
+
+// firstScheduledDay returns FirstScheduledAt as calendar day
+func (c RepeaterConfiguration) firstScheduledDay() Day {
+	return DayOf(c.FirstScheduledAt.Time().UTC())
+}
+
+// lastScheduledDay returns LastScheduledAt as calendar day
+func (c RepeaterConfiguration) lastScheduledDay() Day {
+	return DayOf(c.LastScheduledAt.Time().UTC())
+}
 
-	if !c.IsNeverending() && *c.RepeatCount > 0 {
-		if repeat >= int(*c.RepeatCount) {
-			return time.Time{}
+// stamp converts a day into the midnight UTC time things stores, keeping the zero value
+func stamp(d Day) time.Time {
+	if d.IsZero() {
+		return time.Time{}
+	}
+	return d.Time()
+}
+
+// nextAfterCompletionScheduledAt assumes every occurrence is completed on the day it is scheduled
+func (c RepeaterConfiguration) nextAfterCompletionScheduledAt(repeat int) Day {
+	nt := c.addInterval(c.firstScheduledDay(), repeat)
+	if c.IsNeverending() {
+		return nt
+	}
+	if c.LastScheduledAt != nil && nt.After(c.lastScheduledDay()) {
+		return Day{}
+	}
+	if count := c.repeatCount(); count > 0 && repeat >= count {
+		return Day{}
+	}
+	return nt
+}
+
+// NextScheduledAtAfterCompletion returns the date the next occurrence of an after completion rule
+// is scheduled for, when the previous occurrence was completed at completedAt. repeat is the number
+// of occurrences scheduled so far, so rules ending after RepeatCount occurrences return the zero time
+// once repeat reaches the count.
+//
+// Things stores the completion date as AfterCompletionReferenceDate (acrd) on the repeating task, and
+// the resulting date as InstanceCreationStartDate (icsd). This reading is derived from template payloads
+// where icsd equals acrd plus the interval of the rule; it has not been confirmed by the things apps.
+// Rules on a fixed schedule do not depend on completions and return the zero time.
+func (c RepeaterConfiguration) NextScheduledAtAfterCompletion(completedAt time.Time, repeat int) time.Time {
+	return c.NextScheduledAtAfterCompletionIn(completedAt, repeat, completedAt.Location())
+}
+
+// NextScheduledAtAfterCompletionIn is like NextScheduledAtAfterCompletion, but uses the day of completedAt in loc,
+// e.g. the time zone of the user. The result is a day stamp, midnight UTC
+func (c RepeaterConfiguration) NextScheduledAtAfterCompletionIn(completedAt time.Time, repeat int, loc *time.Location) time.Time {
+	if !c.IsAfterCompletion() {
+		return time.Time{}
+	}
+	if count := c.repeatCount(); count > 0 && repeat >= count {
+		return time.Time{}
+	}
+	nt := c.addInterval(DayIn(completedAt, loc), 1)
+	if !c.IsNeverending() && c.LastScheduledAt != nil && nt.After(c.lastScheduledDay()) {
+		return time.Time{}
+	}
+	return nt.Time()
+}
+
+func (c RepeaterConfiguration) nextScheduledAt(repeat int, dcF func(Day, RepeaterDetailConfiguration) Day, aF func(Day) Day) Day {
+	ia := c.firstScheduledDay()
+
+	if count := c.repeatCount(); !c.IsNeverending() && count > 0 {
+		if repeat >= count {
+			return Day{}
 		}
 	}
 
@@ -61,8 +277,8 @@ func (c RepeaterConfiguration) nextScheduledAt(repeat int, dcF func(time.Time, R
 		}
 		nt := aF(min)
 		if !c.IsNeverending() && c.LastScheduledAt != nil {
-			if nt.After(*c.LastScheduledAt.Time()) {
-				return time.Time{}
+			if nt.After(c.lastScheduledDay()) {
+				return Day{}
 			}
 		}
 		ia = nt
@@ -71,45 +287,45 @@ func (c RepeaterConfiguration) nextScheduledAt(repeat int, dcF func(time.Time, R
 	return ia
 }
 
-func (c RepeaterConfiguration) nextWeeklyScheduledAt(repeat int) time.Time {
-	return c.nextScheduledAt(repeat, func(t time.Time, dc RepeaterDetailConfiguration) time.Time {
-		return t.AddDate(0, 0, int(*dc.Weekday-t.Weekday()))
-	}, func(t time.Time) time.Time {
-		return t.AddDate(0, 0, int(c.FrequencyAmplitude)*7)
+func (c RepeaterConfiguration) nextWeeklyScheduledAt(repeat int) Day {
+	return c.nextScheduledAt(repeat, func(d Day, dc RepeaterDetailConfiguration) Day {
+		return d.AddDays(int(*dc.Weekday - d.Weekday()))
+	}, func(d Day) Day {
+		return d.AddDays(int(c.FrequencyAmplitude) * 7)
 	})
 }
 
-func (c RepeaterConfiguration) computeFirstWeeklyScheduleAt(t time.Time) time.Time {
-	d := c.DetailConfiguration[0]
+func (c RepeaterConfiguration) computeFirstWeeklyScheduleAt(t Day) Day {
+	min := t.AddDays(7)
 	for _, dc := range c.DetailConfiguration {
-		if *dc.Weekday < *d.Weekday {
-			d = dc
+		d := t.AddDays((int(*dc.Weekday) - int(t.Weekday()) + 7) % 7)
+		if d.Before(min) {
+			min = d
 		}
 	}
-
-	if t.Weekday() < *d.Weekday {
-		return t.AddDate(0, 0, int(*d.Weekday-t.Weekday()))
-	} else if t.Weekday() > *d.Weekday {
-		return t.AddDate(0, 0, 7-int(t.Weekday())+int(*d.Weekday))
-	}
-	return t
+	return min
 }
 
-func (c RepeaterConfiguration) computeFirstMonthlyScheduleAt(t time.Time) time.Time {
+func (c RepeaterConfiguration) computeFirstMonthlyScheduleAt(t Day) Day {
 	min := t.AddDate(1, 0, 0)
 	for _, dc := range c.DetailConfiguration {
-		var d time.Time
+		var d Day
 		if dc.Day != nil {
-			d = t.AddDate(0, 0, -t.Day()+int(*dc.Day)+1)
+			d, _ = dayOfMonth(t.Year, t.Month, dc)
 			if d.Before(t) {
-				d = t.AddDate(0, 1, -t.Day()+int(*dc.Day)+1)
+				d, _ = dayOfMonth(t.Year, t.Month+1, dc)
 			}
 		}
 		if dc.Weekday != nil {
-			if *dc.MonthOf == -1 {
-				d = lastWeekdayOfMonth(t, *dc.Weekday)
-			} else {
-				d = nthWeekdayOfMonth(t, *dc.Weekday, int(*dc.MonthOf))
+			weekdayOfMonth := func(d Day) Day {
+				if *dc.MonthOf == -1 {
+					return lastWeekdayOfMonth(d, *dc.Weekday)
+				}
+				return nthWeekdayOfMonth(d, *dc.Weekday, int(*dc.MonthOf))
+			}
+			d = weekdayOfMonth(t)
+			if d.Before(t) {
+				d = weekdayOfMonth(firstDayOfMonth(t).AddDate(0, 1, 0))
 			}
 		}
 		if d.Before(min) {
@@ -119,10 +335,10 @@ func (c RepeaterConfiguration) computeFirstMonthlyScheduleAt(t time.Time) time.T
 	return min
 }
 
-func (c RepeaterConfiguration) computeFirstYearlyScheduleAt(t time.Time) time.Time {
+func (c RepeaterConfiguration) computeFirstYearlyScheduleAt(t Day) Day {
 	min := t.AddDate(1, 0, 0)
 	for _, dc := range c.DetailConfiguration {
-		var d time.Time
+		var d Day
 		if dc.Day != nil {
 			d = nthDayOfMonthOfYear(t, int(*dc.Month), int(*dc.Day))
 			if d.Before(t) {
@@ -151,9 +367,22 @@ func (c RepeaterConfiguration) computeFirstYearlyScheduleAt(t time.Time) time.Ti
 }
 
 // ComputeFirstScheduledAt calculates the first occurrence of a recurring rule based on the pattern
-// This value has to be stored as FirstScheduledAt per thingscloud convention
-func (c RepeaterConfiguration) ComputeFirstScheduledAt(t time.Time) time.Time {
+// This value has to be stored as FirstScheduledAt per thingscloud convention.
+// Malformed rules return an error wrapping ErrInvalidRepeater
+func (c RepeaterConfiguration) ComputeFirstScheduledAt(t time.Time) (time.Time, error) {
+	return c.ComputeFirstScheduledAtIn(t, t.Location())
+}
 
+// ComputeFirstScheduledAtIn is like ComputeFirstScheduledAt, but starts on the day of t in loc,
+// e.g. the time zone of the user. The result is a day stamp, midnight UTC
+func (c RepeaterConfiguration) ComputeFirstScheduledAtIn(t time.Time, loc *time.Location) (time.Time, error) {
+	if err := c.validatePattern(); err != nil {
+		return time.Time{}, err
+	}
+	return stamp(c.computeFirstScheduledAt(DayIn(t, loc))), nil
+}
+
+func (c RepeaterConfiguration) computeFirstScheduledAt(t Day) Day {
 	if c.FrequencyUnit == FrequencyUnitDaily {
 		return t
 	}
@@ -170,60 +399,62 @@ func (c RepeaterConfiguration) ComputeFirstScheduledAt(t time.Time) time.Time {
 		return c.computeFirstYearlyScheduleAt(t)
 	}
 
-	return time.Time{}
+	return Day{}
 }
 
-func lastWeekdayOfMonth(t time.Time, wdo time.Weekday) time.Time {
-	lastDayOfMonth := t.AddDate(0, 1, -t.Day())
+func lastWeekdayOfMonth(d Day, wdo time.Weekday) Day {
+	lastDayOfMonth := d.AddDate(0, 1, -d.Day)
 	if lastDayOfMonth.Weekday() == wdo {
 		return lastDayOfMonth
 	}
 	if lastDayOfMonth.Weekday() > wdo {
-		return lastDayOfMonth.AddDate(0, 0, -int(lastDayOfMonth.Weekday()-wdo))
+		return lastDayOfMonth.AddDays(-int(lastDayOfMonth.Weekday() - wdo))
 	}
-	return lastDayOfMonth.AddDate(0, 0, -7-int(lastDayOfMonth.Weekday())+int(wdo))
+	return lastDayOfMonth.AddDays(-7 - int(lastDayOfMonth.Weekday()) + int(wdo))
 }
 
-func nthWeekdayOfMonth(t time.Time, wdo time.Weekday, n int) time.Time {
-	firstDayOfMonth := t.AddDate(0, 0, -t.Day()+1)
+func nthWeekdayOfMonth(d Day, wdo time.Weekday, n int) Day {
+	firstDayOfMonth := firstDayOfMonth(d)
 	nthWeekdayOfMonth := firstDayOfMonth
 	if firstDayOfMonth.Weekday() < wdo {
-		nthWeekdayOfMonth = firstDayOfMonth.AddDate(0, 0, int(wdo-firstDayOfMonth.Weekday()))
+		nthWeekdayOfMonth = firstDayOfMonth.AddDays(int(wdo - firstDayOfMonth.Weekday()))
 	} else if firstDayOfMonth.Weekday() > wdo {
-		nthWeekdayOfMonth = firstDayOfMonth.AddDate(0, 0, 7-int(firstDayOfMonth.Weekday())+int(wdo))
+		nthWeekdayOfMonth = firstDayOfMonth.AddDays(7 - int(firstDayOfMonth.Weekday()) + int(wdo))
 	}
-	return nthWeekdayOfMonth.AddDate(0, 0, (n-1)*7)
+	return nthWeekdayOfMonth.AddDays((n - 1) * 7)
 }
 
-func firstDayOfMonth(t time.Time) time.Time {
-	return t.AddDate(0, 0, -t.Day()+1)
+func firstDayOfMonth(d Day) Day {
+	return NewDay(d.Year, d.Month, 1)
 }
 
-func lastDayOfMonth(t time.Time) time.Time {
-	return firstDayOfMonth(t).AddDate(0, 1, 0).Add(-time.Hour)
+func lastDayOfMonth(d Day) Day {
+	return NewDay(d.Year, d.Month+1, 0)
 }
 
-func (c RepeaterConfiguration) nextMonthlyScheduledAt(repeat int) time.Time {
-	return c.nextScheduledAt(repeat, func(t time.Time, dc RepeaterDetailConfiguration) time.Time {
+func (c RepeaterConfiguration) nextMonthlyScheduledAt(repeat int) Day {
+	return c.nextScheduledAt(repeat, func(d Day, dc RepeaterDetailConfiguration) Day {
 		if dc.MonthOf != nil && dc.Weekday != nil {
-			nt := t.AddDate(0, 0, -t.Day()+1)
+			nt := firstDayOfMonth(d)
 
 			if *dc.MonthOf == -1 {
 				return lastWeekdayOfMonth(nt, *dc.Weekday)
 			}
 			return nthWeekdayOfMonth(nt, *dc.Weekday, int(*dc.MonthOf))
 		}
-		if *dc.Day == -1 {
-			return t.AddDate(0, 1, -t.Day())
+		day, _ := dayOfMonth(d.Year, d.Month, dc)
+		return day
+	}, func(d Day) Day {
+		if c.DetailConfiguration[0].Day != nil {
+			// days beyond the end of the month must not move the following months
+			month := firstDayOfMonth(d).AddDate(0, int(c.FrequencyAmplitude), 0)
+			day, _ := dayOfMonth(month.Year, month.Month, c.DetailConfiguration[0])
+			return day
 		}
-		return t.AddDate(0, 0, int(*dc.Day)-t.Day()+1)
-	}, func(t time.Time) time.Time {
-		nt := t.AddDate(0, int(c.FrequencyAmplitude), 0)
+		nt := d.AddDate(0, int(c.FrequencyAmplitude), 0)
 		if len(c.DetailConfiguration) == 1 {
-			// correct last day of month
-			if c.DetailConfiguration[0].Day != nil && *c.DetailConfiguration[0].Day == -1 {
-				nt = nt.AddDate(0, 1, -nt.Day())
-			} else if c.DetailConfiguration[0].MonthOf != nil {
+			// move to the weekday of the month
+			if c.DetailConfiguration[0].MonthOf != nil {
 				if *c.DetailConfiguration[0].MonthOf == -1 {
 					nt = lastWeekdayOfMonth(nt, *c.DetailConfiguration[0].Weekday)
 				} else {
@@ -236,29 +467,36 @@ func (c RepeaterConfiguration) nextMonthlyScheduledAt(repeat int) time.Time {
 	})
 }
 
-func nthDayOfMonthOfYear(t time.Time, month, day int) time.Time {
-	return t.AddDate(0, -int(t.Month())+month+1, -t.Day()+day+1)
+// nthDayOfMonthOfYear returns the 0-based day of the 0-based month in the year of d. Day -1 is the last day of the month,
+// days beyond the end of the month are moved to the last day of the month, like dayOfMonth does
+func nthDayOfMonthOfYear(d Day, month, day int) Day {
+	last := lastDayOfMonth(NewDay(d.Year, time.Month(month+1), 1))
+	if day == -1 || day >= last.Day {
+		return last
+	}
+	return NewDay(d.Year, time.Month(month+1), day+1)
 }
 
-func (c RepeaterConfiguration) nextYearlyScheduledAt(repeat int) time.Time {
-	return c.nextScheduledAt(repeat, func(t time.Time, dc RepeaterDetailConfiguration) time.Time {
+func (c RepeaterConfiguration) nextYearlyScheduledAt(repeat int) Day {
+	return c.nextScheduledAt(repeat, func(d Day, dc RepeaterDetailConfiguration) Day {
 		if dc.MonthOf != nil && dc.Weekday != nil {
-			nt := nthDayOfMonthOfYear(t, int(*dc.Month), 1)
+			nt := nthDayOfMonthOfYear(d, int(*dc.Month), 1)
 
 			if *dc.MonthOf == -1 {
 				return lastWeekdayOfMonth(nt, *dc.Weekday)
 			}
 			return nthWeekdayOfMonth(nt, *dc.Weekday, int(*dc.MonthOf))
 		}
-		if *dc.Day == -1 {
-			return lastDayOfMonth(nthDayOfMonthOfYear(t, int(*dc.Month), 1))
-		}
-		return nthDayOfMonthOfYear(t, int(*dc.Month), int(*dc.Day))
+		return nthDayOfMonthOfYear(d, int(*dc.Month), int(*dc.Day))
 
-	}, func(t time.Time) time.Time {
-		nt := t.AddDate(int(c.FrequencyAmplitude), 0, 0)
+	}, func(d Day) Day {
+		if dc := c.DetailConfiguration[0]; dc.Day != nil {
+			// days beyond the end of the month must not move the following years
+			return nthDayOfMonthOfYear(NewDay(d.Year+int(c.FrequencyAmplitude), time.January, 1), int(*dc.Month), int(*dc.Day))
+		}
+		nt := d.AddDate(int(c.FrequencyAmplitude), 0, 0)
 		if len(c.DetailConfiguration) == 1 {
-			// correct last day of month
+			// move to the weekday of the month
 			if c.DetailConfiguration[0].MonthOf != nil {
 				nt = nthDayOfMonthOfYear(nt, int(*c.DetailConfiguration[0].Month), 1)
 				if *c.DetailConfiguration[0].MonthOf == -1 {
@@ -266,45 +504,66 @@ func (c RepeaterConfiguration) nextYearlyScheduledAt(repeat int) time.Time {
 				}
 				return nthWeekdayOfMonth(nt, *c.DetailConfiguration[0].Weekday, int(*c.DetailConfiguration[0].MonthOf))
 			}
-			if *c.DetailConfiguration[0].Day == -1 {
-				return firstDayOfMonth(t).AddDate(int(c.FrequencyAmplitude), 1, -1)
-			}
 		}
 		return nt
 	})
 }
 
-func (c RepeaterConfiguration) nextDailyScheduledAt(repeat int) time.Time {
-	ia := *c.FirstScheduledAt.Time()
+func (c RepeaterConfiguration) nextDailyScheduledAt(repeat int) Day {
+	ia := c.firstScheduledDay()
 
-	nt := ia.AddDate(0, 0, int(c.FrequencyAmplitude)*repeat)
+	nt := ia.AddDays(int(c.FrequencyAmplitude) * repeat)
 
 	if c.IsNeverending() {
 		return nt
 	}
 
 	if c.LastScheduledAt != nil {
-		if nt.After(*c.LastScheduledAt.Time()) {
-			return time.Time{}
-		}
-	} else {
-		if repeat >= int(*c.RepeatCount) {
-			return time.Time{}
+		if nt.After(c.lastScheduledDay()) {
+			return Day{}
 		}
+	} else if count := c.repeatCount(); count > 0 && repeat >= count {
+		return Day{}
 	}
 
 	return nt
 }
 
-// NextScheduledAt returns the next Nth date a rule should occur.
+// NextScheduledAt returns the next Nth date a rule should occur, as day stamp at midnight UTC.
 // Note that things generates these ToDos as necessary.
-func (c RepeaterConfiguration) NextScheduledAt(repeat int) time.Time {
+// Days beyond the end of a month, e.g. the 30th in february, occur on the last day of that month.
+// After completion rules assume every occurrence is completed on the day it is scheduled,
+// see NextScheduledAtAfterCompletion for the actual next date.
+// Rules failing Validate return an error wrapping ErrInvalidRepeater
+func (c RepeaterConfiguration) NextScheduledAt(repeat int) (time.Time, error) {
+	if err := c.Validate(); err != nil {
+		return time.Time{}, err
+	}
+	return stamp(c.nextScheduledDay(repeat)), nil
+}
+
+// NextScheduledAtIn is like NextScheduledAt, but returns the start of the day in loc, e.g. the time zone of the user
+func (c RepeaterConfiguration) NextScheduledAtIn(repeat int, loc *time.Location) (time.Time, error) {
+	if err := c.Validate(); err != nil {
+		return time.Time{}, err
+	}
+	d := c.nextScheduledDay(repeat)
+	if d.IsZero() {
+		return time.Time{}, nil
+	}
+	return d.In(loc), nil
+}
+
+func (c RepeaterConfiguration) nextScheduledDay(repeat int) Day {
+	if c.IsAfterCompletion() {
+		return c.nextAfterCompletionScheduledAt(repeat)
+	}
 	if c.FrequencyUnit == FrequencyUnitDaily {
 		return c.nextDailyScheduledAt(repeat)
 	}
 
 	// FirstScheduledAt is ALWAYS the first date matching pattern, invariant from thingscloud
-	// TODO ensure the same invariant within this codebase!
+	// which Validate checks and Normalize establishes
 	if c.FrequencyUnit == FrequencyUnitWeekly {
 		return c.nextWeeklyScheduledAt(repeat)
 	}
@@ -314,5 +573,5 @@ func (c RepeaterConfiguration) NextScheduledAt(repeat int) time.Time {
 	if c.FrequencyUnit == FrequencyUnitYearly {
 		return c.nextYearlyScheduledAt(repeat)
 	}
-	return time.Time{}
+	return Day{}
 }
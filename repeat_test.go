@@ -2,6 +2,7 @@ package thingscloud
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -11,6 +12,8 @@ var (
 	rcEveryDay          = []byte(`{"ia":1504396800,"rrv":4,"tp":0,"of":[{"dy":0}],"fu":16,"sr":1499644800,"fa":1,"rc":0,"ts":0,"ed":64092211200}`)
 	rcEveryDayEndDate   = []byte(`{"ia":1519776000,"rrv":4,"tp":0,"of":[{"dy":0}],"fu":16,"sr":1519776000,"fa":1,"rc":0,"ts":0,"ed":1519862400}`)
 	rcEveryDayEndRepeat = []byte(`{"ia":1519776000,"rrv":4,"tp":0,"of":[{"dy":0}],"fu":16,"sr":1519776000,"fa":1,"rc":2,"ts":0}`)
+	rcEveryDayNoEnd     = []byte(`{"ia":1519776000,"rrv":4,"tp":0,"of":[{"dy":0}],"fu":16,"sr":1519776000,"fa":1,"ts":0}`)
+	rcEveryDayZeroCount = []byte(`{"ia":1519776000,"rrv":4,"tp":0,"of":[{"dy":0}],"fu":16,"sr":1519776000,"fa":1,"rc":0,"ts":0}`)
 	rcEvery2ndDay       = []byte(`{"ia":1504396800,"rrv":4,"tp":0,"of":[{"dy":0}],"fu":16,"sr":1499644800,"fa":2,"rc":0,"ts":0,"ed":64092211200}`)
 
 	rcEveryWeekOnMonday              = []byte(`{"ia":1504483200,"rrv":4,"tp":0,"of":[{"wd":1}],"fu":256,"sr":1499644800,"fa":1,"rc":0,"ts":0,"ed":64092211200}`)
@@ -28,6 +31,8 @@ var (
 	rc1stDayEvery2ndMonth          = []byte(`{"ia":1504224000,"rrv":4,"tp":0,"of":[{"dy":0}],"fu":8,"sr":1499644800,"fa":2,"rc":0,"ts":0,"ed":64092211200}`)
 	rc1stAndLastDayEveryMonth      = []byte(`{"ia":1501459200,"rrv":4,"tp":0,"of":[{"dy":0},{"dy":-1}],"fu":8,"sr":1499472000,"fa":1,"rc":0,"ts":0,"ed":64092211200}`)
 	rcLastDayEvery2ndMonth         = []byte(`{"ia":1506729600,"rrv":4,"tp":0,"of":[{"dy":-1}],"fu":8,"sr":1501545600,"fa":2,"rc":0,"ts":0,"ed":64092211200}`)
+	rc30thDayEveryMonth            = []byte(`{"ia":1517270400,"rrv":4,"tp":0,"of":[{"dy":29}],"fu":8,"sr":1517270400,"fa":1,"rc":0,"ts":0,"ed":64092211200}`)
+	rc1stAnd30thDayEveryMonth      = []byte(`{"ia":1514764800,"rrv":4,"tp":0,"of":[{"dy":0},{"dy":29}],"fu":8,"sr":1514764800,"fa":1,"rc":0,"ts":0,"ed":64092211200}`)
 	rcLastMondayEvery2ndMonth      = []byte(`{"ia":1506297600,"rrv":4,"tp":0,"of":[{"wdo":-1,"wd":1}],"fu":8,"sr":1504137600,"fa":2,"rc":0,"ts":0,"ed":64092211200}`)
 	rcFirstMondayEvery2ndMonth     = []byte(`{"ia":1502064000,"rrv":4,"tp":0,"of":[{"wdo":1,"wd":1}],"fu":8,"sr":1509321600,"fa":2,"rc":0,"ts":0,"ed":64092211200}`)
 
@@ -36,10 +41,20 @@ var (
 	rcLastDayJanuaryEveryYearEndDate             = []byte(`{"ia":1517356800,"rrv":4,"tp":0,"of":[{"dy":-1,"mo":0}],"fu":4,"sr":1499472000,"fa":1,"rc":0,"ts":0,"ed":1551225600}`)
 	rcLastDayJanuaryEveryYearEndRepeat           = []byte(`{"ia":1517356800,"rrv":4,"tp":0,"of":[{"dy":-1,"mo":0}],"fu":4,"sr":1517356800,"fa":1,"rc":2,"ts":0}`)
 	rcLastDayFebuaryEveryYear                    = []byte(`{"ia":1519776000,"rrv":4,"tp":0,"of":[{"dy":-1,"mo":1}],"fu":4,"sr":1517443200,"fa":1,"rc":0,"ts":0,"ed":64092211200}`)
+	rc29thFebuaryEveryYear                       = []byte(`{"ia":1582934400,"rrv":4,"tp":0,"of":[{"dy":28,"mo":1}],"fu":4,"sr":1582934400,"fa":1,"rc":0,"ts":0,"ed":64092211200}`)
 	rc1stAndLastDayFebuaryEveryYear              = []byte(`{"ia":1517443200,"rrv":4,"tp":0,"of":[{"dy":0,"mo":1},{"dy":-1,"mo":1}],"fu":4,"sr":1499472000,"fa":1,"rc":0,"ts":0,"ed":64092211200}`)
 	rc1stJanuaryAnd1stMarchEveryYear             = []byte(`{"ia":1514764800,"rrv":4,"tp":0,"of":[{"dy":0,"mo":0},{"dy":0,"mo":2}],"fu":4,"sr":1504224000,"fa":1,"rc":0,"ts":0,"ed":64092211200}`)
 	rc1stJanuaryAndLastWednesdayFebuaryEveryYear = []byte(`{"ia":1514764800,"rrv":4,"tp":0,"of":[{"dy":0,"mo":0},{"wdo":-1,"wd":3,"mo":1}],"fu":4,"sr":1514764800,"fa":1,"rc":0,"ts":0,"ed":64092211200}`)
 	rcLastWednesdayFebuaryEveryYear              = []byte(`{"ia":1519776000,"rrv":4,"tp":0,"of":[{"wdo":-1,"wd":3,"mo":1}],"fu":4,"sr":1519776000,"fa":1,"rc":0,"ts":0,"ed":64092211200}`)
+
+	rcEvery3DaysAfterCompletion         = []byte(`{"ia":1519776000,"rrv":4,"tp":1,"of":[{"dy":0}],"fu":16,"sr":1519776000,"fa":3,"rc":0,"ts":0,"ed":64092211200}`)
+	rcEvery2WeeksAfterCompletion        = []byte(`{"ia":1519776000,"rrv":4,"tp":1,"of":[{"wd":3}],"fu":256,"sr":1519776000,"fa":2,"rc":0,"ts":0,"ed":64092211200}`)
+	rcEveryMonthAfterCompletionEndDate  = []byte(`{"ia":1519776000,"rrv":4,"tp":1,"of":[{"dy":27}],"fu":8,"sr":1519776000,"fa":1,"rc":0,"ts":0,"ed":1525046400}`)
+	rcEveryYearAfterCompletionEndRepeat = []byte(`{"ia":1519776000,"rrv":4,"tp":1,"of":[{"dy":27,"mo":1}],"fu":4,"sr":1519776000,"fa":1,"rc":2,"ts":0}`)
+
+	// task payload of a completed instance template, acrd is the completion date of the last instance
+	// and icsd the date of the next one, 3 days later
+	rcTaskAfterCompletion = []byte(`{"acrd":1520035200,"icsd":1520294400,"rr":{"ia":1519776000,"rrv":4,"tp":1,"of":[{"dy":0}],"fu":16,"sr":1519776000,"fa":3,"rc":0,"ts":0,"ed":64092211200}}`)
 )
 
 func TestRepeaterConfiguration_IsNeverending(t *testing.T) {
@@ -61,6 +76,8 @@ func Test_nthDayOfMonthOfYear(t *testing.T) {
 	}{
 		{"2017-01-10", 0, 0, "2017-01-01"},
 		{"2017-01-10", 0, 30, "2017-01-31"},
+		{"2017-01-10", 1, 29, "2017-02-28"},
+		{"2017-01-10", 1, -1, "2017-02-28"},
 		// {"2017-02-10", "2017-02-01"},
 		// {"2017-02-01", "2017-02-01"},
 		// {"2017-03-20", "2017-03-01"},
@@ -69,13 +86,13 @@ func Test_nthDayOfMonthOfYear(t *testing.T) {
 		// {"2018-03-20", "2018-03-01"},
 	}
 	for _, testCase := range testCases {
-		ts, err := time.Parse("2006-01-02", testCase.Date)
+		d, err := ParseDay(testCase.Date)
 		if err != nil {
 			t.Error(err)
 		}
-		nt := nthDayOfMonthOfYear(ts, testCase.Month, testCase.Day)
-		if nt.Format("2006-01-02") != testCase.ExpectedDate {
-			t.Errorf("Expected %d day of %d month of %q to be %q, but got %q", testCase.Day, testCase.Month, testCase.Date, testCase.ExpectedDate, nt.Format("2006-01-02"))
+		nt := nthDayOfMonthOfYear(d, testCase.Month, testCase.Day)
+		if nt.String() != testCase.ExpectedDate {
+			t.Errorf("Expected %d day of %d month of %q to be %q, but got %q", testCase.Day, testCase.Month, testCase.Date, testCase.ExpectedDate, nt.String())
 		}
 	}
 }
@@ -94,12 +111,12 @@ func Test_firstDayOfMonth(t *testing.T) {
 		{"2018-03-20", "2018-03-01"},
 	}
 	for _, testCase := range testCases {
-		ts, err := time.Parse("2006-01-02", testCase.Date)
+		d, err := ParseDay(testCase.Date)
 		if err != nil {
 			t.Error(err)
 		}
-		if firstDayOfMonth(ts).Format("2006-01-02") != testCase.ExpectedDate {
-			t.Errorf("Expected first day of month of %q to be %q, but got %q", testCase.Date, testCase.ExpectedDate, firstDayOfMonth(ts).Format("2006-01-02"))
+		if firstDayOfMonth(d).String() != testCase.ExpectedDate {
+			t.Errorf("Expected first day of month of %q to be %q, but got %q", testCase.Date, testCase.ExpectedDate, firstDayOfMonth(d).String())
 		}
 	}
 }
@@ -118,12 +135,12 @@ func Test_lastDayOfMonth(t *testing.T) {
 		{"2020-03-20", "2020-03-31"},
 	}
 	for _, testCase := range testCases {
-		ts, err := time.Parse("2006-01-02", testCase.Date)
+		d, err := ParseDay(testCase.Date)
 		if err != nil {
 			t.Error(err)
 		}
-		if lastDayOfMonth(ts).Format("2006-01-02") != testCase.ExpectedDate {
-			t.Errorf("Expected first day of month of %q to be %q, but got %q", testCase.Date, testCase.ExpectedDate, lastDayOfMonth(ts).Format("2006-01-02"))
+		if lastDayOfMonth(d).String() != testCase.ExpectedDate {
+			t.Errorf("Expected first day of month of %q to be %q, but got %q", testCase.Date, testCase.ExpectedDate, lastDayOfMonth(d).String())
 		}
 	}
 }
@@ -139,13 +156,13 @@ func Test_lastWeekdayOfMonth(t *testing.T) {
 		{"2018-02-02", time.Saturday, "2018-02-24"},
 	}
 	for _, testCase := range testCases {
-		ts, err := time.Parse("2006-01-02", testCase.Date)
+		d, err := ParseDay(testCase.Date)
 		if err != nil {
 			t.Error(err)
 		}
-		nt := lastWeekdayOfMonth(ts, testCase.Weekday)
-		if nt.Format("2006-01-02") != testCase.ExpectedDate {
-			t.Errorf("Expected last %s of month of %q to be %q, but got %q", testCase.Weekday.String(), testCase.Date, testCase.ExpectedDate, nt.Format("2006-01-02"))
+		nt := lastWeekdayOfMonth(d, testCase.Weekday)
+		if nt.String() != testCase.ExpectedDate {
+			t.Errorf("Expected last %s of month of %q to be %q, but got %q", testCase.Weekday.String(), testCase.Date, testCase.ExpectedDate, nt.String())
 		}
 	}
 }
@@ -162,13 +179,13 @@ func Test_nthWeekdayOfMonth(t *testing.T) {
 		{"2018-02-02", 3, time.Saturday, "2018-02-17"},
 	}
 	for _, testCase := range testCases {
-		ts, err := time.Parse("2006-01-02", testCase.Date)
+		d, err := ParseDay(testCase.Date)
 		if err != nil {
 			t.Error(err)
 		}
-		nt := nthWeekdayOfMonth(ts, testCase.Weekday, testCase.Nth)
-		if nt.Format("2006-01-02") != testCase.ExpectedDate {
-			t.Errorf("Expected %dth %s of month of %q to be %q, but got %q", testCase.Nth, testCase.Weekday.String(), testCase.Date, testCase.ExpectedDate, nt.Format("2006-01-02"))
+		nt := nthWeekdayOfMonth(d, testCase.Weekday, testCase.Nth)
+		if nt.String() != testCase.ExpectedDate {
+			t.Errorf("Expected %dth %s of month of %q to be %q, but got %q", testCase.Nth, testCase.Weekday.String(), testCase.Date, testCase.ExpectedDate, nt.String())
 		}
 	}
 }
@@ -181,6 +198,8 @@ func TestRepeaterConfiguration_NextScheduledAtEndDate(t *testing.T) {
 	}{
 		{"Every day w/ date", rcEveryDayEndDate, []string{"2018-02-28", "2018-03-01", "0001-01-01"}},
 		{"Every day w/ count", rcEveryDayEndRepeat, []string{"2018-02-28", "2018-03-01", "0001-01-01"}},
+		{"Every day w/o count and date", rcEveryDayNoEnd, []string{"2018-02-28", "2018-03-01", "2018-03-02"}},
+		{"Every day w/ zero count and w/o date", rcEveryDayZeroCount, []string{"2018-02-28", "2018-03-01", "2018-03-02"}},
 		{"Every week on monday w/ date", rcEveryWeekOnMondayEndDate, []string{"2018-03-05", "2018-03-12", "0001-01-01"}},
 		{"Every week on monday w/ count", rcEveryWeekOnMondayEndRepeat, []string{"2018-03-05", "2018-03-12", "0001-01-01"}},
 		{"Every 1st day of every month w/ date", rc1stDayEveryMonthEndDate, []string{"2018-02-01", "2018-03-01", "0001-01-01"}},
@@ -197,7 +216,10 @@ func TestRepeaterConfiguration_NextScheduledAtEndDate(t *testing.T) {
 			}
 
 			for i, date := range testCase.ExpectedNextDates {
-				nts := rc.NextScheduledAt(i)
+				nts, err := rc.NextScheduledAt(i)
+				if err != nil {
+					t.Fatalf("Expected valid rule, but got %v", err)
+				}
 				if nts.Format("2006-01-02") != date {
 					t.Errorf("Expected %q for next %d date, but got %q", date, i+1, nts.Format("2006-01-02"))
 				}
@@ -216,10 +238,13 @@ func TestRepeaterConfiguration_ComputeFirstScheduledAt(t *testing.T) {
 		{"Every week on monday", rcEveryWeekOnMonday, "2017-09-03", "2017-09-04"},
 		{"Every week on monday next week", rcEveryWeekOnMonday, "2017-09-05", "2017-09-11"},
 		{"Every week on monday same day", rcEveryWeekOnMonday, "2017-09-04", "2017-09-04"},
+		{"Every week on monday and tuesday on tuesday", rcEveryWeekOnMondayAndTuesday, "2017-09-05", "2017-09-05"},
+		{"Every week on monday and tuesday after tuesday", rcEveryWeekOnMondayAndTuesday, "2017-09-06", "2017-09-11"},
 
 		{"Every 1st day every month", rc1stDayEveryMonth, "2017-09-03", "2017-10-01"},
 		{"Every last day every 2nd month", rcLastDayEvery2ndMonth, "2017-09-03", "2017-09-30"},
 		{"Every last monday every 2nd month", rcLastMondayEvery2ndMonth, "2017-09-03", "2017-09-25"},
+		{"Every last monday every 2nd month after last monday", rcLastMondayEvery2ndMonth, "2017-09-26", "2017-10-30"},
 		{"Every 1st and 3rd day every month 1st", rc1stDayAnd3rdDayEveryMonth, "2017-09-01", "2017-09-01"},
 		{"Every 1st and 3rd day every month 3rd", rc1stDayAnd3rdDayEveryMonth, "2017-09-03", "2017-09-03"},
 		{"Every 1st and 3rd day every month", rc1stDayAnd3rdDayEveryMonth, "2017-09-02", "2017-09-03"},
@@ -227,7 +252,10 @@ func TestRepeaterConfiguration_ComputeFirstScheduledAt(t *testing.T) {
 		{"Every 1st and last day every month", rc1stAndLastDayEveryMonth, "2017-08-15", "2017-08-31"},
 		{"Every 1st and last day every month", rc1stAndLastDayEveryMonth, "2017-08-31", "2017-08-31"},
 		{"Every 1st and last day every month", rc1stAndLastDayEveryMonth, "2017-09-01", "2017-09-01"},
+		{"Every 30th day every month in february", rc30thDayEveryMonth, "2018-02-10", "2018-02-28"},
 
+		{"Every last day of Febuary every year", rcLastDayFebuaryEveryYear, "2018-01-15", "2018-02-28"},
+		{"Every last day of Febuary every year next year", rcLastDayFebuaryEveryYear, "2019-03-01", "2020-02-29"},
 		{"Every 1st January and last Wednesday of Febuary every year", rc1stJanuaryAndLastWednesdayFebuaryEveryYear, "2017-12-22", "2018-01-01"},
 		{"Every 1st January and last Wednesday of Febuary every year 1st", rc1stJanuaryAndLastWednesdayFebuaryEveryYear, "2018-01-01", "2018-01-01"},
 		{"Every 1st January and last Wednesday of Febuary every year last", rc1stJanuaryAndLastWednesdayFebuaryEveryYear, "2018-01-02", "2018-02-28"},
@@ -245,7 +273,10 @@ func TestRepeaterConfiguration_ComputeFirstScheduledAt(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Failed to parse date: %v", err)
 			}
-			nts := rc.ComputeFirstScheduledAt(tt)
+			nts, err := rc.ComputeFirstScheduledAt(tt)
+			if err != nil {
+				t.Fatalf("Expected valid rule, but got %v", err)
+			}
 			if nts.Format("2006-01-02") != testCase.FirstScheduledAt {
 				t.Errorf("Expected start date for %s to be %s, but got %q", testCase.StartAt, testCase.FirstScheduledAt, nts.Format("2006-01-02"))
 			}
@@ -278,10 +309,13 @@ func TestRepeaterConfiguration_NextScheduledAt(t *testing.T) {
 		{"Every last Monday of every 2nd month", rcLastMondayEvery2ndMonth, FrequencyUnitMonthly, 2, []string{"2017-09-25", "2017-11-27", "2018-01-29", "2018-03-26"}},
 		// {"Every last and first day of every month", rc1stAndLastDayEveryMonth, FrequencyUnitMonthly, 1, []string{"2017-07-31", "2017-08-01", "2017-08-31", "2017-09-01", "2017-09-30"}},
 		{"Every first Monday of every 2nd month", rcFirstMondayEvery2ndMonth, FrequencyUnitMonthly, 2, []string{"2017-08-07", "2017-10-02", "2017-12-04"}},
+		{"Every 30th day of every month", rc30thDayEveryMonth, FrequencyUnitMonthly, 1, []string{"2018-01-30", "2018-02-28", "2018-03-30", "2018-04-30"}},
+		{"Every first and 30th day of every month", rc1stAnd30thDayEveryMonth, FrequencyUnitMonthly, 1, []string{"2018-01-01", "2018-01-30", "2018-02-01", "2018-02-28", "2018-03-01", "2018-03-30"}},
 
 		{"Every first day of january of every year", rc1stDayJanuaryEveryYear, FrequencyUnitYearly, 1, []string{"2018-01-01", "2019-01-01", "2020-01-01"}},
 		{"Every last day of january of every year", rcLastDayJanuaryEveryYear, FrequencyUnitYearly, 1, []string{"2018-01-31", "2019-01-31", "2020-01-31"}},
 		{"Every last day of february of every year", rcLastDayFebuaryEveryYear, FrequencyUnitYearly, 1, []string{"2018-02-28", "2019-02-28", "2020-02-29", "2021-02-28"}},
+		{"Every 29th day of february of every year", rc29thFebuaryEveryYear, FrequencyUnitYearly, 1, []string{"2020-02-29", "2021-02-28", "2022-02-28", "2023-02-28", "2024-02-29"}},
 		{"Every first and last day of february of every year", rc1stAndLastDayFebuaryEveryYear, FrequencyUnitYearly, 1, []string{"2018-02-01", "2018-02-28", "2019-02-01", "2019-02-28"}},
 		{"Every first day of january and first day of march of every year", rc1stJanuaryAnd1stMarchEveryYear, FrequencyUnitYearly, 1, []string{"2018-01-01", "2018-03-01", "2019-01-01", "2019-03-01"}},
 		{"Every first day of january and last Wednesday of febuary of every year", rc1stJanuaryAndLastWednesdayFebuaryEveryYear, FrequencyUnitYearly, 1, []string{"2018-01-01", "2018-02-28", "2019-01-01", "2019-02-27", "2020-01-01", "2020-02-26"}},
@@ -302,7 +336,43 @@ func TestRepeaterConfiguration_NextScheduledAt(t *testing.T) {
 			}
 
 			for i, date := range testCase.ExpectedNextDates {
-				nts := rc.NextScheduledAt(i)
+				nts, err := rc.NextScheduledAt(i)
+				if err != nil {
+					t.Fatalf("Expected valid rule, but got %v", err)
+				}
+				if nts.Format("2006-01-02") != date {
+					t.Errorf("Expected %q for next %d date, but got %q", date, i+1, nts.Format("2006-01-02"))
+				}
+			}
+		})
+	}
+}
+
+func TestRepeaterConfiguration_AfterCompletion(t *testing.T) {
+	testCases := []struct {
+		Title             string
+		Data              []byte
+		ExpectedNextDates []string
+	}{
+		{"Every 3 days after completion", rcEvery3DaysAfterCompletion, []string{"2018-02-28", "2018-03-03", "2018-03-06"}},
+		{"Every 2 weeks after completion", rcEvery2WeeksAfterCompletion, []string{"2018-02-28", "2018-03-14", "2018-03-28"}},
+		{"Every month after completion w/ date", rcEveryMonthAfterCompletionEndDate, []string{"2018-02-28", "2018-03-28", "2018-04-28", "0001-01-01"}},
+		{"Every year after completion w/ count", rcEveryYearAfterCompletionEndRepeat, []string{"2018-02-28", "2019-02-28", "0001-01-01"}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Title, func(t *testing.T) {
+			var rc RepeaterConfiguration
+			if err := json.Unmarshal(testCase.Data, &rc); err != nil {
+				t.Fatalf("Failed to deserialize repeater configuration: %v", err)
+			}
+			if !rc.IsAfterCompletion() {
+				t.Fatalf("Expected repeater to repeat after completion")
+			}
+			for i, date := range testCase.ExpectedNextDates {
+				nts, err := rc.NextScheduledAt(i)
+				if err != nil {
+					t.Fatalf("Expected valid rule, but got %v", err)
+				}
 				if nts.Format("2006-01-02") != date {
 					t.Errorf("Expected %q for next %d date, but got %q", date, i+1, nts.Format("2006-01-02"))
 				}
@@ -310,3 +380,199 @@ func TestRepeaterConfiguration_NextScheduledAt(t *testing.T) {
 		})
 	}
 }
+
+func TestRepeaterConfiguration_NextScheduledAtAfterCompletion(t *testing.T) {
+	var p TaskActionItemPayload
+	if err := json.Unmarshal(rcTaskAfterCompletion, &p); err != nil {
+		t.Fatal(err.Error())
+	}
+	rc, _ := p.Repeater.Get()
+	acrd, _ := p.AfterCompletionReferenceDate.Get()
+
+	// completed late in the evening, the next occurrence depends on the day only
+	completedAt := acrd.Time().Add(23 * time.Hour)
+	if nts := rc.NextScheduledAtAfterCompletion(completedAt, 1); nts.Format("2006-01-02") != "2018-03-06" {
+		t.Errorf("Expected next occurrence 3 days after completion, but got %q", nts.Format("2006-01-02"))
+	}
+
+	var ended RepeaterConfiguration
+	if err := json.Unmarshal(rcEveryMonthAfterCompletionEndDate, &ended); err != nil {
+		t.Fatal(err.Error())
+	}
+	if nts := ended.NextScheduledAtAfterCompletion(time.Date(2018, time.April, 15, 0, 0, 0, 0, time.UTC), 1); !nts.IsZero() {
+		t.Errorf("Expected no occurrence after the end date, but got %q", nts.Format("2006-01-02"))
+	}
+
+	var fixed RepeaterConfiguration
+	if err := json.Unmarshal(rcEveryDay, &fixed); err != nil {
+		t.Fatal(err.Error())
+	}
+	if nts := fixed.NextScheduledAtAfterCompletion(completedAt, 1); !nts.IsZero() {
+		t.Errorf("Expected fixed schedules not to depend on completion, but got %q", nts.Format("2006-01-02"))
+	}
+
+	if nts := rc.NextScheduledAtAfterCompletion(completedAt, 0); !nts.Equal(DayOf(p.InstanceCreationStartDate.Ptr().Time().UTC()).Time()) {
+		t.Errorf("Expected next occurrence to match icsd, but got %q", nts.Format("2006-01-02"))
+	}
+
+	var counted RepeaterConfiguration
+	if err := json.Unmarshal(rcEveryYearAfterCompletionEndRepeat, &counted); err != nil {
+		t.Fatal(err.Error())
+	}
+	if nts := counted.NextScheduledAtAfterCompletion(completedAt, 1); nts.Format("2006-01-02") != "2019-03-03" {
+		t.Errorf("Expected second occurrence a year after completion, but got %q", nts.Format("2006-01-02"))
+	}
+	if nts := counted.NextScheduledAtAfterCompletion(completedAt, 2); !nts.IsZero() {
+		t.Errorf("Expected no occurrence after %d repeats, but got %q", 2, nts.Format("2006-01-02"))
+	}
+}
+
+func TestRepeaterConfiguration_MarshalMode(t *testing.T) {
+	var rc RepeaterConfiguration
+	if err := json.Unmarshal(rcEvery3DaysAfterCompletion, &rc); err != nil {
+		t.Fatal(err.Error())
+	}
+	bs, err := json.Marshal(rc)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !jsonEqual(bs, rcEvery3DaysAfterCompletion) {
+		t.Fatalf("Expected %s to round trip, but got %s", rcEvery3DaysAfterCompletion, bs)
+	}
+	if _, ok := rc.Extras["tp"]; ok {
+		t.Fatalf("Expected tp to be decoded, but it was kept as unknown field")
+	}
+}
+
+func TestRepeaterConfiguration_TimeZones(t *testing.T) {
+	sundays, err := ParseRRULE("FREQ=WEEKLY;BYDAY=SU")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var lastDayOfMonth, every3Days RepeaterConfiguration
+	if err := json.Unmarshal(rcLastDayEvery2ndMonth, &lastDayOfMonth); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := json.Unmarshal(rcEvery3DaysAfterCompletion, &every3Days); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	testCases := []struct {
+		Title    string
+		Location string
+		Compute  func(loc *time.Location) (time.Time, error)
+		Expected string
+	}{
+		{"first sunday on the evening DST starts in Los Angeles", "America/Los_Angeles", func(loc *time.Location) (time.Time, error) {
+			return sundays.ComputeFirstScheduledAtIn(time.Date(2018, time.March, 11, 20, 0, 0, 0, loc), loc)
+		}, "2018-03-11"},
+		{"first sunday on the evening DST ends in Los Angeles", "America/Los_Angeles", func(loc *time.Location) (time.Time, error) {
+			return sundays.ComputeFirstScheduledAtIn(time.Date(2018, time.November, 4, 20, 0, 0, 0, loc), loc)
+		}, "2018-11-04"},
+		{"first sunday right after DST starts in Berlin", "Europe/Berlin", func(loc *time.Location) (time.Time, error) {
+			return sundays.ComputeFirstScheduledAtIn(time.Date(2018, time.March, 25, 0, 30, 0, 0, loc), loc)
+		}, "2018-03-25"},
+		{"completed just after midnight the day DST ends in Berlin", "Europe/Berlin", func(loc *time.Location) (time.Time, error) {
+			return every3Days.NextScheduledAtAfterCompletionIn(time.Date(2018, time.October, 28, 0, 30, 0, 0, loc), 1, loc), nil
+		}, "2018-10-31"},
+		{"completed late the day DST starts in Auckland", "Pacific/Auckland", func(loc *time.Location) (time.Time, error) {
+			return every3Days.NextScheduledAtAfterCompletionIn(time.Date(2018, time.September, 30, 23, 30, 0, 0, loc), 1, loc), nil
+		}, "2018-10-03"},
+		{"last day of the month DST ends in Berlin", "Europe/Berlin", func(loc *time.Location) (time.Time, error) {
+			return lastDayOfMonth.NextScheduledAtIn(2, loc)
+		}, "2018-01-31"},
+		{"last day of the month skipping the DST start in São Paulo", "America/Sao_Paulo", func(loc *time.Location) (time.Time, error) {
+			return lastDayOfMonth.NextScheduledAtIn(1, loc)
+		}, "2017-11-30"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Title, func(t *testing.T) {
+			loc := mustLoadLocation(t, testCase.Location)
+			nt, err := testCase.Compute(loc)
+			if err != nil {
+				t.Fatalf("Expected valid rule, but got %v", err)
+			}
+			if got := DayOf(nt).String(); got != testCase.Expected {
+				t.Fatalf("Expected %s in %s, but got %s (%v)", testCase.Expected, testCase.Location, got, nt)
+			}
+			if loc := nt.Location(); !nt.Equal(DayOf(nt).In(loc)) {
+				t.Fatalf("Expected the start of the day, but got %v", nt)
+			}
+		})
+	}
+}
+
+func TestRepeaterConfiguration_Validate(t *testing.T) {
+	testCases := []struct {
+		Title string
+		Data  string
+	}{
+		{"unknown frequency unit", `{"ia":1504396800,"tp":0,"of":[{"dy":0}],"fu":3,"fa":1,"rc":0}`},
+		{"zero amplitude", `{"ia":1504396800,"tp":0,"of":[{"dy":0}],"fu":16,"fa":0,"rc":0}`},
+		{"unknown mode", `{"ia":1504396800,"tp":2,"of":[{"dy":0}],"fu":16,"fa":1,"rc":0}`},
+		{"negative count", `{"ia":1504396800,"tp":0,"of":[{"dy":0}],"fu":16,"fa":1,"rc":-1}`},
+		{"missing first scheduled date", `{"tp":0,"of":[{"dy":0}],"fu":16,"fa":1,"rc":0}`},
+		{"weekly without details", `{"ia":1504483200,"tp":0,"of":[],"fu":256,"fa":1,"rc":0}`},
+		{"weekly without weekday", `{"ia":1504483200,"tp":0,"of":[{"dy":0}],"fu":256,"fa":1,"rc":0}`},
+		{"unknown weekday", `{"ia":1504483200,"tp":0,"of":[{"wd":7}],"fu":256,"fa":1,"rc":0}`},
+		{"monthly without day", `{"ia":1504224000,"tp":0,"of":[{}],"fu":8,"fa":1,"rc":0}`},
+		{"monthly weekday without week", `{"ia":1504224000,"tp":0,"of":[{"wd":1}],"fu":8,"fa":1,"rc":0}`},
+		{"monthly week without weekday", `{"ia":1504224000,"tp":0,"of":[{"wdo":2}],"fu":8,"fa":1,"rc":0}`},
+		{"unknown day", `{"ia":1504224000,"tp":0,"of":[{"dy":31}],"fu":8,"fa":1,"rc":0}`},
+		{"yearly without month", `{"ia":1514764800,"tp":0,"of":[{"dy":0}],"fu":4,"fa":1,"rc":0}`},
+		{"unknown month", `{"ia":1514764800,"tp":0,"of":[{"dy":0,"mo":12}],"fu":4,"fa":1,"rc":0}`},
+		{"first scheduled date off pattern", `{"ia":1504396800,"tp":0,"of":[{"wd":1}],"fu":256,"fa":1,"rc":0,"ed":64092211200}`},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Title, func(t *testing.T) {
+			var rc RepeaterConfiguration
+			if err := json.Unmarshal([]byte(testCase.Data), &rc); err != nil {
+				t.Fatalf("Failed to deserialize repeater configuration: %v", err)
+			}
+			if err := rc.Validate(); !errors.Is(err, ErrInvalidRepeater) {
+				t.Fatalf("Expected invalid repeater, but got %v", err)
+			}
+			if _, err := rc.NextScheduledAt(1); !errors.Is(err, ErrInvalidRepeater) {
+				t.Errorf("Expected NextScheduledAt to fail, but got %v", err)
+			}
+			if _, err := rc.Iterator(); !errors.Is(err, ErrInvalidRepeater) {
+				t.Errorf("Expected Iterator to fail, but got %v", err)
+			}
+		})
+	}
+
+	for _, data := range [][]byte{
+		rcEveryDay, rcEveryWeekOnMondayAndTuesday, rc1stDayAnd2ndMondayEveryMonth, rcLastMondayEvery2ndMonth,
+		rc1stJanuaryAndLastWednesdayFebuaryEveryYear, rcEvery3DaysAfterCompletion,
+	} {
+		var rc RepeaterConfiguration
+		if err := json.Unmarshal(data, &rc); err != nil {
+			t.Fatalf("Failed to deserialize repeater configuration: %v", err)
+		}
+		if err := rc.Validate(); err != nil {
+			t.Errorf("Expected %s to be valid, but got %v", data, err)
+		}
+	}
+}
+
+func TestRepeaterConfiguration_Normalize(t *testing.T) {
+	// every week on monday, starting on a sunday
+	var rc RepeaterConfiguration
+	if err := json.Unmarshal([]byte(`{"ia":1504396800,"tp":0,"of":[{"wd":1}],"fu":256,"fa":1,"rc":0,"ed":64092211200}`), &rc); err != nil {
+		t.Fatalf("Failed to deserialize repeater configuration: %v", err)
+	}
+	if err := rc.Normalize(); err != nil {
+		t.Fatalf("Expected rule to be normalized, but got %v", err)
+	}
+	if first := rc.FirstScheduledAt.Time().UTC().Format("2006-01-02"); first != "2017-09-04" {
+		t.Errorf("Expected first occurrence on monday, but got %s", first)
+	}
+	if err := rc.Validate(); err != nil {
+		t.Errorf("Expected normalized rule to be valid, but got %v", err)
+	}
+
+	rc.DetailConfiguration = []RepeaterDetailConfiguration{{}}
+	if err := rc.Normalize(); !errors.Is(err, ErrInvalidRepeater) {
+		t.Errorf("Expected malformed rule to fail, but got %v", err)
+	}
+}
@@ -0,0 +1,398 @@
+package thingscloud
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnsupportedRule is returned for recurrence rules which cannot be converted between
+// the RFC 5545 or english representation and the things representation
+var ErrUnsupportedRule = errors.New("unsupported recurrence rule")
+
+func unsupportedRule(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrUnsupportedRule, fmt.Sprintf(format, args...))
+}
+
+// neverending is the end date things uses for rules without end
+var neverending = time.Date(4001, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var rruleFrequencies = map[FrequencyUnit]string{
+	FrequencyUnitDaily:   "DAILY",
+	FrequencyUnitWeekly:  "WEEKLY",
+	FrequencyUnitMonthly: "MONTHLY",
+	FrequencyUnitYearly:  "YEARLY",
+}
+
+var rruleWeekdays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+func formatWeekday(ordinal int64, wd time.Weekday) string {
+	if ordinal == 0 {
+		return rruleWeekdays[wd]
+	}
+	return strconv.FormatInt(ordinal, 10) + rruleWeekdays[wd]
+}
+
+func formatMonthDay(dy int64) string {
+	if dy < 0 {
+		return strconv.FormatInt(dy, 10)
+	}
+	return strconv.FormatInt(dy+1, 10)
+}
+
+// crossProduct returns the distinct values of a and b if pairs describes every combination of them
+func crossProduct(pairs [][2]string) ([]string, []string, bool) {
+	as, bs := []string{}, []string{}
+	seenA, seenB, seen := map[string]bool{}, map[string]bool{}, map[[2]string]bool{}
+	for _, p := range pairs {
+		if !seenA[p[0]] {
+			seenA[p[0]] = true
+			as = append(as, p[0])
+		}
+		if !seenB[p[1]] {
+			seenB[p[1]] = true
+			bs = append(bs, p[1])
+		}
+		seen[p] = true
+	}
+	return as, bs, len(seen) == len(as)*len(bs)
+}
+
+// ToRRULE converts the configuration into a RFC 5545 recurrence rule, e.g. FREQ=WEEKLY;BYDAY=MO,TU.
+// The start of the rule, DTSTART, is FirstScheduledAt and not part of the rule.
+func (c RepeaterConfiguration) ToRRULE() (string, error) {
+	if c.IsAfterCompletion() {
+		return "", unsupportedRule("repeat after completion has no fixed schedule")
+	}
+	freq, ok := rruleFrequencies[c.FrequencyUnit]
+	if !ok {
+		return "", unsupportedRule("unknown frequency unit %d", c.FrequencyUnit)
+	}
+	if c.FrequencyAmplitude < 1 {
+		return "", unsupportedRule("frequency amplitude must be positive, got %d", c.FrequencyAmplitude)
+	}
+	parts := []string{"FREQ=" + freq}
+	if c.FrequencyAmplitude > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", c.FrequencyAmplitude))
+	}
+
+	switch c.FrequencyUnit {
+	case FrequencyUnitWeekly:
+		days := []string{}
+		for _, dc := range c.DetailConfiguration {
+			if dc.Weekday == nil {
+				return "", unsupportedRule("weekly rules require weekdays")
+			}
+			days = append(days, formatWeekday(0, *dc.Weekday))
+		}
+		if len(days) == 0 {
+			return "", unsupportedRule("weekly rules require weekdays")
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+
+	case FrequencyUnitMonthly:
+		days, weekdays := []string{}, []string{}
+		for _, dc := range c.DetailConfiguration {
+			switch {
+			case dc.Weekday != nil && dc.MonthOf != nil:
+				weekdays = append(weekdays, formatWeekday(*dc.MonthOf, *dc.Weekday))
+			case dc.Day != nil:
+				days = append(days, formatMonthDay(*dc.Day))
+			default:
+				return "", unsupportedRule("monthly rules require a day or weekday")
+			}
+		}
+		if len(days) > 0 && len(weekdays) > 0 {
+			return "", unsupportedRule("monthly rules cannot combine days and weekdays")
+		}
+		if len(days) > 0 {
+			parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+		} else if len(weekdays) > 0 {
+			parts = append(parts, "BYDAY="+strings.Join(weekdays, ","))
+		} else {
+			return "", unsupportedRule("monthly rules require a day or weekday")
+		}
+
+	case FrequencyUnitYearly:
+		days, weekdays := [][2]string{}, [][2]string{}
+		for _, dc := range c.DetailConfiguration {
+			if dc.Month == nil {
+				return "", unsupportedRule("yearly rules require a month")
+			}
+			month := strconv.FormatInt(*dc.Month+1, 10)
+			switch {
+			case dc.Weekday != nil && dc.MonthOf != nil:
+				weekdays = append(weekdays, [2]string{month, formatWeekday(*dc.MonthOf, *dc.Weekday)})
+			case dc.Day != nil:
+				days = append(days, [2]string{month, formatMonthDay(*dc.Day)})
+			default:
+				return "", unsupportedRule("yearly rules require a day or weekday")
+			}
+		}
+		if len(days) > 0 && len(weekdays) > 0 {
+			return "", unsupportedRule("yearly rules cannot combine days and weekdays")
+		}
+		key, pairs := "BYMONTHDAY", days
+		if len(weekdays) > 0 {
+			key, pairs = "BYDAY", weekdays
+		}
+		if len(pairs) == 0 {
+			return "", unsupportedRule("yearly rules require a day or weekday")
+		}
+		months, values, ok := crossProduct(pairs)
+		if !ok {
+			return "", unsupportedRule("yearly rules must use the same days in every month")
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","), key+"="+strings.Join(values, ","))
+	}
+
+	hasCount := c.RepeatCount != nil && *c.RepeatCount > 0
+	hasEnd := c.LastScheduledAt != nil && !c.IsNeverending()
+	if hasCount && hasEnd {
+		return "", unsupportedRule("rules cannot end both after a count and on a date")
+	}
+	if hasCount {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", *c.RepeatCount))
+	}
+	if hasEnd {
+		parts = append(parts, "UNTIL="+c.LastScheduledAt.Time().Format("20060102"))
+	}
+	return strings.Join(parts, ";"), nil
+}
+
+func parseWeekday(s string) (int64, time.Weekday, error) {
+	if len(s) < 2 {
+		return 0, 0, unsupportedRule("invalid weekday %q", s)
+	}
+	code := s[len(s)-2:]
+	wd := -1
+	for i, c := range rruleWeekdays {
+		if c == code {
+			wd = i
+		}
+	}
+	if wd == -1 {
+		return 0, 0, unsupportedRule("invalid weekday %q", s)
+	}
+	var ordinal int64
+	if prefix := s[:len(s)-2]; prefix != "" {
+		n, err := strconv.ParseInt(strings.TrimPrefix(prefix, "+"), 10, 64)
+		if err != nil {
+			return 0, 0, unsupportedRule("invalid weekday %q", s)
+		}
+		if n != -1 && (n < 1 || n > 5) {
+			return 0, 0, unsupportedRule("weekday %q: only the 1st to 5th and the last weekday are supported", s)
+		}
+		ordinal = n
+	}
+	return ordinal, time.Weekday(wd), nil
+}
+
+func parseMonthDay(s string) (int64, error) {
+	n, err := strconv.ParseInt(strings.TrimPrefix(s, "+"), 10, 64)
+	if err != nil {
+		return 0, unsupportedRule("invalid month day %q", s)
+	}
+	if n == -1 {
+		return -1, nil
+	}
+	if n < 1 || n > 31 {
+		return 0, unsupportedRule("month day %q: only days 1 to 31 and the last day are supported", s)
+	}
+	return n - 1, nil
+}
+
+func parseUntil(s string) (time.Time, error) {
+	for _, layout := range []string{"20060102", "20060102T150405Z", "20060102T150405"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			y, m, d := t.Date()
+			return time.Date(y, m, d, 0, 0, 0, 0, time.UTC), nil
+		}
+	}
+	return time.Time{}, unsupportedRule("invalid UNTIL %q", s)
+}
+
+// ParseRRULE converts a RFC 5545 recurrence rule into a configuration. The RRULE: prefix is optional.
+// Rules need to specify their days explicitly, as things does not know the start of the rule.
+// FirstScheduledAt is not set, use ComputeFirstScheduledAt with the start of the rule.
+// Weeks of things start on sunday, so WKST is rejected if it changes the occurrences of the rule.
+func ParseRRULE(rule string) (RepeaterConfiguration, error) {
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+	values := map[string]string{}
+	for _, part := range strings.Split(rule, ";") {
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return RepeaterConfiguration{}, unsupportedRule("invalid part %q", part)
+		}
+		key := strings.ToUpper(kv[0])
+		switch key {
+		case "FREQ", "INTERVAL", "COUNT", "UNTIL", "BYDAY", "BYMONTHDAY", "BYMONTH", "WKST":
+		default:
+			return RepeaterConfiguration{}, unsupportedRule("%s is not supported", key)
+		}
+		if _, ok := values[key]; ok {
+			return RepeaterConfiguration{}, unsupportedRule("%s is specified twice", key)
+		}
+		values[key] = strings.ToUpper(kv[1])
+	}
+
+	c := RepeaterConfiguration{FrequencyAmplitude: 1}
+	found := false
+	for unit, freq := range rruleFrequencies {
+		if freq == values["FREQ"] {
+			c.FrequencyUnit = unit
+			found = true
+		}
+	}
+	if !found {
+		return RepeaterConfiguration{}, unsupportedRule("frequency %q is not supported", values["FREQ"])
+	}
+	if interval, ok := values["INTERVAL"]; ok {
+		n, err := strconv.ParseInt(interval, 10, 64)
+		if err != nil || n < 1 {
+			return RepeaterConfiguration{}, unsupportedRule("invalid INTERVAL %q", interval)
+		}
+		c.FrequencyAmplitude = n
+	}
+
+	split := func(key string) []string {
+		if values[key] == "" {
+			return nil
+		}
+		return strings.Split(values[key], ",")
+	}
+	byDay, byMonthDay, byMonth := split("BYDAY"), split("BYMONTHDAY"), split("BYMONTH")
+	if len(byDay) > 0 && len(byMonthDay) > 0 {
+		return RepeaterConfiguration{}, unsupportedRule("BYDAY and BYMONTHDAY cannot be combined")
+	}
+
+	// details returns the configurations for days within a month
+	details := func() ([]RepeaterDetailConfiguration, error) {
+		dcs := []RepeaterDetailConfiguration{}
+		for _, d := range byMonthDay {
+			dy, err := parseMonthDay(d)
+			if err != nil {
+				return nil, err
+			}
+			dcs = append(dcs, RepeaterDetailConfiguration{Day: &dy})
+		}
+		for _, d := range byDay {
+			ordinal, wd, err := parseWeekday(d)
+			if err != nil {
+				return nil, err
+			}
+			if ordinal == 0 {
+				return nil, unsupportedRule("weekday %q requires an ordinal, e.g. 1%s", d, d)
+			}
+			dcs = append(dcs, RepeaterDetailConfiguration{Weekday: &wd, MonthOf: &ordinal})
+		}
+		if len(dcs) == 0 {
+			return nil, unsupportedRule("%s rules require BYMONTHDAY or BYDAY", values["FREQ"])
+		}
+		return dcs, nil
+	}
+
+	switch c.FrequencyUnit {
+	case FrequencyUnitDaily:
+		if len(byDay) > 0 || len(byMonthDay) > 0 || len(byMonth) > 0 {
+			return RepeaterConfiguration{}, unsupportedRule("daily rules cannot be limited to specific days")
+		}
+		var dy int64
+		c.DetailConfiguration = []RepeaterDetailConfiguration{{Day: &dy}}
+
+	case FrequencyUnitWeekly:
+		if len(byMonthDay) > 0 || len(byMonth) > 0 {
+			return RepeaterConfiguration{}, unsupportedRule("weekly rules can only be limited to weekdays")
+		}
+		if len(byDay) == 0 {
+			return RepeaterConfiguration{}, unsupportedRule("weekly rules require BYDAY")
+		}
+		weekdays := []time.Weekday{}
+		for _, d := range byDay {
+			ordinal, wd, err := parseWeekday(d)
+			if err != nil {
+				return RepeaterConfiguration{}, err
+			}
+			if ordinal != 0 {
+				return RepeaterConfiguration{}, unsupportedRule("weekly rules do not support ordinal weekdays like %q", d)
+			}
+			weekdays = append(weekdays, wd)
+		}
+		// weeks of things start on sunday. The start of the week only changes the occurrences
+		// of rules skipping weeks on multiple days
+		if wkst, ok := values["WKST"]; ok && c.FrequencyAmplitude > 1 && len(weekdays) > 1 {
+			ordinal, wd, err := parseWeekday(wkst)
+			if err != nil || ordinal != 0 {
+				return RepeaterConfiguration{}, unsupportedRule("invalid WKST %q", wkst)
+			}
+			if wd != time.Sunday {
+				return RepeaterConfiguration{}, unsupportedRule("weeks starting on %s are not supported", wd)
+			}
+		}
+		sort.Slice(weekdays, func(i, j int) bool { return weekdays[i] < weekdays[j] })
+		for _, wd := range weekdays {
+			wd := wd
+			c.DetailConfiguration = append(c.DetailConfiguration, RepeaterDetailConfiguration{Weekday: &wd})
+		}
+
+	case FrequencyUnitMonthly:
+		if len(byMonth) > 0 {
+			return RepeaterConfiguration{}, unsupportedRule("monthly rules cannot be limited to months")
+		}
+		dcs, err := details()
+		if err != nil {
+			return RepeaterConfiguration{}, err
+		}
+		c.DetailConfiguration = dcs
+
+	case FrequencyUnitYearly:
+		if len(byMonth) == 0 {
+			return RepeaterConfiguration{}, unsupportedRule("yearly rules require BYMONTH")
+		}
+		dcs, err := details()
+		if err != nil {
+			return RepeaterConfiguration{}, err
+		}
+		for _, m := range byMonth {
+			n, err := strconv.ParseInt(m, 10, 64)
+			if err != nil || n < 1 || n > 12 {
+				return RepeaterConfiguration{}, unsupportedRule("invalid month %q", m)
+			}
+			mo := n - 1
+			for _, dc := range dcs {
+				dc.Month = &mo
+				c.DetailConfiguration = append(c.DetailConfiguration, dc)
+			}
+		}
+	}
+
+	var rc int64
+	c.RepeatCount = &rc
+	if count, ok := values["COUNT"]; ok {
+		n, err := strconv.ParseInt(count, 10, 64)
+		if err != nil || n < 1 {
+			return RepeaterConfiguration{}, unsupportedRule("invalid COUNT %q", count)
+		}
+		c.RepeatCount = &n
+	}
+	until, hasUntil := values["UNTIL"]
+	if hasUntil && *c.RepeatCount > 0 {
+		return RepeaterConfiguration{}, unsupportedRule("COUNT and UNTIL cannot be combined")
+	}
+	if hasUntil {
+		t, err := parseUntil(until)
+		if err != nil {
+			return RepeaterConfiguration{}, err
+		}
+		c.LastScheduledAt = Time(t)
+	} else if *c.RepeatCount == 0 {
+		c.LastScheduledAt = Time(neverending)
+	}
+	return c, nil
+}
@@ -0,0 +1,154 @@
+package thingscloud
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestRepeaterConfiguration_ToRRULE(t *testing.T) {
+	testCases := []struct {
+		Title    string
+		Data     []byte
+		Expected string
+	}{
+		{"Every day", rcEveryDay, "FREQ=DAILY"},
+		{"Every 2nd day", rcEvery2ndDay, "FREQ=DAILY;INTERVAL=2"},
+		{"Every day w/ date", rcEveryDayEndDate, "FREQ=DAILY;UNTIL=20180301"},
+		{"Every day w/ count", rcEveryDayEndRepeat, "FREQ=DAILY;COUNT=2"},
+		{"Every week on monday and tuesday", rcEveryWeekOnMondayAndTuesday, "FREQ=WEEKLY;BYDAY=MO,TU"},
+		{"Every 2nd week on monday", rcEvery2ndWeekOnMonday, "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO"},
+		{"Every 1st and 3rd day every month", rc1stDayAnd3rdDayEveryMonth, "FREQ=MONTHLY;BYMONTHDAY=1,3"},
+		{"Every 1st and last day every month", rc1stAndLastDayEveryMonth, "FREQ=MONTHLY;BYMONTHDAY=1,-1"},
+		{"Every last monday every 2nd month", rcLastMondayEvery2ndMonth, "FREQ=MONTHLY;INTERVAL=2;BYDAY=-1MO"},
+		{"Every first monday every 2nd month", rcFirstMondayEvery2ndMonth, "FREQ=MONTHLY;INTERVAL=2;BYDAY=1MO"},
+		{"Every last day of january", rcLastDayJanuaryEveryYear, "FREQ=YEARLY;BYMONTH=1;BYMONTHDAY=-1"},
+		{"Every 1st and last day of february", rc1stAndLastDayFebuaryEveryYear, "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=1,-1"},
+		{"Every 1st of january and march", rc1stJanuaryAnd1stMarchEveryYear, "FREQ=YEARLY;BYMONTH=1,3;BYMONTHDAY=1"},
+		{"Every last wednesday of february", rcLastWednesdayFebuaryEveryYear, "FREQ=YEARLY;BYMONTH=2;BYDAY=-1WE"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Title, func(t *testing.T) {
+			var rc RepeaterConfiguration
+			if err := json.Unmarshal(testCase.Data, &rc); err != nil {
+				t.Fatalf("Failed to deserialize repeater configuration: %v", err)
+			}
+			rule, err := rc.ToRRULE()
+			if err != nil {
+				t.Fatalf("Expected rule, but got %v", err)
+			}
+			if rule != testCase.Expected {
+				t.Fatalf("Expected %q, but got %q", testCase.Expected, rule)
+			}
+		})
+	}
+}
+
+func TestRepeaterConfiguration_ToRRULEUnsupported(t *testing.T) {
+	testCases := []struct {
+		Title string
+		Data  []byte
+	}{
+		{"Every 1st day and 2nd monday every month", rc1stDayAnd2ndMondayEveryMonth},
+		{"Every 1st january and last wednesday of february", rc1stJanuaryAndLastWednesdayFebuaryEveryYear},
+		{"Every 3 days after completion", rcEvery3DaysAfterCompletion},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Title, func(t *testing.T) {
+			var rc RepeaterConfiguration
+			if err := json.Unmarshal(testCase.Data, &rc); err != nil {
+				t.Fatalf("Failed to deserialize repeater configuration: %v", err)
+			}
+			if _, err := rc.ToRRULE(); !errors.Is(err, ErrUnsupportedRule) {
+				t.Fatalf("Expected unsupported rule, but got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseRRULE(t *testing.T) {
+	testCases := []struct {
+		Rule     string
+		Expected []byte
+	}{
+		{"FREQ=DAILY", rcEveryDay},
+		{"RRULE:FREQ=DAILY;INTERVAL=2", rcEvery2ndDay},
+		{"FREQ=DAILY;UNTIL=20180301T000000Z", rcEveryDayEndDate},
+		{"FREQ=DAILY;COUNT=2", rcEveryDayEndRepeat},
+		{"FREQ=WEEKLY;BYDAY=TU,MO;WKST=MO", rcEveryWeekOnMondayAndTuesday},
+		{"FREQ=MONTHLY;BYMONTHDAY=1,-1", rc1stAndLastDayEveryMonth},
+		{"FREQ=MONTHLY;INTERVAL=2;BYDAY=-1MO", rcLastMondayEvery2ndMonth},
+		{"FREQ=YEARLY;BYMONTH=1,3;BYMONTHDAY=1", rc1stJanuaryAnd1stMarchEveryYear},
+		{"FREQ=YEARLY;BYMONTH=2;BYDAY=-1WE", rcLastWednesdayFebuaryEveryYear},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Rule, func(t *testing.T) {
+			var expected RepeaterConfiguration
+			if err := json.Unmarshal(testCase.Expected, &expected); err != nil {
+				t.Fatalf("Failed to deserialize repeater configuration: %v", err)
+			}
+			rc, err := ParseRRULE(testCase.Rule)
+			if err != nil {
+				t.Fatalf("Expected rule to be parsed, but got %v", err)
+			}
+
+			// compare the rule only, ignoring the start and unknown fields of the captured payloads
+			expected.FirstScheduledAt, expected.Extras = nil, nil
+			bs, _ := json.Marshal(rc)
+			expectedBs, _ := json.Marshal(expected)
+			if !jsonEqual(bs, expectedBs) {
+				t.Fatalf("Expected %s, but got %s", expectedBs, bs)
+			}
+
+			rule, err := rc.ToRRULE()
+			if err != nil {
+				t.Fatalf("Expected rule to round trip, but got %v", err)
+			}
+			if _, err := ParseRRULE(rule); err != nil {
+				t.Fatalf("Expected %q to be parsed again, but got %v", rule, err)
+			}
+		})
+	}
+}
+
+func TestParseRRULEUnsupported(t *testing.T) {
+	testCases := []string{
+		"FREQ=HOURLY",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=WEEKLY",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=MONTHLY",
+		"FREQ=MONTHLY;BYDAY=MO",
+		"FREQ=MONTHLY;BYMONTHDAY=-2",
+		"FREQ=MONTHLY;BYMONTHDAY=1;BYDAY=1MO",
+		"FREQ=MONTHLY;BYSETPOS=-1;BYDAY=MO,TU",
+		"FREQ=YEARLY;BYMONTHDAY=1",
+		"FREQ=DAILY;COUNT=2;UNTIL=20180301",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TU;WKST=MO",
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TU;WKST=XX",
+		"FREQ",
+	}
+	for _, rule := range testCases {
+		t.Run(rule, func(t *testing.T) {
+			if _, err := ParseRRULE(rule); !errors.Is(err, ErrUnsupportedRule) {
+				t.Fatalf("Expected unsupported rule, but got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseRRULEWeekStart(t *testing.T) {
+	// the start of the week only matters for rules skipping weeks on multiple days
+	for _, rule := range []string{
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TU;WKST=SU",
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO;WKST=MO",
+		"FREQ=WEEKLY;BYDAY=MO,TU;WKST=MO",
+	} {
+		t.Run(rule, func(t *testing.T) {
+			if _, err := ParseRRULE(rule); err != nil {
+				t.Fatalf("Expected rule to be parsed, but got %v", err)
+			}
+		})
+	}
+}
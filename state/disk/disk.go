@@ -0,0 +1,308 @@
+// Package disk implements a state.Store persisted in a directory, so the aggregated state
+// survives application restarts and syncing resumes at the last applied server index.
+//
+// The state is stored as snapshot plus an append-only journal of the items applied since.
+// Applying items only appends to the journal, which is compacted into a new snapshot periodically.
+// A write interrupted by a crash leaves an incomplete last journal entry, which is dropped when
+// the store is opened again; the items are loaded from the history again.
+package disk
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	things "github.com/nicolai86/things-cloud-sdk"
+	"github.com/nicolai86/things-cloud-sdk/state"
+	"github.com/nicolai86/things-cloud-sdk/state/memory"
+)
+
+const (
+	snapshotFile = "snapshot.json"
+	journalFile  = "journal.jsonl"
+)
+
+// DefaultCompactEvery is the number of journal entries after which a new snapshot is written
+const DefaultCompactEvery = 100
+
+var _ state.Store = (*Store)(nil)
+
+type item struct {
+	UUID   string            `json:"uuid"`
+	Kind   things.ItemKind   `json:"e"`
+	Action things.ItemAction `json:"t"`
+	P      json.RawMessage   `json:"p"`
+}
+
+// entry is a line of the journal, containing the items of one Apply
+type entry struct {
+	Seq   int    `json:"seq"`
+	Index int    `json:"index"`
+	Items []item `json:"items"`
+}
+
+type snapshot struct {
+	// Seq is the last journal entry contained in the snapshot
+	Seq   int           `json:"seq"`
+	State *memory.State `json:"state"`
+}
+
+// Store keeps the aggregated state in memory and persists all changes to a directory.
+// Queries are answered from memory, the state can only be changed using Apply.
+// Note that the store is not safe for concurrent use.
+type Store struct {
+	// CompactEvery is the number of journal entries after which Apply compacts the journal
+	CompactEvery int
+	// OnCompactError is invoked if Apply fails to compact the journal. The items were applied anyway,
+	// so Apply does not fail; the journal keeps growing and the next Apply tries to compact it again
+	OnCompactError func(error)
+
+	state   *memory.State
+	dir     string
+	journal *os.File
+	seq     int
+	entries int
+	// err is set once the journal may contain a partial entry, which following entries must not be appended to
+	err error
+}
+
+// Open loads the store persisted in dir, or creates a new one.
+// An incomplete last journal entry, e.g. left by a crash, is dropped.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		CompactEvery: DefaultCompactEvery,
+		state:        memory.NewState(),
+		dir:          dir,
+	}
+
+	bs, err := ioutil.ReadFile(filepath.Join(dir, snapshotFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		snap := snapshot{State: s.state}
+		if err := json.Unmarshal(bs, &snap); err != nil {
+			return nil, fmt.Errorf("corrupt snapshot: %w", err)
+		}
+		s.state.ResolveReferences()
+		s.seq = snap.Seq
+	}
+
+	journal, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	s.journal = journal
+	if err := s.replay(); err != nil {
+		journal.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// replay applies all journal entries not contained in the snapshot and truncates
+// an incomplete last entry, so following entries are appended after the last complete one
+func (s *Store) replay() error {
+	r := bufio.NewReader(s.journal)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// the last entry is complete once its newline was written
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var e entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return fmt.Errorf("corrupt journal entry at offset %d: %w", offset, err)
+		}
+		offset += int64(len(line))
+		// entries of a compaction interrupted before the journal was reset are part of the snapshot
+		if e.Seq <= s.seq {
+			continue
+		}
+		if err := s.state.Apply(e.Index, e.items()...); err != nil {
+			return err
+		}
+		s.seq = e.Seq
+		s.entries++
+	}
+	if err := s.journal.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := s.journal.Seek(offset, io.SeekStart)
+	return err
+}
+
+func (e entry) items() []things.Item {
+	items := make([]things.Item, len(e.Items))
+	for i, it := range e.Items {
+		items[i] = things.Item{UUID: it.UUID, Kind: it.Kind, Action: it.Action, P: it.P}
+	}
+	return items
+}
+
+// Apply appends items to the journal and updates the state with them. index is the server
+// index the items were loaded up to, where syncing resumes after the store is opened again.
+// If the state rejects any of the items, none of them are applied and the entry is dropped from
+// the journal again. Compaction failures are reported to OnCompactError instead of the caller
+func (s *Store) Apply(index int, items ...things.Item) error {
+	if s.err != nil {
+		return s.err
+	}
+	if len(items) == 0 && index == s.state.LastIndex() {
+		return nil
+	}
+
+	e := entry{Seq: s.seq + 1, Index: index, Items: make([]item, len(items))}
+	for i, it := range items {
+		e.Items[i] = item{UUID: it.UUID, Kind: it.Kind, Action: it.Action, P: it.P}
+	}
+	bs, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	offset, err := s.journal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	n, err := s.journal.Write(append(bs, '\n'))
+	if n > 0 {
+		// the entry is replayed once it is complete, so its seq must not be used again
+		s.seq = e.Seq
+		s.entries++
+	}
+	if err != nil {
+		return s.drop(offset, err)
+	}
+	if err := s.journal.Sync(); err != nil {
+		// the entry may still reach the disk and is replayed when the store is opened again
+		return err
+	}
+	if err := s.state.Apply(index, items...); err != nil {
+		// the state rejects the whole batch, and replaying the entry would fail as well
+		return s.drop(offset, err)
+	}
+
+	if s.CompactEvery > 0 && s.entries >= s.CompactEvery {
+		if err := s.Compact(); err != nil && s.OnCompactError != nil {
+			s.OnCompactError(err)
+		}
+	}
+	return nil
+}
+
+// LastIndex returns the index recorded by the last Apply, the start index of the next items to load
+func (s *Store) LastIndex() int {
+	return s.state.LastIndex()
+}
+
+// Task returns the task or project with the given uuid
+func (s *Store) Task(uuid string) *things.Task {
+	return s.state.Task(uuid)
+}
+
+// Area returns the area with the given uuid
+func (s *Store) Area(uuid string) *things.Area {
+	return s.state.Area(uuid)
+}
+
+// Tag returns the tag with the given uuid
+func (s *Store) Tag(uuid string) *things.Tag {
+	return s.state.Tag(uuid)
+}
+
+// CheckListItem returns the check list item with the given uuid
+func (s *Store) CheckListItem(uuid string) *things.CheckListItem {
+	return s.state.CheckListItem(uuid)
+}
+
+// AllTasks returns all tasks, projects and headings ordered by index
+func (s *Store) AllTasks(opts state.ListOption) []*things.Task {
+	return s.state.AllTasks(opts)
+}
+
+// AllAreas returns all areas ordered by title
+func (s *Store) AllAreas() []*things.Area {
+	return s.state.AllAreas()
+}
+
+// AllTags returns all tags ordered by title
+func (s *Store) AllTags() []*things.Tag {
+	return s.state.AllTags()
+}
+
+// AllCheckListItems returns all check list items ordered by index
+func (s *Store) AllCheckListItems(opts state.ListOption) []*things.CheckListItem {
+	return s.state.AllCheckListItems(opts)
+}
+
+// drop removes the entry written at offset after it failed with err, so following entries are not
+// appended to it. If the journal can't be reset, the store refuses all following writes
+func (s *Store) drop(offset int64, err error) error {
+	if terr := s.journal.Truncate(offset); terr != nil {
+		s.err = fmt.Errorf("journal entry could not be dropped: %w", terr)
+		return fmt.Errorf("%w (%v)", err, s.err)
+	}
+	if _, serr := s.journal.Seek(offset, io.SeekStart); serr != nil {
+		s.err = fmt.Errorf("journal entry could not be dropped: %w", serr)
+		return fmt.Errorf("%w (%v)", err, s.err)
+	}
+	return err
+}
+
+// Compact writes a snapshot of the state and resets the journal
+func (s *Store) Compact() error {
+	bs, err := json.Marshal(snapshot{Seq: s.seq, State: s.state})
+	if err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(s.dir, snapshotFile), bs); err != nil {
+		return err
+	}
+	if err := s.journal.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.journal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.entries = 0
+	return s.journal.Sync()
+}
+
+// Close closes the journal. The store must not be used afterwards
+func (s *Store) Close() error {
+	return s.journal.Close()
+}
+
+// writeFile atomically replaces the file at path
+func writeFile(path string, bs []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
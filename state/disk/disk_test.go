@@ -0,0 +1,283 @@
+package disk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	things "github.com/nicolai86/things-cloud-sdk"
+	"github.com/nicolai86/things-cloud-sdk/state"
+)
+
+const historyID = "33333abb-bfe4-4b03-a5c9-106d42220c72"
+
+// rawItem converts items created by the builders into history items
+func rawItem(t *testing.T, item things.Identifiable) things.Item {
+	bs, err := json.Marshal(item)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var raw things.Item
+	if err := json.Unmarshal(bs, &raw); err != nil {
+		t.Fatal(err.Error())
+	}
+	raw.UUID = item.UUID()
+	return raw
+}
+
+func open(t *testing.T, dir string) *Store {
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStore_Reopen(t *testing.T) {
+	for _, compactEvery := range []int{0, 1, 2} {
+		t.Run(fmt.Sprintf("compacting every %d entries", compactEvery), func(t *testing.T) {
+			dir := t.TempDir()
+			tag := things.NewTag("Errand").Build()
+			area := things.NewArea("Household").WithTags(&things.Tag{UUID: tag.UUID()}).Build()
+			task := things.NewTask("milk").InArea(&things.Area{UUID: area.UUID()}).Build()
+
+			s := open(t, dir)
+			s.CompactEvery = compactEvery
+			if err := s.Apply(2, rawItem(t, tag), rawItem(t, area)); err != nil {
+				t.Fatal(err.Error())
+			}
+			if err := s.Apply(3, rawItem(t, task)); err != nil {
+				t.Fatal(err.Error())
+			}
+			if err := s.Apply(5, rawItem(t, things.EditTask(task.UUID()).WithTitle("oat milk").Build())); err != nil {
+				t.Fatal(err.Error())
+			}
+			s.Close()
+
+			s = open(t, dir)
+			if s.LastIndex() != 5 {
+				t.Errorf("Expected index 5, but got %d", s.LastIndex())
+			}
+			if got := s.Task(task.UUID()); got == nil || got.Title != "oat milk" {
+				t.Fatalf("Expected modified task, but got %#v", got)
+			}
+			a := state.AreaByName(s, "Household")
+			if a == nil || len(a.Tags) != 1 || a.Tags[0] != s.Tag(tag.UUID()) {
+				t.Fatalf("Expected area to reference its tag, but got %#v", a)
+			}
+			if tasks := state.TasksByArea(s, a, state.ListOption{}); len(tasks) != 1 {
+				t.Errorf("Expected one task in area, but got %v", tasks)
+			}
+		})
+	}
+}
+
+func TestStore_RecoversIncompleteEntry(t *testing.T) {
+	dir := t.TempDir()
+	s := open(t, dir)
+	if err := s.Apply(1, rawItem(t, things.NewTask("first").Build())); err != nil {
+		t.Fatal(err.Error())
+	}
+	s.Close()
+
+	// crash while appending the second entry
+	f, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	f.WriteString(`{"seq":2,"index":2,"items":[{"uuid":"A","e":"Task`)
+	f.Close()
+
+	s = open(t, dir)
+	if s.LastIndex() != 1 || len(s.AllTasks(state.ListOption{})) != 1 {
+		t.Fatalf("Expected state of the first entry, but got index %d and %v", s.LastIndex(), s.AllTasks(state.ListOption{}))
+	}
+	if err := s.Apply(2, rawItem(t, things.NewTask("second").Build())); err != nil {
+		t.Fatal(err.Error())
+	}
+	s.Close()
+
+	s = open(t, dir)
+	if s.LastIndex() != 2 || len(s.AllTasks(state.ListOption{})) != 2 {
+		t.Fatalf("Expected both entries, but got index %d and %v", s.LastIndex(), s.AllTasks(state.ListOption{}))
+	}
+}
+
+func TestStore_RejectedEntry(t *testing.T) {
+	dir := t.TempDir()
+	s := open(t, dir)
+	if err := s.Apply(1, rawItem(t, things.NewTask("first").Build())); err != nil {
+		t.Fatal(err.Error())
+	}
+	invalid := things.Item{UUID: "A", Kind: things.ItemKindTask, Action: things.ItemActionCreated, P: json.RawMessage(`{"tt":1}`)}
+	if err := s.Apply(2, invalid); err == nil {
+		t.Fatal("Expected invalid item to be rejected")
+	}
+	if s.LastIndex() != 1 {
+		t.Fatalf("Expected index 1, but got %d", s.LastIndex())
+	}
+	if err := s.Apply(2, rawItem(t, things.NewTask("second").Build())); err != nil {
+		t.Fatal(err.Error())
+	}
+	s.Close()
+
+	s = open(t, dir)
+	if s.LastIndex() != 2 || len(s.AllTasks(state.ListOption{})) != 2 {
+		t.Fatalf("Expected rejected entry to be dropped, but got index %d and %v", s.LastIndex(), s.AllTasks(state.ListOption{}))
+	}
+}
+
+func TestStore_RejectedMixedEntry(t *testing.T) {
+	dir := t.TempDir()
+	s := open(t, dir)
+	s.CompactEvery = 0
+	valid := things.NewTask("valid").Build()
+	invalid := things.Item{UUID: "A", Kind: things.ItemKindTask, Action: things.ItemActionCreated, P: json.RawMessage(`{"tt":1}`)}
+	if err := s.Apply(1, rawItem(t, valid), invalid); err == nil {
+		t.Fatal("Expected batch containing an invalid item to be rejected")
+	}
+	if s.LastIndex() != 0 || s.Task(valid.UUID()) != nil {
+		t.Fatalf("Expected no item of the batch to be applied, but got index %d and %v", s.LastIndex(), s.AllTasks(state.ListOption{}))
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatal(err.Error())
+	}
+	s.Close()
+
+	s = open(t, dir)
+	if s.LastIndex() != 0 || s.Task(valid.UUID()) != nil {
+		t.Fatalf("Expected rejected batch not to be persisted, but got index %d and %v", s.LastIndex(), s.AllTasks(state.ListOption{}))
+	}
+}
+
+func TestStore_CompactionFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "store")
+	s := open(t, dir)
+	s.CompactEvery = 1
+	var compactErr error
+	s.OnCompactError = func(err error) {
+		compactErr = err
+	}
+	// the snapshot can't be written anymore, while the open journal is still writable
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err.Error())
+	}
+	task := things.NewTask("first").Build()
+	if err := s.Apply(1, rawItem(t, task)); err != nil {
+		t.Fatalf("Expected applied items not to fail, but got %v", err)
+	}
+	if compactErr == nil {
+		t.Fatal("Expected compaction failure to be reported")
+	}
+	if s.LastIndex() != 1 || s.Task(task.UUID()) == nil {
+		t.Fatalf("Expected items to be applied, but got index %d and %v", s.LastIndex(), s.AllTasks(state.ListOption{}))
+	}
+}
+
+func TestStore_CorruptJournal(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, journalFile), []byte("garbage\n{}\n"), 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := Open(dir); err == nil {
+		t.Fatal("Expected corrupt journal to fail")
+	}
+}
+
+func TestStore_InterruptedCompaction(t *testing.T) {
+	dir := t.TempDir()
+	task := things.NewTask("first").Build()
+	s := open(t, dir)
+	s.CompactEvery = 0
+	if err := s.Apply(1, rawItem(t, task)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := s.Apply(2, rawItem(t, things.DeleteTask(task.UUID()))); err != nil {
+		t.Fatal(err.Error())
+	}
+	journal, err := ioutil.ReadFile(filepath.Join(dir, journalFile))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatal(err.Error())
+	}
+	s.Close()
+
+	// crash after the snapshot was written, but before the journal was reset
+	if err := ioutil.WriteFile(filepath.Join(dir, journalFile), journal, 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+	s = open(t, dir)
+	if s.LastIndex() != 2 || s.Task(task.UUID()) != nil {
+		t.Fatalf("Expected snapshot state, but got index %d and %v", s.LastIndex(), s.AllTasks(state.ListOption{}))
+	}
+	if err := s.Apply(3, rawItem(t, things.NewTask("second").Build())); err != nil {
+		t.Fatal(err.Error())
+	}
+	s.Close()
+
+	s = open(t, dir)
+	if s.LastIndex() != 3 || len(s.AllTasks(state.ListOption{})) != 1 {
+		t.Fatalf("Expected entry after the snapshot, but got index %d and %v", s.LastIndex(), s.AllTasks(state.ListOption{}))
+	}
+}
+
+type fakeHistory struct {
+	t            *testing.T
+	items        []map[string]things.Item
+	startIndexes []int
+}
+
+func (f *fakeHistory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != fmt.Sprintf("/version/1/history/%s/items", historyID) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	start, _ := strconv.Atoi(r.URL.Query().Get("start-index"))
+	f.startIndexes = append(f.startIndexes, start)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items":              f.items[start:],
+		"current-item-index": len(f.items),
+	})
+}
+
+func (f *fakeHistory) add(item things.Identifiable) {
+	raw := rawItem(f.t, item)
+	f.items = append(f.items, map[string]things.Item{raw.UUID: raw})
+}
+
+func TestSync(t *testing.T) {
+	fake := &fakeHistory{t: t}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	h := &things.History{Client: things.New(server.URL, "martin@example.com", ""), ID: historyID}
+
+	fake.add(things.NewTask("first").Build())
+	fake.add(things.NewTask("second").Build())
+	dir := t.TempDir()
+	s := open(t, dir)
+	if err := state.Sync(s, h); err != nil {
+		t.Fatal(err.Error())
+	}
+	s.Close()
+
+	fake.add(things.NewTask("third").Build())
+	s = open(t, dir)
+	if err := state.Sync(s, h); err != nil {
+		t.Fatal(err.Error())
+	}
+	if fmt.Sprint(fake.startIndexes) != "[0 2]" {
+		t.Errorf("Expected sync to resume at index 2, but loaded items from %v", fake.startIndexes)
+	}
+	if s.LastIndex() != 3 || len(s.AllTasks(state.ListOption{})) != 3 {
+		t.Errorf("Expected all tasks, but got index %d and %v", s.LastIndex(), s.AllTasks(state.ListOption{}))
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"time"
 
 	things "github.com/nicolai86/things-cloud-sdk"
+	"github.com/nicolai86/things-cloud-sdk/state"
 )
 
+var _ state.Store = (*State)(nil)
+
 // State is created by applying all history items in order.
 // Note that the hierarchy within the state (e.g. area > tasks > tasks > check list items)
 // is modelled with pointers between the different maps, so concurrent modification
@@ -17,6 +21,11 @@ type State struct {
 	Tasks          map[string]*things.Task
 	Tags           map[string]*things.Tag
 	CheckListItems map[string]*things.CheckListItem
+	Settings       *things.Settings
+	// Unknown keeps objects of kinds not modelled by the SDK, indexed by UUID
+	Unknown map[string]*things.Object
+	// AppliedIndex is the server index recorded by Apply
+	AppliedIndex int
 }
 
 // NewState creates a new, empty state
@@ -26,6 +35,23 @@ func NewState() *State {
 		Tags:           map[string]*things.Tag{},
 		CheckListItems: map[string]*things.CheckListItem{},
 		Tasks:          map[string]*things.Task{},
+		Unknown:        map[string]*things.Object{},
+	}
+}
+
+// applyTime updates dst with a nullable payload date. Explicit nulls clear dst
+func applyTime(o things.Optional[things.Timestamp], dst **time.Time) {
+	if ts, ok := o.Get(); ok {
+		*dst = ts.Time()
+	} else if o.IsNull() {
+		*dst = nil
+	}
+}
+
+// applyDay updates dst with a nullable payload day. Explicit nulls clear dst
+func applyDay(o things.Optional[things.Day], dst **things.Day) {
+	if o.IsSet() {
+		*dst = o.Ptr()
 	}
 }
 
@@ -41,8 +67,8 @@ func (s *State) updateTask(item things.TaskActionItem) *things.Task {
 	if item.P.Title != nil {
 		t.Title = *item.P.Title
 	}
-	if item.P.IsProject != nil {
-		t.IsProject = bool(*item.P.IsProject)
+	if item.P.Type != nil {
+		t.Type = *item.P.Type
 	}
 	if item.P.Status != nil {
 		t.Status = *item.P.Status
@@ -56,15 +82,9 @@ func (s *State) updateTask(item things.TaskActionItem) *things.Task {
 	if item.P.Schedule != nil {
 		t.Schedule = *item.P.Schedule
 	}
-	if item.P.ScheduledDate != nil {
-		t.ScheduledDate = item.P.ScheduledDate.Time()
-	}
-	if item.P.CompletionDate != nil {
-		t.CompletionDate = item.P.CompletionDate.Time()
-	}
-	if item.P.DeadlineDate != nil {
-		t.DeadlineDate = item.P.DeadlineDate.Time()
-	}
+	applyDay(item.P.ScheduledDate, &t.ScheduledDate)
+	applyTime(item.P.CompletionDate, &t.CompletionDate)
+	applyDay(item.P.DeadlineDate, &t.DeadlineDate)
 	if item.P.CreationDate != nil {
 		cd := item.P.CreationDate.Time()
 		t.CreationDate = *cd
@@ -84,12 +104,51 @@ func (s *State) updateTask(item things.TaskActionItem) *things.Task {
 		ids := *item.P.ParentTaskIDs
 		t.ParentTaskIDs = ids
 	}
-	if item.P.Note != nil {
-		t.Note = *item.P.Note
+	if item.P.Note.IsSet() {
+		n, _ := item.P.Note.Get()
+		t.Note = n
 	}
-	if item.P.Title != nil {
-		t.Title = *item.P.Title
+	if item.P.DeadlineOffset != nil {
+		t.DeadlineOffset = *item.P.DeadlineOffset
 	}
+	applyTime(item.P.DeadlineSuppressionDate, &t.DeadlineSuppressionDate)
+	if item.P.TaskIndex != nil {
+		t.TodayIndex = *item.P.TaskIndex
+	}
+	applyDay(item.P.TaskIR, &t.TodayIndexReferenceDate)
+	if item.P.TagIDs != nil {
+		t.TagIDs = *item.P.TagIDs
+	}
+	if item.P.DelegateIDs != nil {
+		ids := *item.P.DelegateIDs
+		t.DelegateIDs = ids
+	}
+	if item.P.RecurrenceTaskIDs != nil {
+		ids := *item.P.RecurrenceTaskIDs
+		t.RecurrenceTaskIDs = ids
+	}
+	if item.P.Repeater.IsSet() {
+		t.Repeater = item.P.Repeater.Ptr()
+	}
+	applyTime(item.P.InstanceCreationStartDate, &t.InstanceCreationStartDate)
+	if item.P.InstanceCreationPaused != nil {
+		t.InstanceCreationPaused = *item.P.InstanceCreationPaused
+	}
+	if item.P.InstanceCreationCount != nil {
+		t.InstanceCreationCount = *item.P.InstanceCreationCount
+	}
+	applyTime(item.P.AfterCompletionReferenceDate, &t.AfterCompletionReferenceDate)
+	if ato, ok := item.P.AlarmTimeOffset.Get(); ok {
+		offset := time.Duration(ato * float64(time.Second))
+		t.AlarmTimeOffset = &offset
+	} else if item.P.AlarmTimeOffset.IsNull() {
+		t.AlarmTimeOffset = nil
+	}
+	applyTime(item.P.LastAlarmInteractionDate, &t.LastAlarmInteractionDate)
+	if item.P.StartBucket != nil {
+		t.StartBucket = *item.P.StartBucket
+	}
+	t.Extras = t.Extras.Merge(item.P.Extras)
 
 	return t
 }
@@ -117,10 +176,12 @@ func (s *State) updateCheckListItem(item things.CheckListActionItem) *things.Che
 	if item.P.Status != nil {
 		c.Status = *item.P.Status
 	}
+	applyTime(item.P.CompletionDate, &c.CompletionDate)
 	if item.P.TaskIDs != nil {
 		ids := *item.P.TaskIDs
 		c.TaskIDs = ids
 	}
+	c.Extras = c.Extras.Merge(item.P.Extras)
 
 	return c
 }
@@ -135,6 +196,11 @@ func (s *State) updateArea(item things.AreaActionItem) *things.Area {
 	if item.P.Title != nil {
 		a.Title = *item.P.Title
 	}
+	if item.P.TagIDs != nil {
+		a.TagIDs = *item.P.TagIDs
+		a.Tags = s.tagsByID(a.TagIDs)
+	}
+	a.Extras = a.Extras.Merge(item.P.Extras)
 
 	return a
 }
@@ -156,20 +222,122 @@ func (s *State) updateTag(item things.TagActionItem) *things.Tag {
 		var ids = *item.P.ParentTagIDs
 		t.ParentTagIDs = ids
 	}
+	t.Extras = t.Extras.Merge(item.P.Extras)
 
 	return t
 }
 
-// Update applies all items to update the aggregated state
+// tagsByID returns all known tags of ids, keeping their order
+func (s *State) tagsByID(ids []string) []*things.Tag {
+	tags := []*things.Tag{}
+	for _, id := range ids {
+		if tag, ok := s.Tags[id]; ok {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ResolveReferences restores the pointers between objects of a state decoded from JSON,
+// which decodes every referenced object as a separate copy
+func (s *State) ResolveReferences() {
+	s.resolveAreaTags()
+}
+
+// resolveAreaTags updates Area.Tags after tags were created or removed
+func (s *State) resolveAreaTags() {
+	for _, area := range s.Areas {
+		if len(area.TagIDs) != 0 {
+			area.Tags = s.tagsByID(area.TagIDs)
+		}
+	}
+}
+
+func (s *State) updateSettings(item things.SettingsActionItem) *things.Settings {
+	st := s.Settings
+	if st == nil {
+		st = &things.Settings{}
+	}
+	st.UUID = item.UUID()
+
+	if item.P.LogInterval != nil {
+		st.LogInterval = *item.P.LogInterval
+	}
+	applyTime(item.P.ManualLogDate, &st.ManualLogDate)
+	if item.P.GroupTodayByParent != nil {
+		st.GroupTodayByParent = bool(*item.P.GroupTodayByParent)
+	}
+	st.Extras = st.Extras.Merge(item.P.Extras)
+
+	return st
+}
+
+func (s *State) updateUnknown(item unknownItem) *things.Object {
+	o, ok := s.Unknown[item.UUID]
+	if !ok {
+		o = &things.Object{}
+	}
+	o.UUID = item.UUID
+	o.Kind = item.Kind
+	o.Fields = o.Fields.Merge(item.fields)
+
+	return o
+}
+
+// unknownItem is an item of a kind not modelled by the SDK
+type unknownItem struct {
+	things.Item
+	fields things.Extras
+}
+
+// decode unmarshals the payload of an item into the action item of its kind
+func decode(rawItem things.Item) (interface{}, error) {
+	switch rawItem.Kind {
+	case things.ItemKindTask:
+		item := things.TaskActionItem{Item: rawItem}
+		err := json.Unmarshal(rawItem.P, &item.P)
+		return item, err
+	case things.ItemKindChecklistItem:
+		item := things.CheckListActionItem{Item: rawItem}
+		err := json.Unmarshal(rawItem.P, &item.P)
+		return item, err
+	case things.ItemKindArea:
+		item := things.AreaActionItem{Item: rawItem}
+		err := json.Unmarshal(rawItem.P, &item.P)
+		return item, err
+	case things.ItemKindTag:
+		item := things.TagActionItem{Item: rawItem}
+		err := json.Unmarshal(rawItem.P, &item.P)
+		return item, err
+	case things.ItemKindSettings:
+		item := things.SettingsActionItem{Item: rawItem}
+		err := json.Unmarshal(rawItem.P, &item.P)
+		return item, err
+	default:
+		item := unknownItem{Item: rawItem}
+		if len(rawItem.P) == 0 {
+			return item, nil
+		}
+		err := json.Unmarshal(rawItem.P, &item.fields)
+		return item, err
+	}
+}
+
+// Update applies all items to update the aggregated state. All items are decoded before the state
+// is changed, so a batch containing a malformed item is rejected as a whole
 func (s *State) Update(items ...things.Item) error {
-	for _, rawItem := range items {
-		switch rawItem.Kind {
-		case things.ItemKindTask:
-			item := things.TaskActionItem{Item: rawItem}
-			if err := json.Unmarshal(rawItem.P, &item.P); err != nil {
-				return err
-			}
+	decoded := make([]interface{}, len(items))
+	for i, rawItem := range items {
+		item, err := decode(rawItem)
+		if err != nil {
+			return err
+		}
+		decoded[i] = item
+	}
 
+	for _, item := range decoded {
+		switch item := item.(type) {
+		case things.TaskActionItem:
 			switch item.Action {
 			case things.ItemActionCreated:
 				fallthrough
@@ -178,15 +346,10 @@ func (s *State) Update(items ...things.Item) error {
 			case things.ItemActionDeleted:
 				delete(s.Tasks, item.UUID())
 			default:
-				fmt.Printf("Action %q on %q is not implemented yet", item.Action, rawItem.Kind)
-			}
-
-		case things.ItemKindChecklistItem:
-			item := things.CheckListActionItem{Item: rawItem}
-			if err := json.Unmarshal(rawItem.P, &item.P); err != nil {
-				return err
+				fmt.Printf("Action %q on %q is not implemented yet", item.Action, item.Kind)
 			}
 
+		case things.CheckListActionItem:
 			switch item.Action {
 			case things.ItemActionCreated:
 				fallthrough
@@ -195,15 +358,10 @@ func (s *State) Update(items ...things.Item) error {
 			case things.ItemActionDeleted:
 				delete(s.CheckListItems, item.UUID())
 			default:
-				fmt.Printf("Action %q on %q is not implemented yet", item.Action, rawItem.Kind)
-			}
-
-		case things.ItemKindArea:
-			item := things.AreaActionItem{Item: rawItem}
-			if err := json.Unmarshal(rawItem.P, &item.P); err != nil {
-				return err
+				fmt.Printf("Action %q on %q is not implemented yet", item.Action, item.Kind)
 			}
 
+		case things.AreaActionItem:
 			switch item.Action {
 			case things.ItemActionCreated:
 				fallthrough
@@ -213,65 +371,79 @@ func (s *State) Update(items ...things.Item) error {
 			case things.ItemActionDeleted:
 				delete(s.Areas, item.UUID())
 			default:
-				fmt.Printf("Action %q on %q is not implemented yet", item.Action, rawItem.Kind)
-			}
-
-		case things.ItemKindTag:
-			item := things.TagActionItem{Item: rawItem}
-			if err := json.Unmarshal(rawItem.P, &item.P); err != nil {
-				return err
+				fmt.Printf("Action %q on %q is not implemented yet", item.Action, item.Kind)
 			}
 
+		case things.TagActionItem:
 			switch item.Action {
 			case things.ItemActionCreated:
 				fallthrough
 			case things.ItemActionModified:
 				s.Tags[item.UUID()] = s.updateTag(item)
+				s.resolveAreaTags()
 			case things.ItemActionDeleted:
 				delete(s.Tags, item.UUID())
+				s.resolveAreaTags()
+			default:
+				fmt.Printf("Action %q on %q is not implemented yet", item.Action, item.Kind)
+			}
+
+		case things.SettingsActionItem:
+			switch item.Action {
+			case things.ItemActionCreated:
+				fallthrough
+			case things.ItemActionModified:
+				s.Settings = s.updateSettings(item)
+			case things.ItemActionDeleted:
+				s.Settings = nil
 			default:
-				fmt.Printf("Action %q on %q is not implemented yet", item.Action, rawItem.Kind)
+				fmt.Printf("Action %q on %q is not implemented yet", item.Action, item.Kind)
 			}
 
-		default:
-			fmt.Printf("%q is not implemented yet\n", rawItem.Kind)
+		case unknownItem:
+			switch item.Action {
+			case things.ItemActionCreated:
+				fallthrough
+			case things.ItemActionModified:
+				if s.Unknown == nil {
+					s.Unknown = map[string]*things.Object{}
+				}
+				s.Unknown[item.UUID] = s.updateUnknown(item)
+			case things.ItemActionDeleted:
+				delete(s.Unknown, item.UUID)
+			default:
+				fmt.Printf("Action %q on %q is not implemented yet", item.Action, item.Kind)
+			}
 		}
 	}
 	return nil
 }
 
-// Projects returns all projects for this history
-func (s *State) Projects() []*things.Task {
-	tasks := []*things.Task{}
-	for _, task := range s.Tasks {
-		if !task.IsProject {
-			continue
-		}
-		tasks = append(tasks, task)
+// Apply updates the state with items and records index as the server index they were loaded up to
+func (s *State) Apply(index int, items ...things.Item) error {
+	if err := s.Update(items...); err != nil {
+		return err
 	}
-	return tasks
+	s.AppliedIndex = index
+	return nil
 }
 
-// Subtasks returns tasks grouped together with under a root task
-func (s *State) Subtasks(root *things.Task, opts ListOption) []*things.Task {
+// LastIndex returns the server index recorded by Apply
+func (s *State) LastIndex() int {
+	return s.AppliedIndex
+}
+
+// AllTasks returns all tasks, projects and headings ordered by index
+func (s *State) AllTasks(opts ListOption) []*things.Task {
 	tasks := []*things.Task{}
 	for _, task := range s.Tasks {
 		if task.Status == things.TaskStatusCompleted && opts.ExcludeCompleted {
 			continue
 		}
-		if task == root {
-			continue
-		}
 		if task.InTrash && opts.ExcludeInTrash {
 			continue
 		}
-		isChild := false
-		for _, taskID := range task.ParentTaskIDs {
-			isChild = isChild || taskID == root.UUID
-		}
-		if isChild {
-			tasks = append(tasks, task)
-		}
+		tasks = append(tasks, task)
 	}
 	sort.Slice(tasks, func(i, j int) bool {
 		return tasks[i].Index < tasks[j].Index
@@ -279,136 +451,111 @@ func (s *State) Subtasks(root *things.Task, opts ListOption) []*things.Task {
 	return tasks
 }
 
-func hasArea(task *things.Task, state *State) bool {
-	if len(task.AreaIDs) != 0 {
-		return true
-	}
-	if len(task.ParentTaskIDs) == 0 {
-		return false
+// AllAreas returns all areas ordered by title
+func (s *State) AllAreas() []*things.Area {
+	areas := []*things.Area{}
+	for _, area := range s.Areas {
+		areas = append(areas, area)
 	}
-	for _, taskID := range task.ParentTaskIDs {
-		if hasArea(state.Tasks[taskID], state) {
-			return true
+	sort.Slice(areas, func(i, j int) bool {
+		if areas[i].Title == areas[j].Title {
+			return areas[i].UUID < areas[j].UUID
 		}
-	}
-	return false
+		return areas[i].Title < areas[j].Title
+	})
+	return areas
 }
 
-// TasksWithoutArea looks up top level tasks not assigned to any area, e.g. just created and placed in today
-func (s *State) TasksWithoutArea() []*things.Task {
-	tasks := []*things.Task{}
-	for _, task := range s.Tasks {
-		if task.Status == things.TaskStatusCompleted {
-			continue
-		}
-		if len(task.ParentTaskIDs) != 0 {
-			continue
+// AllTags returns all tags ordered by title
+func (s *State) AllTags() []*things.Tag {
+	tags := []*things.Tag{}
+	for _, tag := range s.Tags {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Title == tags[j].Title {
+			return tags[i].UUID < tags[j].UUID
 		}
-		if task.InTrash {
+		return tags[i].Title < tags[j].Title
+	})
+	return tags
+}
+
+// AllCheckListItems returns all check list items ordered by index
+func (s *State) AllCheckListItems(opts ListOption) []*things.CheckListItem {
+	items := []*things.CheckListItem{}
+	for _, item := range s.CheckListItems {
+		if item.Status == things.TaskStatusCompleted && opts.ExcludeCompleted {
 			continue
 		}
-		if !hasArea(task, s) {
-			tasks = append(tasks, task)
-		}
+		items = append(items, item)
 	}
-	sort.Slice(tasks, func(i, j int) bool {
-		return tasks[i].Index < tasks[j].Index
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Index < items[j].Index
 	})
-	return tasks
+	return items
+}
+
+// Task returns the task or project with the given uuid, or nil
+func (s *State) Task(uuid string) *things.Task {
+	return s.Tasks[uuid]
+}
+
+// Area returns the area with the given uuid, or nil
+func (s *State) Area(uuid string) *things.Area {
+	return s.Areas[uuid]
+}
+
+// Tag returns the tag with the given uuid, or nil
+func (s *State) Tag(uuid string) *things.Tag {
+	return s.Tags[uuid]
+}
+
+// CheckListItem returns the check list item with the given uuid, or nil
+func (s *State) CheckListItem(uuid string) *things.CheckListItem {
+	return s.CheckListItems[uuid]
+}
+
+// ListOption allows the result set to be filtered
+type ListOption = state.ListOption
+
+// Projects returns all projects for this history
+func (s *State) Projects() []*things.Task {
+	return state.Projects(s)
+}
+
+// Subtasks returns tasks grouped together with under a root task. Headings are not included,
+// see state.HeadingsByProject
+func (s *State) Subtasks(root *things.Task, opts ListOption) []*things.Task {
+	return state.Subtasks(s, root, opts)
+}
+
+// TasksWithoutArea looks up top level tasks not assigned to any area, e.g. just created and placed in today
+func (s *State) TasksWithoutArea() []*things.Task {
+	return state.TasksWithoutArea(s)
 }
 
 // AreaByName returns an Area if the name matches
 func (s *State) AreaByName(name string) *things.Area {
-	for _, area := range s.Areas {
-		if area.Title == name {
-			return area
-		}
-	}
-	return nil
+	return state.AreaByName(s, name)
 }
 
 // ProjectByName returns an project if the name matches
 func (s *State) ProjectByName(name string) *things.Task {
-	for _, task := range s.Tasks {
-		if !task.IsProject {
-			continue
-		}
-		if task.Title == name {
-			return task
-		}
-	}
-	return nil
-}
-
-// ListOption allows the result set to be filtered
-type ListOption struct {
-	ExcludeCompleted bool
-	ExcludeInTrash   bool
+	return state.ProjectByName(s, name)
 }
 
 // TasksByArea returns tasks associated with a given area
 func (s *State) TasksByArea(area *things.Area, opts ListOption) []*things.Task {
-	tasks := []*things.Task{}
-	for _, task := range s.Tasks {
-		if task.Status == things.TaskStatusCompleted && opts.ExcludeCompleted {
-			continue
-		}
-		if task.InTrash && opts.ExcludeInTrash {
-			continue
-		}
-		isChild := false
-		for _, areaID := range task.AreaIDs {
-			isChild = isChild || areaID == area.UUID
-		}
-		if isChild {
-			tasks = append(tasks, task)
-		}
-	}
-	sort.Slice(tasks, func(i, j int) bool {
-		return tasks[i].Index < tasks[j].Index
-	})
-	return tasks
+	return state.TasksByArea(s, area, opts)
 }
 
 // CheckListItemsByTask returns check lists associated with a particular item
 func (s *State) CheckListItemsByTask(task *things.Task, opts ListOption) []*things.CheckListItem {
-	items := []*things.CheckListItem{}
-	for _, item := range s.CheckListItems {
-		if item.Status == things.TaskStatusCompleted && opts.ExcludeCompleted {
-			continue
-		}
-		isChild := false
-		for _, taskID := range item.TaskIDs {
-			isChild = isChild || task.UUID == taskID
-		}
-		if isChild {
-			items = append(items, item)
-		}
-	}
-	sort.Slice(items, func(i, j int) bool {
-		return items[i].Index < items[j].Index
-	})
-	return items
+	return state.CheckListItemsByTask(s, task, opts)
 }
 
 // SubTags returns all child tags for a given root, ensuring sort order is kept intact
 func (s *State) SubTags(root *things.Tag) []*things.Tag {
-	children := []*things.Tag{}
-	for _, tag := range s.Tags {
-		if tag == root {
-			continue
-		}
-
-		isChild := false
-		for _, parentID := range tag.ParentTagIDs {
-			isChild = isChild || parentID == root.UUID
-		}
-		if isChild {
-			children = append(children, tag)
-		}
-	}
-	sort.Slice(children, func(i, j int) bool {
-		return children[i].ShortHand < children[j].ShortHand
-	})
-	return children
+	return state.SubTags(s, root)
 }
@@ -2,9 +2,12 @@ package memory
 
 import (
 	"encoding/json"
+	"fmt"
 	"testing"
+	"time"
 
 	things "github.com/nicolai86/things-cloud-sdk"
+	"github.com/nicolai86/things-cloud-sdk/state"
 )
 
 func stringVal(str string) *string {
@@ -22,6 +25,12 @@ var newTagPayload = `{
   "pn": []
 }`
 
+var newSettingsPayload = `{
+  "li": 1,
+  "mld": 1495650756.177454,
+  "gtp": 1
+}`
+
 var newCheckListItemPayload = `{
   "md": 1495650756.177454,
   "ix": -543,
@@ -120,6 +129,31 @@ func TestState_Update(t *testing.T) {
 			}
 		})
 
+		t.Run("Create Settings", func(t *testing.T) {
+			t.Parallel()
+			s := NewState()
+			if err := s.Update(things.Item{
+				Action: things.ItemActionCreated,
+				Kind:   things.ItemKindSettings,
+				P:      json.RawMessage(newSettingsPayload),
+			}); err != nil {
+				t.Fatal(err.Error())
+			}
+
+			if s.Settings == nil {
+				t.Fatal("Expected to have settings")
+			}
+			if s.Settings.LogInterval != things.LogIntervalDaily {
+				t.Fatalf("Expected log interval %d, but got %d", things.LogIntervalDaily, s.Settings.LogInterval)
+			}
+			if !s.Settings.GroupTodayByParent {
+				t.Fatal("Expected today to be grouped by parent")
+			}
+			if s.Settings.ManualLogDate == nil {
+				t.Fatal("Expected manual log date to be set")
+			}
+		})
+
 		t.Run("Create Task", func(t *testing.T) {
 			t.Parallel()
 			s := NewState()
@@ -157,10 +191,32 @@ func TestState_Update(t *testing.T) {
 				Action: things.ItemActionCreated,
 				Kind:   things.ItemKindTask,
 				P:      json.RawMessage(newTaskPayload),
+			}, things.Item{
+				Action: things.ItemActionCreated,
+				Kind:   things.ItemKindSettings,
+				P:      json.RawMessage(newSettingsPayload),
 			})
 			return s
 		}
 
+		t.Run("Update Settings", func(t *testing.T) {
+			t.Parallel()
+			s := newState()
+			if err := s.Update(things.Item{
+				Action: things.ItemActionModified,
+				Kind:   things.ItemKindSettings,
+				P:      json.RawMessage(`{"gtp": 0}`),
+			}); err != nil {
+				t.Fatal(err.Error())
+			}
+			if s.Settings.GroupTodayByParent {
+				t.Fatal("Expected grouping to be disabled")
+			}
+			if s.Settings.LogInterval != things.LogIntervalDaily {
+				t.Fatal("Expected log interval to be unchanged")
+			}
+		})
+
 		t.Run("Update Task", func(t *testing.T) {
 			t.Parallel()
 			s := newState()
@@ -362,3 +418,301 @@ func TestState_updateTag(t *testing.T) {
 		})
 	})
 }
+
+var completeTaskPayload = `{
+  "acrd": 1495584000,
+  "ar": ["4D83724E-19B3-41F7-8EF9-287019A05CB7"],
+  "agr": ["8E9A1B47-2DD1-4A30-8B5E-4A5B2C1E0F11"],
+  "ato": 32400,
+  "cd": 1495662927.014228,
+  "dd": 1495843200,
+  "dds": 1495756800,
+  "dl": ["C3E5F9A0-1111-4DAA-9E1D-0F9C2A3B4C5D"],
+  "do": 2,
+  "icc": 3,
+  "icp": true,
+  "icsd": 1495584000,
+  "ix": 7,
+  "lai": 1495616400,
+  "md": 1495662933.606909,
+  "nt": "<note xml:space=\"preserve\">test body pm</note>",
+  "pr": [],
+  "rr": {"ia":1504396800,"rrv":4,"tp":0,"of":[{"dy":0}],"fu":16,"sr":1499644800,"fa":1,"rc":0,"ts":0,"ed":64092211200},
+  "rt": ["AD55F048-9A28-4260-A07B-6BA5C0D39AC9"],
+  "sb": 1,
+  "sp": null,
+  "sr": 1495584000,
+  "ss": 0,
+  "st": 0,
+  "tg": ["CC-Things-Tag-Errand"],
+  "ti": -3,
+  "tir": 1495584000,
+  "tp": 0,
+  "tr": false,
+  "tt": "test"
+}`
+
+func TestState_updateTask(t *testing.T) {
+	var p things.TaskActionItemPayload
+	if err := json.Unmarshal([]byte(completeTaskPayload), &p); err != nil {
+		t.Fatal(err.Error())
+	}
+	s := NewState()
+	task := s.updateTask(things.TaskActionItem{
+		Item: things.Item{UUID: "A"},
+		P:    p,
+	})
+
+	if task.DeadlineOffset != 2 {
+		t.Errorf("Expected deadline offset of %d, but got %d", 2, task.DeadlineOffset)
+	}
+	if task.DeadlineSuppressionDate == nil || task.DeadlineSuppressionDate.Unix() != 1495756800 {
+		t.Errorf("Expected deadline suppression date, but got %v", task.DeadlineSuppressionDate)
+	}
+	if task.TodayIndex != -3 {
+		t.Errorf("Expected today index of %d, but got %d", -3, task.TodayIndex)
+	}
+	if len(task.TagIDs) != 1 || task.TagIDs[0] != "CC-Things-Tag-Errand" {
+		t.Errorf("Expected tags to be set, but got %v", task.TagIDs)
+	}
+	if len(task.DelegateIDs) != 1 {
+		t.Errorf("Expected delegate to be set, but got %v", task.DelegateIDs)
+	}
+	if len(task.RecurrenceTaskIDs) != 1 {
+		t.Errorf("Expected recurrence tasks to be set, but got %v", task.RecurrenceTaskIDs)
+	}
+	if task.Repeater == nil || task.Repeater.FrequencyUnit != things.FrequencyUnitDaily {
+		t.Errorf("Expected daily repeater, but got %v", task.Repeater)
+	}
+	if !task.InstanceCreationPaused || task.InstanceCreationCount != 3 || task.InstanceCreationStartDate == nil {
+		t.Errorf("Expected instance creation details to be set")
+	}
+	if task.AfterCompletionReferenceDate == nil {
+		t.Errorf("Expected after completion reference date to be set")
+	}
+	if task.AlarmTimeOffset == nil || *task.AlarmTimeOffset != 9*time.Hour {
+		t.Errorf("Expected alarm time offset of %s, but got %v", 9*time.Hour, task.AlarmTimeOffset)
+	}
+	if task.LastAlarmInteractionDate == nil {
+		t.Errorf("Expected last alarm interaction date to be set")
+	}
+	if !task.IsEvening() {
+		t.Errorf("Expected task to be scheduled for the evening")
+	}
+}
+
+func TestState_Unknown(t *testing.T) {
+	s := NewState()
+	if err := s.Update(things.Item{
+		UUID:   "A",
+		Action: things.ItemActionCreated,
+		Kind:   things.ItemKind("Heading9"),
+		P:      json.RawMessage(`{"tt":"future","xx":1}`),
+	}, things.Item{
+		UUID:   "A",
+		Action: things.ItemActionModified,
+		Kind:   things.ItemKind("Heading9"),
+		P:      json.RawMessage(`{"tt":"changed"}`),
+	}, things.Item{
+		UUID:   "B",
+		Action: things.ItemActionCreated,
+		Kind:   things.ItemKindTask,
+		P:      json.RawMessage(`{"tt":"task","xx":{"a":1}}`),
+	}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	o := s.Unknown["A"]
+	if o == nil {
+		t.Fatal("Expected unknown object to be kept")
+	}
+	if string(o.Fields["tt"]) != `"changed"` || string(o.Fields["xx"]) != "1" {
+		t.Errorf("Expected fields to be merged, but got %v", o.Fields)
+	}
+	if string(s.Tasks["B"].Extras["xx"]) != `{"a":1}` {
+		t.Errorf("Expected unknown task fields to be kept, but got %v", s.Tasks["B"].Extras)
+	}
+
+	if err := s.Update(things.Item{
+		UUID:   "A",
+		Action: things.ItemActionDeleted,
+		Kind:   things.ItemKind("Heading9"),
+		P:      json.RawMessage(`{}`),
+	}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(s.Unknown) != 0 {
+		t.Fatal("Expected unknown object to be deleted")
+	}
+}
+
+func TestState_updateTaskClearsNullFields(t *testing.T) {
+	s := NewState()
+	if err := s.Update(things.Item{
+		UUID:   "A",
+		Action: things.ItemActionCreated,
+		Kind:   things.ItemKindTask,
+		P:      json.RawMessage(completeTaskPayload),
+	}, things.Item{
+		UUID:   "A",
+		Action: things.ItemActionModified,
+		Kind:   things.ItemKindTask,
+		P:      json.RawMessage(`{"dd":null,"sr":null,"rr":null,"ato":null,"nt":null}`),
+	}); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	task := s.Tasks["A"]
+	if task.DeadlineDate != nil {
+		t.Errorf("Expected deadline to be cleared, but got %v", task.DeadlineDate)
+	}
+	if task.ScheduledDate != nil {
+		t.Errorf("Expected scheduled date to be cleared, but got %v", task.ScheduledDate)
+	}
+	if task.Repeater != nil {
+		t.Errorf("Expected repeater to be cleared, but got %v", task.Repeater)
+	}
+	if task.AlarmTimeOffset != nil {
+		t.Errorf("Expected alarm to be cleared, but got %v", task.AlarmTimeOffset)
+	}
+	if task.Note.Text != "" {
+		t.Errorf("Expected note to be cleared, but got %q", task.Note.Text)
+	}
+	if task.DeadlineSuppressionDate == nil {
+		t.Errorf("Expected unrelated dates to be kept")
+	}
+}
+
+func TestState_updateClearsTags(t *testing.T) {
+	s := NewState()
+	if err := s.Update(things.Item{
+		UUID:   "CC-Things-Tag-Errand",
+		Action: things.ItemActionCreated,
+		Kind:   things.ItemKindTag,
+		P:      json.RawMessage(`{"tt":"Errand"}`),
+	}, things.Item{
+		UUID:   "A",
+		Action: things.ItemActionCreated,
+		Kind:   things.ItemKindTask,
+		P:      json.RawMessage(completeTaskPayload),
+	}, things.Item{
+		UUID:   "B",
+		Action: things.ItemActionCreated,
+		Kind:   things.ItemKindArea,
+		P:      json.RawMessage(`{"tt":"Household","tg":["CC-Things-Tag-Errand"]}`),
+	}, things.Item{
+		UUID:   "A",
+		Action: things.ItemActionModified,
+		Kind:   things.ItemKindTask,
+		P:      json.RawMessage(`{"tt":"renamed"}`),
+	}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(s.Tasks["A"].TagIDs) != 1 {
+		t.Fatalf("Expected tags to be kept if tg is missing, but got %v", s.Tasks["A"].TagIDs)
+	}
+
+	if err := s.Update(things.Item{
+		UUID:   "A",
+		Action: things.ItemActionModified,
+		Kind:   things.ItemKindTask,
+		P:      json.RawMessage(`{"tg":[]}`),
+	}, things.Item{
+		UUID:   "B",
+		Action: things.ItemActionModified,
+		Kind:   things.ItemKindArea,
+		P:      json.RawMessage(`{"tg":[]}`),
+	}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(s.Tasks["A"].TagIDs) != 0 {
+		t.Errorf("Expected task tags to be cleared, but got %v", s.Tasks["A"].TagIDs)
+	}
+	if len(s.Areas["B"].TagIDs) != 0 || len(s.Areas["B"].Tags) != 0 {
+		t.Errorf("Expected area tags to be cleared, but got %v", s.Areas["B"].TagIDs)
+	}
+}
+
+func TestState_Validate(t *testing.T) {
+	s := NewState()
+	s.Tasks["project"] = &things.Task{UUID: "project", Type: things.TaskTypeProject}
+	s.Tasks["task"] = &things.Task{UUID: "task"}
+
+	var refs things.References = s
+	if err := things.NewTask("a").InProject(s.Tasks["project"]).Build().ValidateAgainst(refs); err != nil {
+		t.Fatalf("Expected task in existing project to be valid, got %v", err)
+	}
+	if err := things.NewTask("a").InProject(s.Tasks["task"]).Build().ValidateAgainst(refs); err == nil {
+		t.Fatal("Expected task nested in a task to be rejected")
+	}
+	if err := things.NewCheckListItem("a").InTask(&things.Task{UUID: "missing"}).Build().ValidateAgainst(refs); err == nil {
+		t.Fatal("Expected check list item of unknown task to be rejected")
+	}
+}
+
+// rawItem converts items created by the builders into history items
+func rawItem(t *testing.T, item things.Identifiable) things.Item {
+	bs, err := json.Marshal(item)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var raw things.Item
+	if err := json.Unmarshal(bs, &raw); err != nil {
+		t.Fatal(err.Error())
+	}
+	raw.UUID = item.UUID()
+	return raw
+}
+
+func TestState_Apply(t *testing.T) {
+	var store state.Store = NewState()
+	first := things.NewTask("first").AtIndex(1).Build()
+	second := things.NewTask("second").AtIndex(0).Complete().Build()
+	trashed := things.NewTask("trashed").AtIndex(2).Trash().Build()
+	item := things.NewCheckListItem("item").InTask(&things.Task{UUID: first.UUID()}).Build()
+	if err := store.Apply(3,
+		rawItem(t, first),
+		rawItem(t, second),
+		rawItem(t, trashed),
+		rawItem(t, item),
+		rawItem(t, things.NewArea("Work").Build()),
+		rawItem(t, things.NewArea("Home").Build()),
+		rawItem(t, things.NewTag("Errand").Build()),
+	); err != nil {
+		t.Fatal(err.Error())
+	}
+	if store.LastIndex() != 3 {
+		t.Errorf("Expected index 3, but got %d", store.LastIndex())
+	}
+
+	titles := func(tasks []*things.Task) string {
+		names := []string{}
+		for _, task := range tasks {
+			names = append(names, task.Title)
+		}
+		return fmt.Sprint(names)
+	}
+	if got := titles(store.AllTasks(ListOption{})); got != "[second first trashed]" {
+		t.Errorf("Expected all tasks ordered by index, but got %s", got)
+	}
+	if got := titles(store.AllTasks(ListOption{ExcludeCompleted: true, ExcludeInTrash: true})); got != "[first]" {
+		t.Errorf("Expected pending tasks only, but got %s", got)
+	}
+	if areas := store.AllAreas(); len(areas) != 2 || areas[0].Title != "Home" || areas[1].Title != "Work" {
+		t.Errorf("Expected areas ordered by title, but got %v", areas)
+	}
+	if tags := store.AllTags(); len(tags) != 1 || tags[0].Title != "Errand" {
+		t.Errorf("Expected one tag, but got %v", tags)
+	}
+	if items := store.AllCheckListItems(ListOption{}); len(items) != 1 || store.CheckListItem(item.UUID()) != items[0] {
+		t.Errorf("Expected check list item to be found, but got %v", items)
+	}
+
+	// failing items keep the previous index, so they are loaded again
+	if err := store.Apply(4, things.Item{UUID: "x", Kind: things.ItemKindTask, Action: things.ItemActionCreated, P: json.RawMessage(`[]`)}); err == nil {
+		t.Fatalf("Expected malformed payload to fail")
+	}
+	if store.LastIndex() != 3 {
+		t.Errorf("Expected index to remain 3, but got %d", store.LastIndex())
+	}
+}
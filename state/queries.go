@@ -0,0 +1,489 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	things "github.com/nicolai86/things-cloud-sdk"
+)
+
+// Projects returns all projects ordered by index
+func Projects(s Store) []*things.Task {
+	tasks := []*things.Task{}
+	for _, task := range s.AllTasks(ListOption{}) {
+		if task.Type == things.TaskTypeProject {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// ProjectByName returns the project with the given title, or nil
+func ProjectByName(s Store, name string) *things.Task {
+	for _, task := range Projects(s) {
+		if task.Title == name {
+			return task
+		}
+	}
+	return nil
+}
+
+// AreaByName returns the area with the given title, or nil
+func AreaByName(s Store, name string) *things.Area {
+	for _, area := range s.AllAreas() {
+		if area.Title == name {
+			return area
+		}
+	}
+	return nil
+}
+
+// TagByName returns the tag with the given title, or nil
+func TagByName(s Store, name string) *things.Tag {
+	for _, tag := range s.AllTags() {
+		if tag.Title == name {
+			return tag
+		}
+	}
+	return nil
+}
+
+// Subtasks returns tasks grouped together with under a root task, ordered by index. Headings are not
+// included, see HeadingsByProject
+func Subtasks(s Store, root *things.Task, opts ListOption) []*things.Task {
+	tasks := []*things.Task{}
+	for _, task := range s.AllTasks(opts) {
+		if task.Type == things.TaskTypeHeading || task == root {
+			continue
+		}
+		if contains(task.ParentTaskIDs, root.UUID) {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// HeadingsByProject returns the headings of a project ordered by index
+func HeadingsByProject(s Store, project *things.Task, opts ListOption) []*things.Heading {
+	headings := []*things.Heading{}
+	for _, task := range s.AllTasks(opts) {
+		if heading := task.Heading(); heading != nil && heading.ProjectID == project.UUID {
+			headings = append(headings, heading)
+		}
+	}
+	return headings
+}
+
+// TasksByHeading returns the tasks below a heading ordered by index
+func TasksByHeading(s Store, heading *things.Heading, opts ListOption) []*things.Task {
+	tasks := []*things.Task{}
+	for _, task := range s.AllTasks(opts) {
+		if contains(task.ActionGroupIDs, heading.UUID) {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// TasksByArea returns the tasks and projects of an area ordered by index
+func TasksByArea(s Store, area *things.Area, opts ListOption) []*things.Task {
+	tasks := []*things.Task{}
+	for _, task := range s.AllTasks(opts) {
+		if contains(task.AreaIDs, area.UUID) {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+func hasArea(s Store, task *things.Task) bool {
+	if len(task.AreaIDs) != 0 {
+		return true
+	}
+	if len(task.ParentTaskIDs) == 0 {
+		return false
+	}
+	for _, taskID := range task.ParentTaskIDs {
+		if parent := s.Task(taskID); parent != nil && hasArea(s, parent) {
+			return true
+		}
+	}
+	for _, headingID := range task.ActionGroupIDs {
+		if heading := s.Task(headingID); heading != nil && hasArea(s, heading) {
+			return true
+		}
+	}
+	return false
+}
+
+// TasksWithoutArea looks up top level tasks not assigned to any area, e.g. just created and placed in today
+func TasksWithoutArea(s Store) []*things.Task {
+	tasks := []*things.Task{}
+	for _, task := range s.AllTasks(ListOption{ExcludeCompleted: true, ExcludeInTrash: true}) {
+		if len(task.ParentTaskIDs) != 0 || len(task.ActionGroupIDs) != 0 {
+			continue
+		}
+		if task.Type == things.TaskTypeHeading {
+			continue
+		}
+		if !hasArea(s, task) {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// CheckListItemsByTask returns the check list of a task ordered by index
+func CheckListItemsByTask(s Store, task *things.Task, opts ListOption) []*things.CheckListItem {
+	items := []*things.CheckListItem{}
+	for _, item := range s.AllCheckListItems(opts) {
+		if contains(item.TaskIDs, task.UUID) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// SubTags returns all child tags for a given root, ordered by shorthand
+func SubTags(s Store, root *things.Tag) []*things.Tag {
+	children := []*things.Tag{}
+	for _, tag := range s.AllTags() {
+		if tag.UUID == root.UUID {
+			continue
+		}
+		if contains(tag.ParentTagIDs, root.UUID) {
+			children = append(children, tag)
+		}
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].ShortHand < children[j].ShortHand
+	})
+	return children
+}
+
+// tagsByID returns all known tags of ids, keeping their order
+func tagsByID(s Store, ids []string) []*things.Tag {
+	tags := []*things.Tag{}
+	for _, id := range ids {
+		if tag := s.Tag(id); tag != nil {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// TagsByTask returns the tags assigned to a task
+func TagsByTask(s Store, task *things.Task) []*things.Tag {
+	return tagsByID(s, task.TagIDs)
+}
+
+// InheritedTags returns the tags of a task, including tags inherited from its project, heading and area
+func InheritedTags(s Store, task *things.Task) []*things.Tag {
+	ids := []string{}
+	collectTagIDs(s, task, map[string]bool{}, map[string]bool{}, &ids)
+	return tagsByID(s, ids)
+}
+
+func collectTagIDs(s Store, task *things.Task, seen, visited map[string]bool, ids *[]string) {
+	if visited[task.UUID] {
+		return
+	}
+	visited[task.UUID] = true
+
+	add := func(tagIDs []string) {
+		for _, id := range tagIDs {
+			if !seen[id] {
+				seen[id] = true
+				*ids = append(*ids, id)
+			}
+		}
+	}
+	add(task.TagIDs)
+	for _, areaID := range task.AreaIDs {
+		if area := s.Area(areaID); area != nil {
+			add(area.TagIDs)
+		}
+	}
+	for _, parentID := range append(append([]string{}, task.ParentTaskIDs...), task.ActionGroupIDs...) {
+		if parent := s.Task(parentID); parent != nil {
+			collectTagIDs(s, parent, seen, visited, ids)
+		}
+	}
+}
+
+// DescendantTags returns all tags nested below root, at any depth
+func DescendantTags(s Store, root *things.Tag) []*things.Tag {
+	descendants := []*things.Tag{}
+	visited := map[string]bool{root.UUID: true}
+	queue := []*things.Tag{root}
+	for len(queue) > 0 {
+		children := SubTags(s, queue[0])
+		queue = queue[1:]
+		for _, child := range children {
+			if visited[child.UUID] {
+				continue
+			}
+			visited[child.UUID] = true
+			descendants = append(descendants, child)
+			queue = append(queue, child)
+		}
+	}
+	return descendants
+}
+
+// matchingTagIDs returns the ids of tag and, if requested, all of its descendants
+func matchingTagIDs(s Store, tag *things.Tag, includeDescendants bool) map[string]bool {
+	ids := map[string]bool{tag.UUID: true}
+	if includeDescendants {
+		for _, descendant := range DescendantTags(s, tag) {
+			ids[descendant.UUID] = true
+		}
+	}
+	return ids
+}
+
+// TasksByTag returns tasks and projects tagged with tag, either directly or inherited from their
+// project, heading or area, ordered by index. With includeDescendants, tags nested below tag match as well
+func TasksByTag(s Store, tag *things.Tag, includeDescendants bool) []*things.Task {
+	ids := matchingTagIDs(s, tag, includeDescendants)
+	tasks := []*things.Task{}
+	for _, task := range s.AllTasks(ListOption{}) {
+		if task.Type == things.TaskTypeHeading {
+			continue
+		}
+		for _, t := range InheritedTags(s, task) {
+			if ids[t.UUID] {
+				tasks = append(tasks, task)
+				break
+			}
+		}
+	}
+	return tasks
+}
+
+// AreasByTag returns areas tagged with tag, ordered by title. With includeDescendants, tags nested
+// below tag match as well
+func AreasByTag(s Store, tag *things.Tag, includeDescendants bool) []*things.Area {
+	ids := matchingTagIDs(s, tag, includeDescendants)
+	areas := []*things.Area{}
+	for _, area := range s.AllAreas() {
+		for _, id := range area.TagIDs {
+			if ids[id] {
+				areas = append(areas, area)
+				break
+			}
+		}
+	}
+	return areas
+}
+
+// Today returns all pending tasks and projects scheduled for day or earlier, ordered as shown by things.
+// Repeating templates are skipped, their instances are scheduled instead.
+// day should be the current day in the time zone of the user, e.g. things.TodayIn(loc)
+func Today(s Store, day things.Day) *TodayView {
+	view := &TodayView{
+		Day:     []*things.Task{},
+		Evening: []*things.Task{},
+	}
+	for _, task := range s.AllTasks(ListOption{ExcludeInTrash: true}) {
+		if task.Status != things.TaskStatusPending {
+			continue
+		}
+		if task.Type == things.TaskTypeHeading || task.Schedule == things.TaskScheduleSomeday || task.IsRepeatingTemplate() {
+			continue
+		}
+		if task.ScheduledDate == nil || task.ScheduledDate.After(day) {
+			continue
+		}
+		if task.IsEvening() {
+			view.Evening = append(view.Evening, task)
+		} else {
+			view.Day = append(view.Day, task)
+		}
+	}
+	for _, tasks := range [][]*things.Task{view.Day, view.Evening} {
+		sort.SliceStable(tasks, func(i, j int) bool {
+			return tasks[i].TodayIndex < tasks[j].TodayIndex
+		})
+	}
+	return view
+}
+
+// RemindersDue returns reminders firing within [from, to) in loc, ordered by time.
+// Reminders of completed or trashed tasks, and reminders dismissed after they fired, are skipped
+func RemindersDue(s Store, from, to time.Time, loc *time.Location) []Reminder {
+	reminders := []Reminder{}
+	for _, task := range s.AllTasks(ListOption{ExcludeInTrash: true}) {
+		if task.Status != things.TaskStatusPending {
+			continue
+		}
+		at, ok := task.Reminder(loc)
+		if !ok || at.Before(from) || !at.Before(to) {
+			continue
+		}
+		if task.LastAlarmInteractionDate != nil && !task.LastAlarmInteractionDate.Before(at) {
+			continue
+		}
+		reminders = append(reminders, Reminder{Task: task, At: at})
+	}
+	sort.SliceStable(reminders, func(i, j int) bool {
+		return reminders[i].At.Before(reminders[j].At)
+	})
+	return reminders
+}
+
+// RepeatingTemplates returns all templates of repeating tasks and projects ordered by index
+func RepeatingTemplates(s Store) []*things.Task {
+	templates := []*things.Task{}
+	for _, task := range s.AllTasks(ListOption{}) {
+		if task.IsRepeatingTemplate() {
+			templates = append(templates, task)
+		}
+	}
+	return templates
+}
+
+// Template returns the repeating template instance was created from, or nil
+func Template(s Store, instance *things.Task) *things.Task {
+	id, ok := instance.TemplateID()
+	if !ok {
+		return nil
+	}
+	return s.Task(id)
+}
+
+// Instances returns the tasks created from a repeating template, ordered by their start date
+func Instances(s Store, template *things.Task, opts ListOption) []*things.Task {
+	tasks := []*things.Task{}
+	for _, task := range s.AllTasks(opts) {
+		if id, ok := task.TemplateID(); ok && id == template.UUID {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return scheduledBefore(tasks[i], tasks[j])
+	})
+	return tasks
+}
+
+// scheduledBefore orders tasks by start date, tasks without start date last
+func scheduledBefore(a, b *things.Task) bool {
+	if a.ScheduledDate == nil || b.ScheduledDate == nil {
+		return a.ScheduledDate != nil
+	}
+	if *a.ScheduledDate == *b.ScheduledDate {
+		return a.Index < b.Index
+	}
+	return a.ScheduledDate.Before(*b.ScheduledDate)
+}
+
+// Upcoming returns all pending tasks scheduled within [from, to), ordered by day. Repeating templates
+// contribute their future occurrences as projected entries, unless an instance already exists for that day.
+// Templates with malformed repeat rules return an error wrapping things.ErrInvalidRepeater
+func Upcoming(s Store, from, to things.Day) ([]UpcomingTask, error) {
+	upcoming := []UpcomingTask{}
+	for _, task := range s.AllTasks(ListOption{ExcludeInTrash: true}) {
+		if task.Status != things.TaskStatusPending || task.IsRepeatingTemplate() {
+			continue
+		}
+		if task.Type == things.TaskTypeHeading || task.ScheduledDate == nil {
+			continue
+		}
+		if task.ScheduledDate.Before(from) || !task.ScheduledDate.Before(to) {
+			continue
+		}
+		upcoming = append(upcoming, UpcomingTask{Day: *task.ScheduledDate, Task: task, Template: Template(s, task)})
+	}
+	for _, template := range RepeatingTemplates(s) {
+		if template.Status != things.TaskStatusPending || template.InTrash || template.InstanceCreationPaused {
+			continue
+		}
+		days, err := projectedDays(s, template, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", template.UUID, err)
+		}
+		for _, day := range days {
+			upcoming = append(upcoming, UpcomingTask{Day: day, Template: template})
+		}
+	}
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		if upcoming[i].Day == upcoming[j].Day {
+			return upcoming[i].Task != nil && upcoming[j].Task == nil
+		}
+		return upcoming[i].Day.Before(upcoming[j].Day)
+	})
+	return upcoming, nil
+}
+
+// projectedDays returns the days within [from, to) things will create instances of template on.
+// InstanceCreationStartDate (icsd) is the day of the next instance, earlier occurrences already exist
+func projectedDays(s Store, template *things.Task, from, to things.Day) ([]things.Day, error) {
+	instances := Instances(s, template, ListOption{})
+	next := from
+	if template.InstanceCreationStartDate != nil {
+		if icsd := things.DayOf(*template.InstanceCreationStartDate); icsd.After(next) {
+			next = icsd
+		}
+	}
+	exists := map[things.Day]bool{}
+	for _, instance := range instances {
+		if instance.ScheduledDate != nil {
+			exists[*instance.ScheduledDate] = true
+		}
+	}
+
+	days := []things.Day{}
+	rc := *template.Repeater
+	if rc.IsAfterCompletion() {
+		// the next occurrence depends on the completion of the pending instance
+		for _, instance := range instances {
+			if instance.Status == things.TaskStatusPending && !instance.InTrash {
+				return days, nil
+			}
+		}
+		var day things.Day
+		if template.InstanceCreationStartDate != nil {
+			day = things.DayOf(*template.InstanceCreationStartDate)
+		} else if template.AfterCompletionReferenceDate != nil {
+			// acrd is the completion date of the last instance
+			day = things.DayOf(rc.NextScheduledAtAfterCompletion(*template.AfterCompletionReferenceDate, len(instances)))
+		}
+		if !day.IsZero() && !day.Before(from) && day.Before(to) && !exists[day] {
+			days = append(days, day)
+		}
+		return days, nil
+	}
+
+	// things creates instances on the days matching the pattern, even if the first scheduled date does not
+	if err := rc.Normalize(); err != nil {
+		return nil, err
+	}
+	it, err := rc.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := it.Next()
+		if !ok {
+			return days, nil
+		}
+		day := things.DayOf(t)
+		if !day.Before(to) {
+			return days, nil
+		}
+		if day.Before(next) || exists[day] {
+			continue
+		}
+		days = append(days, day)
+	}
+}
+
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,362 @@
+package state_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	things "github.com/nicolai86/things-cloud-sdk"
+	"github.com/nicolai86/things-cloud-sdk/state"
+	"github.com/nicolai86/things-cloud-sdk/state/memory"
+)
+
+// rawItem converts items created by the builders into history items
+func rawItem(t *testing.T, item things.Identifiable) things.Item {
+	bs, err := json.Marshal(item)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var raw things.Item
+	if err := json.Unmarshal(bs, &raw); err != nil {
+		t.Fatal(err.Error())
+	}
+	raw.UUID = item.UUID()
+	return raw
+}
+
+func TestHeadingsByProject(t *testing.T) {
+	s := memory.NewState()
+	apply := func(item things.TaskActionItem) *things.Task {
+		if err := s.Update(rawItem(t, item)); err != nil {
+			t.Fatal(err.Error())
+		}
+		return s.Tasks[item.UUID()]
+	}
+	project := apply(things.NewProject("project").Build())
+	heading := apply(things.NewHeading("heading", project).AtIndex(1).Build())
+	other := apply(things.NewHeading("other", project).AtIndex(0).Build())
+	task := apply(things.NewTask("task").UnderHeading(heading.Heading()).Build())
+	apply(things.NewTask("loose").InProject(project).Build())
+
+	headings := state.HeadingsByProject(s, project, state.ListOption{})
+	if len(headings) != 2 || headings[0].UUID != other.UUID || headings[1].UUID != heading.UUID {
+		t.Fatalf("Expected both headings in order, but got %v", headings)
+	}
+	if headings[1].ProjectID != project.UUID || headings[1].Title != "heading" {
+		t.Errorf("Expected heading of project, but got %#v", headings[1])
+	}
+
+	tasks := state.TasksByHeading(s, headings[1], state.ListOption{})
+	if len(tasks) != 1 || tasks[0] != task {
+		t.Fatalf("Expected task below heading, but got %v", tasks)
+	}
+	if tasks := state.TasksByHeading(s, headings[0], state.ListOption{}); len(tasks) != 0 {
+		t.Fatalf("Expected no tasks below other heading, but got %v", tasks)
+	}
+
+	for _, subtask := range state.Subtasks(s, project, state.ListOption{}) {
+		if subtask.Type == things.TaskTypeHeading {
+			t.Errorf("Expected subtasks not to contain headings")
+		}
+	}
+	for _, task := range state.TasksWithoutArea(s) {
+		if task.Type == things.TaskTypeHeading || len(task.ActionGroupIDs) != 0 {
+			t.Errorf("Expected %q not to be listed as top level task", task.Title)
+		}
+	}
+}
+
+func TestTasksByTag(t *testing.T) {
+	s := memory.NewState()
+	errand := things.NewTag("Errand").Build()
+	shopping := things.NewTag("Shopping").InParent(&things.Tag{UUID: errand.UUID()}).Build()
+	home := things.NewTag("Home").Build()
+	area := things.NewArea("Household").WithTags(&things.Tag{UUID: home.UUID()}).Build()
+	project := things.NewProject("Groceries").InArea(&things.Area{UUID: area.UUID()}).Build()
+	tagged := things.NewTask("milk").InProject(&things.Task{UUID: project.UUID()}).WithTags(&things.Tag{UUID: shopping.UUID()}).Build()
+	errandTask := things.NewTask("post office").WithTags(&things.Tag{UUID: errand.UUID()}).Build()
+	untagged := things.NewTask("call mom").Build()
+
+	// areas may be created before their tags
+	if err := s.Update(
+		rawItem(t, area),
+		rawItem(t, errand),
+		rawItem(t, shopping),
+		rawItem(t, home),
+		rawItem(t, project),
+		rawItem(t, tagged),
+		rawItem(t, errandTask),
+		rawItem(t, untagged),
+	); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	a := s.Areas[area.UUID()]
+	if len(a.Tags) != 1 || a.Tags[0].Title != "Home" {
+		t.Fatalf("Expected area to be tagged with Home, but got %v", a.Tags)
+	}
+
+	names := func(tasks []*things.Task) []string {
+		titles := []string{}
+		for _, task := range tasks {
+			titles = append(titles, task.Title)
+		}
+		sort.Strings(titles)
+		return titles
+	}
+	testCases := []struct {
+		Tag                string
+		IncludeDescendants bool
+		Expected           []string
+	}{
+		{"Errand", false, []string{"post office"}},
+		{"Errand", true, []string{"milk", "post office"}},
+		{"Shopping", true, []string{"milk"}},
+		{"Home", false, []string{"Groceries", "milk"}},
+	}
+	for _, testCase := range testCases {
+		tasks := state.TasksByTag(s, state.TagByName(s, testCase.Tag), testCase.IncludeDescendants)
+		if fmt.Sprint(names(tasks)) != fmt.Sprint(testCase.Expected) {
+			t.Errorf("Expected %s (descendants %v) to match %v, but got %v", testCase.Tag, testCase.IncludeDescendants, testCase.Expected, names(tasks))
+		}
+	}
+
+	inherited := state.InheritedTags(s, s.Tasks[tagged.UUID()])
+	if len(inherited) != 2 || inherited[0].Title != "Shopping" || inherited[1].Title != "Home" {
+		t.Errorf("Expected own and inherited tags, but got %v", inherited)
+	}
+	if areas := state.AreasByTag(s, state.TagByName(s, "Home"), false); len(areas) != 1 {
+		t.Errorf("Expected one area tagged with Home, but got %v", areas)
+	}
+
+	if err := s.Update(rawItem(t, things.DeleteTag(home.UUID()))); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(a.Tags) != 0 {
+		t.Errorf("Expected deleted tag to be removed from area, but got %v", a.Tags)
+	}
+}
+
+func TestToday(t *testing.T) {
+	s := memory.NewState()
+	today := things.NewDay(2017, time.May, 27)
+	items := []things.TaskActionItem{
+		things.NewTask("day").ScheduledOn(today).Build(),
+		things.NewTask("overdue").ScheduledOn(today.AddDays(-2)).Build(),
+		things.NewTask("evening").ThisEvening().ScheduledOn(today).Build(),
+		things.NewTask("tomorrow").ScheduledOn(today.AddDays(1)).Build(),
+		things.NewTask("someday").ScheduledOn(today).Someday().Build(),
+		things.NewTask("done").ScheduledOn(today).Complete().Build(),
+		things.NewTask("anytime").Build(),
+		things.NewTask("template").ScheduledOn(today).Build(),
+	}
+	rc, err := things.ParseRRULE("FREQ=DAILY")
+	if err != nil {
+		t.Fatalf("Expected rule, but got %v", err)
+	}
+	// repeating templates are not shown, only the instances created from them
+	items[len(items)-1].P.Repeater = things.Some(rc)
+	for i, item := range items {
+		index := len(items) - i
+		item.P.TaskIndex = &index
+		if err := s.Update(rawItem(t, item)); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	view := state.Today(s, today)
+	titles := func(tasks []*things.Task) []string {
+		ts := []string{}
+		for _, task := range tasks {
+			ts = append(ts, task.Title)
+		}
+		return ts
+	}
+	if fmt.Sprint(titles(view.Day)) != "[overdue day]" {
+		t.Errorf("Expected day section ordered by today index, but got %v", titles(view.Day))
+	}
+	if fmt.Sprint(titles(view.Evening)) != "[evening]" {
+		t.Errorf("Expected evening section, but got %v", titles(view.Evening))
+	}
+}
+
+func TestRemindersDue(t *testing.T) {
+	s := memory.NewState()
+	day := time.Date(2017, time.May, 27, 0, 0, 0, 0, time.UTC)
+	items := []things.TaskActionItem{
+		things.NewTask("morning").RemindAt(day.Add(9 * time.Hour)).Build(),
+		things.NewTask("evening").RemindAt(day.Add(20 * time.Hour)).Build(),
+		things.NewTask("tomorrow").RemindAt(day.Add(33 * time.Hour)).Build(),
+		things.NewTask("done").RemindAt(day.Add(10 * time.Hour)).Complete().Build(),
+		things.NewTask("dismissed").RemindAt(day.Add(11 * time.Hour)).Build(),
+		things.NewTask("no reminder").ScheduledFor(day).Build(),
+	}
+	items[4].P.LastAlarmInteractionDate = things.Some(things.Timestamp(day.Add(11*time.Hour + time.Minute)))
+	for _, item := range items {
+		if err := s.Update(rawItem(t, item)); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	reminders := state.RemindersDue(s, day, day.Add(24*time.Hour), time.UTC)
+	if len(reminders) != 2 {
+		t.Fatalf("Expected 2 reminders, but got %d", len(reminders))
+	}
+	if reminders[0].Task.Title != "morning" || !reminders[0].At.Equal(day.Add(9*time.Hour)) {
+		t.Errorf("Expected morning reminder first, but got %q at %v", reminders[0].Task.Title, reminders[0].At)
+	}
+	if reminders[1].Task.Title != "evening" {
+		t.Errorf("Expected evening reminder second, but got %q", reminders[1].Task.Title)
+	}
+}
+
+func TestUpcoming(t *testing.T) {
+	s := memory.NewState()
+	apply := func(item things.TaskActionItem) {
+		if err := s.Update(rawItem(t, item)); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	rc, err := things.ParseRRULE("FREQ=WEEKLY;BYDAY=MO")
+	if err != nil {
+		t.Fatalf("Expected rule, but got %v", err)
+	}
+	first := things.Timestamp(time.Date(2018, time.April, 30, 0, 0, 0, 0, time.UTC))
+	rc.FirstScheduledAt = &first
+
+	template := things.NewTask("weekly review").Build()
+	template.P.Repeater = things.Some(rc)
+	template.P.InstanceCreationStartDate = things.Some(things.Timestamp(time.Date(2018, time.May, 14, 0, 0, 0, 0, time.UTC)))
+	apply(template)
+
+	instance := things.NewTask("weekly review").ScheduledOn(things.NewDay(2018, time.May, 7)).Build()
+	instance.P.RecurrenceTaskIDs = &[]string{template.UUID()}
+	apply(instance)
+	apply(things.NewTask("dentist").ScheduledOn(things.NewDay(2018, time.May, 9)).Build())
+
+	if got := state.Template(s, s.Tasks[instance.UUID()]); got == nil || got.UUID != template.UUID() {
+		t.Fatalf("Expected instance to link to its template, but got %v", got)
+	}
+	if instances := state.Instances(s, s.Tasks[template.UUID()], state.ListOption{}); len(instances) != 1 {
+		t.Fatalf("Expected 1 instance, but got %d", len(instances))
+	}
+
+	upcoming, err := state.Upcoming(s, things.NewDay(2018, time.May, 1), things.NewDay(2018, time.June, 1))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []struct {
+		Day       string
+		Title     string
+		Projected bool
+	}{
+		{"2018-05-07", "weekly review", false},
+		{"2018-05-09", "dentist", false},
+		{"2018-05-14", "weekly review", true},
+		{"2018-05-21", "weekly review", true},
+		{"2018-05-28", "weekly review", true},
+	}
+	if len(upcoming) != len(expected) {
+		t.Fatalf("Expected %d upcoming tasks, but got %d", len(expected), len(upcoming))
+	}
+	for i, e := range expected {
+		u := upcoming[i]
+		var title string
+		if u.Task != nil {
+			title = u.Task.Title
+		} else {
+			title = u.Template.Title
+		}
+		if u.Day.String() != e.Day || title != e.Title || (u.Task == nil) != e.Projected {
+			t.Errorf("Expected %s %q (projected %v), but got %s %q (projected %v)", e.Day, e.Title, e.Projected, u.Day, title, u.Task == nil)
+		}
+	}
+
+	paused := s.Tasks[template.UUID()]
+	paused.InstanceCreationPaused = true
+	if upcoming, _ := state.Upcoming(s, things.NewDay(2018, time.May, 1), things.NewDay(2018, time.June, 1)); len(upcoming) != 2 {
+		t.Fatalf("Expected paused templates not to be projected, but got %d upcoming tasks", len(upcoming))
+	}
+}
+
+func TestUpcoming_InvalidRules(t *testing.T) {
+	s := memory.NewState()
+	apply := func(item things.TaskActionItem) {
+		if err := s.Update(rawItem(t, item)); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	rc, err := things.ParseRRULE("FREQ=WEEKLY;BYDAY=MO")
+	if err != nil {
+		t.Fatalf("Expected rule, but got %v", err)
+	}
+	// a wednesday, things creates the first instance on the following monday
+	first := things.Timestamp(time.Date(2018, time.May, 2, 0, 0, 0, 0, time.UTC))
+	rc.FirstScheduledAt = &first
+	template := things.NewTask("weekly review").Build()
+	template.P.Repeater = things.Some(rc)
+	apply(template)
+
+	upcoming, err := state.Upcoming(s, things.NewDay(2018, time.May, 1), things.NewDay(2018, time.May, 15))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(upcoming) != 2 || upcoming[0].Day.String() != "2018-05-07" || upcoming[1].Day.String() != "2018-05-14" {
+		t.Fatalf("Expected occurrences of off-pattern rules on matching days, but got %v", upcoming)
+	}
+
+	malformed := things.NewTask("malformed").Build()
+	malformed.P.Repeater = things.Some(things.RepeaterConfiguration{FirstScheduledAt: &first, FrequencyUnit: things.FrequencyUnitWeekly})
+	apply(malformed)
+	if _, err := state.Upcoming(s, things.NewDay(2018, time.May, 1), things.NewDay(2018, time.May, 15)); !errors.Is(err, things.ErrInvalidRepeater) {
+		t.Fatalf("Expected %v, but got %v", things.ErrInvalidRepeater, err)
+	}
+}
+
+func TestUpcoming_AfterCompletion(t *testing.T) {
+	s := memory.NewState()
+	apply := func(item things.TaskActionItem) {
+		if err := s.Update(rawItem(t, item)); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	count := int64(2)
+	first := things.Timestamp(time.Date(2018, time.May, 1, 0, 0, 0, 0, time.UTC))
+	end := things.Timestamp(time.Date(4001, time.January, 1, 0, 0, 0, 0, time.UTC))
+	template := things.NewTask("water plants").Build()
+	template.P.Repeater = things.Some(things.RepeaterConfiguration{
+		FirstScheduledAt:   &first,
+		Mode:               things.RepeatModeAfterCompletion,
+		FrequencyUnit:      things.FrequencyUnitDaily,
+		FrequencyAmplitude: 3,
+		RepeatCount:        &count,
+		LastScheduledAt:    &end,
+	})
+	template.P.AfterCompletionReferenceDate = things.Some(things.Timestamp(time.Date(2018, time.May, 2, 18, 0, 0, 0, time.UTC)))
+	apply(template)
+
+	instance := things.NewTask("water plants").ScheduledOn(things.NewDay(2018, time.May, 1)).Complete().Build()
+	instance.P.RecurrenceTaskIDs = &[]string{template.UUID()}
+	apply(instance)
+
+	upcoming, err := state.Upcoming(s, things.NewDay(2018, time.May, 1), things.NewDay(2018, time.June, 1))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(upcoming) != 1 || upcoming[0].Day.String() != "2018-05-05" {
+		t.Fatalf("Expected next occurrence 3 days after completion, but got %v", upcoming)
+	}
+
+	second := things.NewTask("water plants").ScheduledOn(things.NewDay(2018, time.May, 5)).Complete().Build()
+	second.P.RecurrenceTaskIDs = &[]string{template.UUID()}
+	apply(second)
+	if upcoming, _ := state.Upcoming(s, things.NewDay(2018, time.May, 1), things.NewDay(2018, time.June, 1)); len(upcoming) != 0 {
+		t.Fatalf("Expected no occurrence after %d repeats, but got %v", count, upcoming)
+	}
+}
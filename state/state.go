@@ -0,0 +1,83 @@
+// Package state describes stores aggregating history items into tasks, areas, tags and check list items.
+// Backends live in subpackages, e.g. state/memory
+package state
+
+import (
+	"time"
+
+	things "github.com/nicolai86/things-cloud-sdk"
+)
+
+// ListOption allows the result set to be filtered
+type ListOption struct {
+	ExcludeCompleted bool
+	ExcludeInTrash   bool
+}
+
+// TodayView describes the today list, split into the regular and the "This Evening" section
+type TodayView struct {
+	Day     []*things.Task
+	Evening []*things.Task
+}
+
+// Reminder describes when the reminder of a task fires
+type Reminder struct {
+	Task *things.Task
+	At   time.Time
+}
+
+// UpcomingTask is a task scheduled within the upcoming view. Task is nil for occurrences projected from
+// Template which things has not created yet
+type UpcomingTask struct {
+	Day      things.Day
+	Task     *things.Task
+	Template *things.Task
+}
+
+// Store is created by applying all history items in order. Callers only depending on Store
+// can swap backends, e.g. to persist the aggregated state between runs.
+// Lookups return nil for unknown UUIDs, so every Store satisfies things.References.
+// Derived views, e.g. Today or TasksByTag, are functions built on top of Store.
+type Store interface {
+	// Apply applies items in order. index is the server index the items were loaded up to,
+	// which is recorded once all items are applied
+	Apply(index int, items ...things.Item) error
+	// LastIndex returns the index recorded by the last Apply, the start index of the next items to load
+	LastIndex() int
+
+	// Task returns the task or project with the given uuid
+	Task(uuid string) *things.Task
+	// Area returns the area with the given uuid
+	Area(uuid string) *things.Area
+	// Tag returns the tag with the given uuid
+	Tag(uuid string) *things.Tag
+	// CheckListItem returns the check list item with the given uuid
+	CheckListItem(uuid string) *things.CheckListItem
+
+	// AllTasks returns all tasks, projects and headings ordered by index
+	AllTasks(opts ListOption) []*things.Task
+	// AllAreas returns all areas ordered by title
+	AllAreas() []*things.Area
+	// AllTags returns all tags ordered by title
+	AllTags() []*things.Tag
+	// AllCheckListItems returns all check list items ordered by index
+	AllCheckListItems(opts ListOption) []*things.CheckListItem
+}
+
+// Sync applies all items added to the history since the last index of store. Items are applied
+// page by page, so an interrupted sync resumes after the last applied page
+func Sync(store Store, h *things.History) error {
+	h.LoadedServerIndex = store.LastIndex()
+	for {
+		items, hasMoreItems, err := h.Items(things.ItemsOptions{StartIndex: h.LoadedServerIndex})
+		if err != nil {
+			return err
+		}
+		if err := store.Apply(h.LoadedServerIndex, items...); err != nil {
+			return err
+		}
+		if !hasMoreItems || len(items) == 0 {
+			return nil
+		}
+	}
+}
@@ -1,9 +1,10 @@
 package thingscloud
 
-//go:generate stringer -type ItemAction,TaskStatus,TaskSchedule
+//go:generate stringer -type ItemAction,TaskStatus,TaskSchedule,TaskType,StartBucket
 
 import (
 	"encoding/json"
+	"math"
 	"time"
 )
 
@@ -43,6 +44,28 @@ const (
 	TaskStatusCanceled TaskStatus = 2
 )
 
+// StartBucket describes in which section of the today list a task is shown
+type StartBucket int
+
+const (
+	// StartBucketDay shows the task in the regular today section
+	StartBucketDay StartBucket = 0
+	// StartBucketEvening shows the task in the "This Evening" section
+	StartBucketEvening StartBucket = 1
+)
+
+// TaskType describes what kind of Task6 item a task is
+type TaskType int
+
+const (
+	// TaskTypeTask indicates a regular to-do
+	TaskTypeTask TaskType = 0
+	// TaskTypeProject indicates a project, containing tasks and headings
+	TaskTypeProject TaskType = 1
+	// TaskTypeHeading indicates a heading, grouping tasks within a project
+	TaskTypeHeading TaskType = 2
+)
+
 // ItemKind describes the different types things cloud supports
 type ItemKind string
 
@@ -59,6 +82,13 @@ var (
 	ItemKindTag ItemKind = "Tag3"
 )
 
+// Object describes the aggregated state of an item whose kind is not modelled by this SDK
+type Object struct {
+	UUID   string
+	Kind   ItemKind
+	Fields Extras
+}
+
 // Timestamp allows unix epochs represented as float or ints to be unmarshalled
 // into time.Time objects
 type Timestamp time.Time
@@ -69,14 +99,18 @@ func (t *Timestamp) UnmarshalJSON(bs []byte) error {
 	if err := json.Unmarshal(bs, &d); err != nil {
 		return err
 	}
-	*t = Timestamp(time.Unix(int64(d), 0).UTC())
+	// things writes fractional seconds with microsecond precision
+	*t = Timestamp(time.UnixMicro(int64(math.Round(d * 1e6))).UTC())
 	return nil
 }
 
-// MarshalJSON convers a timestamp into unix nano representation
+// MarshalJSON convers a timestamp into unix epoch representation, keeping fractional seconds
 func (t *Timestamp) MarshalJSON() ([]byte, error) {
-	var tt = time.Time(*t).Unix()
-	return json.Marshal(tt)
+	tt := time.Time(*t)
+	if tt.Nanosecond() == 0 {
+		return json.Marshal(tt.Unix())
+	}
+	return json.Marshal(float64(tt.UnixMicro()) / 1e6)
 }
 
 // Format returns a textual representation of the time value formatted according to layout
@@ -149,47 +183,127 @@ func (b *Boolean) MarshalJSON() ([]byte, error) {
 // 33|nextInstanceStartDate|REAL|0||0
 // 34|dueDateSuppressionDate|REAL|0||0
 type Task struct {
+	UUID                         string
+	CreationDate                 time.Time
+	ModificationDate             *time.Time
+	Status                       TaskStatus
+	Title                        string
+	Note                         Note
+	ScheduledDate                *Day
+	CompletionDate               *time.Time
+	DeadlineDate                 *Day
+	DeadlineOffset               int
+	DeadlineSuppressionDate      *time.Time
+	Index                        int
+	TodayIndex                   int
+	TodayIndexReferenceDate      *Day
+	AreaIDs                      []string
+	ParentTaskIDs                []string
+	ActionGroupIDs               []string
+	TagIDs                       []string
+	DelegateIDs                  []string
+	RecurrenceTaskIDs            []string
+	Repeater                     *RepeaterConfiguration
+	InstanceCreationStartDate    *time.Time
+	InstanceCreationPaused       bool
+	InstanceCreationCount        int
+	AfterCompletionReferenceDate *time.Time
+	AlarmTimeOffset              *time.Duration
+	LastAlarmInteractionDate     *time.Time
+	InTrash                      bool
+	Schedule                     TaskSchedule
+	Type                         TaskType
+	StartBucket                  StartBucket
+	Extras                       Extras
+}
+
+// IsEvening reports whether the task is shown in the "This Evening" section of today
+func (t *Task) IsEvening() bool {
+	return t.StartBucket == StartBucketEvening
+}
+
+// IsRepeatingTemplate reports whether the task is the template of a repeating task. Things never shows
+// templates directly, but creates instances from them according to their Repeater
+func (t *Task) IsRepeatingTemplate() bool {
+	return t.Repeater != nil
+}
+
+// TemplateID returns the uuid of the repeating template the task was created from, if any
+func (t *Task) TemplateID() (string, bool) {
+	if len(t.RecurrenceTaskIDs) == 0 || t.IsRepeatingTemplate() {
+		return "", false
+	}
+	return t.RecurrenceTaskIDs[0], true
+}
+
+// Heading groups tasks within a project. Things stores headings as tasks of type TaskTypeHeading,
+// tasks reference their heading via ActionGroupIDs.
+type Heading struct {
 	UUID             string
 	CreationDate     time.Time
 	ModificationDate *time.Time
 	Status           TaskStatus
 	Title            string
-	Note             string
-	ScheduledDate    *time.Time
-	CompletionDate   *time.Time
-	DeadlineDate     *time.Time
 	Index            int
-	AreaIDs          []string
-	ParentTaskIDs    []string
-	ActionGroupIDs   []string
+	ProjectID        string
 	InTrash          bool
-	Schedule         TaskSchedule
-	IsProject        bool
+}
+
+// Heading returns the heading described by the task, or nil if the task is no heading
+func (t *Task) Heading() *Heading {
+	if t.Type != TaskTypeHeading {
+		return nil
+	}
+	h := &Heading{
+		UUID:             t.UUID,
+		CreationDate:     t.CreationDate,
+		ModificationDate: t.ModificationDate,
+		Status:           t.Status,
+		Title:            t.Title,
+		Index:            t.Index,
+		InTrash:          t.InTrash,
+	}
+	if len(t.ParentTaskIDs) > 0 {
+		h.ProjectID = t.ParentTaskIDs[0]
+	}
+	return h
 }
 
 // TaskActionItemPayload describes the payload for modifying Tasks, and also Projects,
-// as projects are special kind of Tasks
+// as projects are special kind of Tasks.
+// Nullable fields use Optional, so they can be left unchanged or cleared explicitly.
 type TaskActionItemPayload struct {
-	Index             *int                   `json:"ix,omitempty"`
-	CreationDate      *Timestamp             `json:"cd,omitempty"`
-	ModificationDate  *Timestamp             `json:"md,omitempty"` // ok
-	ScheduledDate     *Timestamp             `json:"sr,omitempty"`
-	CompletionDate    *Timestamp             `json:"sp,omitempty"`
-	DeadlineDate      *Timestamp             `json:"dd,omitempty"`  //
-	TaskIR            *Timestamp             `json:"tir,omitempty"` // hm, not sure what tir stands for
-	Status            *TaskStatus            `json:"ss,omitempty"`
-	IsProject         *Boolean               `json:"tp,omitempty"`
-	Title             *string                `json:"tt,omitempty"`
-	Note              *string                `json:"nt,omitempty"`
-	AreaIDs           *[]string              `json:"ar,omitempty"`
-	ParentTaskIDs     *[]string              `json:"pr,omitempty"`
-	TagIDs            []string               `json:"tg,omitempty"`
-	InTrash           *bool                  `json:"tr,omitempty"`
-	TaskIndex         *int                   `json:"ti,omitempty"`
-	RecurrenceTaskIDs *[]string              `json:"rt,omitempty"`
-	Schedule          *TaskSchedule          `json:"st,omitempty"`
-	ActionGroupIDs    *[]string              `json:"agr,omitempty"`
-	Repeater          *RepeaterConfiguration `json:"rr,omitempty"`
+	Index                        *int                            `json:"ix,omitempty"`
+	CreationDate                 *Timestamp                      `json:"cd,omitempty"`
+	ModificationDate             *Timestamp                      `json:"md,omitempty"` // ok
+	ScheduledDate                Optional[Day]                   `json:"sr"`
+	CompletionDate               Optional[Timestamp]             `json:"sp"`
+	DeadlineDate                 Optional[Day]                   `json:"dd"`
+	DeadlineOffset               *int                            `json:"do,omitempty"` // due date offset
+	DeadlineSuppressionDate      Optional[Timestamp]             `json:"dds"`          // due date suppression date
+	TaskIR                       Optional[Day]                   `json:"tir"`          // today index reference date
+	Status                       *TaskStatus                     `json:"ss,omitempty"`
+	Type                         *TaskType                       `json:"tp,omitempty"`
+	Title                        *string                         `json:"tt,omitempty"`
+	Note                         Optional[Note]                  `json:"nt"`
+	AreaIDs                      *[]string                       `json:"ar,omitempty"`
+	ParentTaskIDs                *[]string                       `json:"pr,omitempty"`
+	TagIDs                       *[]string                       `json:"tg,omitempty"`
+	DelegateIDs                  *[]string                       `json:"dl,omitempty"`
+	InTrash                      *bool                           `json:"tr,omitempty"`
+	TaskIndex                    *int                            `json:"ti,omitempty"`
+	RecurrenceTaskIDs            *[]string                       `json:"rt,omitempty"`
+	Schedule                     *TaskSchedule                   `json:"st,omitempty"`
+	ActionGroupIDs               *[]string                       `json:"agr,omitempty"`
+	Repeater                     Optional[RepeaterConfiguration] `json:"rr"`
+	InstanceCreationStartDate    Optional[Timestamp]             `json:"icsd"`
+	InstanceCreationPaused       *bool                           `json:"icp,omitempty"`
+	InstanceCreationCount        *int                            `json:"icc,omitempty"`
+	AfterCompletionReferenceDate Optional[Timestamp]             `json:"acrd"` // completion date after completion rules are based on
+	AlarmTimeOffset              Optional[float64]               `json:"ato"`  // seconds since the start of the scheduled day
+	LastAlarmInteractionDate     Optional[Timestamp]             `json:"lai"`
+	StartBucket                  *StartBucket                    `json:"sb,omitempty"`
+	Extras                       Extras                          `json:"-"`
 	//  {
 	//      "acrd": null,
 	//      "ar": [],
@@ -246,14 +360,16 @@ type Tag struct {
 	Title        string
 	ParentTagIDs []string
 	ShortHand    string
+	Extras       Extras
 }
 
 // TagActionItemPayload describes the payload for modifying Areas
 type TagActionItemPayload struct {
-	IX           *int      `json:"ix"`
-	Title        *string   `json:"tt"`
-	ShortHand    *string   `json:"sh"`
-	ParentTagIDs *[]string `json:"pn"`
+	IX           *int      `json:"ix,omitempty"`
+	Title        *string   `json:"tt,omitempty"`
+	ShortHand    *string   `json:"sh,omitempty"`
+	ParentTagIDs *[]string `json:"pn,omitempty"`
+	Extras       Extras    `json:"-"`
 }
 
 // TagActionItem describes an event on a tag
@@ -267,12 +383,54 @@ func (t TagActionItem) UUID() string {
 	return t.Item.UUID
 }
 
-// Setting describes things settings
+// LogInterval describes when completed tasks are moved to the logbook
+type LogInterval int
+
+const (
+	// LogIntervalImmediately moves completed tasks to the logbook right away
+	LogIntervalImmediately LogInterval = 0
+	// LogIntervalDaily moves completed tasks to the logbook once a day
+	LogIntervalDaily LogInterval = 1
+	// LogIntervalManually keeps completed tasks until they are logged manually
+	LogIntervalManually LogInterval = 2
+)
+
+// Settings describes things settings
 // 0|uuid|TEXT|0||1
 // 1|logInterval|INTEGER|0||0
 // 2|manualLogDate|REAL|0||0
 // 3|groupTodayByParent|INTEGER|0||0
-type Setting struct{}
+type Settings struct {
+	UUID               string
+	LogInterval        LogInterval
+	ManualLogDate      *time.Time
+	GroupTodayByParent bool
+	Extras             Extras
+}
+
+// Setting is the former name of Settings.
+//
+// Deprecated: use Settings instead.
+type Setting = Settings
+
+// SettingsActionItemPayload describes the payload for modifying Settings
+type SettingsActionItemPayload struct {
+	LogInterval        *LogInterval        `json:"li,omitempty"`
+	ManualLogDate      Optional[Timestamp] `json:"mld"`
+	GroupTodayByParent *Boolean            `json:"gtp,omitempty"`
+	Extras             Extras              `json:"-"`
+}
+
+// SettingsActionItem describes an event on the settings
+type SettingsActionItem struct {
+	Item
+	P SettingsActionItemPayload `json:"p"`
+}
+
+// UUID returns the UUID of the modified Settings
+func (item SettingsActionItem) UUID() string {
+	return item.Item.UUID
+}
 
 // Area describes an Area inside things. An Area is a container for tasks
 // 0|uuid|TEXT|0||1
@@ -280,17 +438,20 @@ type Setting struct{}
 // 2|visible|INTEGER|0||0
 // 3|index|INTEGER|0||0
 type Area struct {
-	UUID  string
-	Title string
-	Tags  []*Tag
-	Tasks []*Task
+	UUID   string
+	Title  string
+	TagIDs []string
+	Tags   []*Tag
+	Tasks  []*Task
+	Extras Extras
 }
 
 // AreaActionItemPayload describes the payload for modifying Areas
 type AreaActionItemPayload struct {
-	IX     *int     `json:"ix,omitempty"`
-	Title  *string  `json:"tt,omitempty"`
-	TagIDs []string `json:"tg,omitempty"`
+	IX     *int      `json:"ix,omitempty"`
+	Title  *string   `json:"tt,omitempty"`
+	TagIDs *[]string `json:"tg,omitempty"`
+	Extras Extras    `json:"-"`
 }
 
 // AreaActionItem describes an event on an Area
@@ -305,14 +466,14 @@ func (item AreaActionItem) UUID() string {
 }
 
 // CheckListItem describes a check list item
-//0|uuid|TEXT|0||1
-//1|userModificationDate|REAL|0||0
-//2|creationDate|REAL|0||0
-//3|title|TEXT|0||0
-//4|status|INTEGER|0||0
-//5|stopDate|REAL|0||0
-//6|index|INTEGER|0||0
-//7|task|TEXT|0||0
+// 0|uuid|TEXT|0||1
+// 1|userModificationDate|REAL|0||0
+// 2|creationDate|REAL|0||0
+// 3|title|TEXT|0||0
+// 4|status|INTEGER|0||0
+// 5|stopDate|REAL|0||0
+// 6|index|INTEGER|0||0
+// 7|task|TEXT|0||0
 type CheckListItem struct {
 	UUID             string
 	CreationDate     time.Time
@@ -322,17 +483,19 @@ type CheckListItem struct {
 	Index            int
 	CompletionDate   *time.Time
 	TaskIDs          []string
+	Extras           Extras
 }
 
 // CheckListActionItemPayload describes the payload for modifying CheckListItems
 type CheckListActionItemPayload struct {
-	CreationDate     *Timestamp  `json:"cd,omitempty"`
-	ModificationDate *Timestamp  `json:"md,omitempty"`
-	Index            *int        `json:"ix"`
-	Status           *TaskStatus `json:"ss,omitempty"`
-	Title            *string     `json:"tt,omitempty"`
-	CompletionDate   *Timestamp  `json:"sp,omitempty"`
-	TaskIDs          *[]string   `json:"ts,omitempty"`
+	CreationDate     *Timestamp          `json:"cd,omitempty"`
+	ModificationDate *Timestamp          `json:"md,omitempty"`
+	Index            *int                `json:"ix,omitempty"`
+	Status           *TaskStatus         `json:"ss,omitempty"`
+	Title            *string             `json:"tt,omitempty"`
+	CompletionDate   Optional[Timestamp] `json:"sp"`
+	TaskIDs          *[]string           `json:"ts,omitempty"`
+	Extras           Extras              `json:"-"`
 }
 
 // CheckListActionItem describes an event on a check list item
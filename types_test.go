@@ -67,6 +67,23 @@ func TestTimestamp_UnmarshalJSON(t *testing.T) {
 	}
 }
 
+func TestTimestamp_FractionalSeconds(t *testing.T) {
+	var tt Timestamp
+	if err := json.Unmarshal([]byte("1496001956.2693141"), &tt); err != nil {
+		t.Fatal(err.Error())
+	}
+	if ns := time.Time(tt).Nanosecond(); ns != 269314000 {
+		t.Fatalf("Expected fractional seconds to be kept, but got %dns", ns)
+	}
+	bs, err := json.Marshal(&tt)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(bs) != "1496001956.269314" {
+		t.Fatalf("Expected %q but got %q", "1496001956.269314", string(bs))
+	}
+}
+
 func TestTimestamp_MarshalJSON(t *testing.T) {
 	testCases := []struct {
 		Time     time.Time
@@ -74,6 +91,7 @@ func TestTimestamp_MarshalJSON(t *testing.T) {
 	}{
 		{time.Date(2017, time.May, 28, 22, 05, 17, 0, time.UTC), "1496009117"},
 		{time.Time{}, "-62135596800"},
+		{time.Date(2017, time.May, 28, 22, 05, 17, 269314000, time.UTC), "1496009117.269314"},
 	}
 	for _, testCase := range testCases {
 
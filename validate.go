@@ -0,0 +1,438 @@
+package thingscloud
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// References resolves objects referenced by items during validation, e.g. a memory.State.
+// Lookups return nil for unknown UUIDs.
+type References interface {
+	Task(uuid string) *Task
+	Area(uuid string) *Area
+	Tag(uuid string) *Tag
+}
+
+// ErrNotValidatable is returned by ValidateBatch for items which do not implement Validator
+var ErrNotValidatable = errors.New("item can't be validated")
+
+// Validator is implemented by all items which can be validated before being written
+type Validator interface {
+	Validate() error
+	ValidateAgainst(refs References) error
+}
+
+// ValidationError describes a single invalid field of an item
+type ValidationError struct {
+	UUID   string
+	Kind   ItemKind
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s %s: %s %s", e.Kind, e.UUID, e.Field, e.Reason)
+}
+
+// ValidationErrors collects all problems of an item or batch
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type validation struct {
+	item Item
+	errs ValidationErrors
+}
+
+func (v *validation) fail(field, reason string, args ...interface{}) {
+	v.errs = append(v.errs, &ValidationError{
+		UUID:   v.item.UUID,
+		Kind:   v.item.Kind,
+		Field:  field,
+		Reason: fmt.Sprintf(reason, args...),
+	})
+}
+
+func (v *validation) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// header validates the fields shared by all items. It returns false if the payload
+// does not need to be validated, e.g. for deletions
+func (v *validation) header(kind ItemKind) bool {
+	if v.item.UUID == "" {
+		v.fail("uuid", "is missing")
+	}
+	if v.item.Kind != kind {
+		v.fail("e", "must be %q", kind)
+	}
+	switch v.item.Action {
+	case ItemActionCreated, ItemActionModified:
+		return true
+	case ItemActionDeleted:
+		return false
+	default:
+		v.fail("t", "unknown action %d", v.item.Action)
+		return false
+	}
+}
+
+func (v *validation) status(field string, status *TaskStatus) {
+	if status == nil {
+		return
+	}
+	switch *status {
+	case TaskStatusPending, TaskStatusCanceled, TaskStatusCompleted:
+	default:
+		v.fail(field, "unknown status %d", *status)
+	}
+}
+
+func (v *validation) single(field string, ids *[]string) {
+	if ids != nil && len(*ids) > 1 {
+		v.fail(field, "must not reference more than one object")
+	}
+}
+
+func (v *validation) tags(field string, refs References, tagIDs *[]string) {
+	if refs == nil || tagIDs == nil {
+		return
+	}
+	for _, id := range *tagIDs {
+		if refs.Tag(id) == nil {
+			v.fail(field, "references unknown tag %s", id)
+		}
+	}
+}
+
+// Validate checks the item for inconsistencies which would corrupt the data of other devices
+func (t TaskActionItem) Validate() error {
+	return t.ValidateAgainst(nil)
+}
+
+// ValidateAgainst validates the item and ensures that all referenced objects exist in refs
+func (t TaskActionItem) ValidateAgainst(refs References) error {
+	v := &validation{item: t.Item}
+	if !v.header(ItemKindTask) {
+		return v.err()
+	}
+
+	var existing *Task
+	if refs != nil {
+		existing = refs.Task(t.UUID())
+	}
+	if t.Action == ItemActionModified && refs != nil && existing == nil {
+		v.fail("uuid", "references unknown task")
+	}
+
+	v.status("ss", t.P.Status)
+	if t.P.Schedule != nil {
+		switch *t.P.Schedule {
+		case TaskScheduleToday, TaskScheduleAnytime, TaskScheduleSomeday:
+		default:
+			v.fail("st", "unknown schedule %d", *t.P.Schedule)
+		}
+	}
+	if t.P.Type != nil {
+		switch *t.P.Type {
+		case TaskTypeTask, TaskTypeProject, TaskTypeHeading:
+		default:
+			v.fail("tp", "unknown type %d", *t.P.Type)
+		}
+	}
+	if t.P.StartBucket != nil {
+		switch *t.P.StartBucket {
+		case StartBucketDay, StartBucketEvening:
+		default:
+			v.fail("sb", "unknown start bucket %d", *t.P.StartBucket)
+		}
+	}
+	v.single("ar", t.P.AreaIDs)
+	v.single("pr", t.P.ParentTaskIDs)
+	v.single("agr", t.P.ActionGroupIDs)
+
+	// whether the task has a start date once the item is applied. Without refs the start date
+	// of existing tasks is unknown, so only explicit changes can be checked
+	hasDate := existing != nil && existing.ScheduledDate != nil
+	dateKnown := t.Action == ItemActionCreated || refs != nil
+	if t.P.ScheduledDate.IsSet() {
+		_, hasDate = t.P.ScheduledDate.Get()
+		dateKnown = true
+	}
+
+	// tasks in today need a start date
+	if t.P.Schedule != nil && *t.P.Schedule == TaskScheduleToday && !hasDate && dateKnown {
+		v.fail("sr", "is required for tasks scheduled for today")
+	}
+
+	if ato, ok := t.P.AlarmTimeOffset.Get(); ok {
+		if ato < 0 || ato >= (24*time.Hour).Seconds() {
+			v.fail("ato", "must be within the scheduled day")
+		}
+		if !hasDate && dateKnown {
+			v.fail("ato", "requires a start date")
+		}
+	}
+
+	if rr, ok := t.P.Repeater.Get(); ok {
+		if err := rr.Validate(); err != nil {
+			v.fail("rr", "%v", err)
+		}
+	}
+
+	taskType := TaskTypeTask
+	if existing != nil {
+		taskType = existing.Type
+	}
+	if t.P.Type != nil {
+		taskType = *t.P.Type
+	}
+	parentIDs := []string{}
+	if existing != nil {
+		parentIDs = existing.ParentTaskIDs
+	}
+	if t.P.ParentTaskIDs != nil {
+		parentIDs = *t.P.ParentTaskIDs
+	}
+	if taskType == TaskTypeProject && len(parentIDs) > 0 {
+		v.fail("pr", "projects must not be nested")
+	}
+	if taskType == TaskTypeHeading && len(parentIDs) == 0 && (t.Action == ItemActionCreated || t.P.ParentTaskIDs != nil) {
+		v.fail("pr", "headings must belong to a project")
+	}
+	for _, id := range parentIDs {
+		if id == t.UUID() {
+			v.fail("pr", "must not reference the task itself")
+		}
+	}
+
+	if refs != nil {
+		if t.P.ParentTaskIDs != nil {
+			for _, id := range *t.P.ParentTaskIDs {
+				parent := refs.Task(id)
+				if parent == nil {
+					v.fail("pr", "references unknown task %s", id)
+				} else if parent.Type != TaskTypeProject {
+					v.fail("pr", "references %s which is no project", id)
+				}
+			}
+		}
+		if t.P.AreaIDs != nil {
+			for _, id := range *t.P.AreaIDs {
+				if refs.Area(id) == nil {
+					v.fail("ar", "references unknown area %s", id)
+				}
+			}
+		}
+		if t.P.ActionGroupIDs != nil {
+			for _, id := range *t.P.ActionGroupIDs {
+				heading := refs.Task(id)
+				if heading == nil {
+					v.fail("agr", "references unknown heading %s", id)
+				} else if heading.Type != TaskTypeHeading {
+					v.fail("agr", "references %s which is no heading", id)
+				}
+			}
+		}
+		v.tags("tg", refs, t.P.TagIDs)
+	}
+	return v.err()
+}
+
+// Validate checks the item for inconsistencies which would corrupt the data of other devices
+func (item CheckListActionItem) Validate() error {
+	return item.ValidateAgainst(nil)
+}
+
+// ValidateAgainst validates the item and ensures that all referenced objects exist in refs
+func (item CheckListActionItem) ValidateAgainst(refs References) error {
+	v := &validation{item: item.Item}
+	if !v.header(ItemKindChecklistItem) {
+		return v.err()
+	}
+
+	v.status("ss", item.P.Status)
+	if item.P.TaskIDs == nil && item.Action == ItemActionCreated {
+		v.fail("ts", "is required")
+	}
+	if item.P.TaskIDs != nil {
+		if len(*item.P.TaskIDs) != 1 {
+			v.fail("ts", "must reference exactly one task")
+		}
+		if refs != nil {
+			for _, id := range *item.P.TaskIDs {
+				if refs.Task(id) == nil {
+					v.fail("ts", "references unknown task %s", id)
+				}
+			}
+		}
+	}
+	return v.err()
+}
+
+// Validate checks the item for inconsistencies which would corrupt the data of other devices
+func (item AreaActionItem) Validate() error {
+	return item.ValidateAgainst(nil)
+}
+
+// ValidateAgainst validates the item and ensures that all referenced objects exist in refs
+func (item AreaActionItem) ValidateAgainst(refs References) error {
+	v := &validation{item: item.Item}
+	if !v.header(ItemKindArea) {
+		return v.err()
+	}
+	if item.Action == ItemActionModified && refs != nil && refs.Area(item.UUID()) == nil {
+		v.fail("uuid", "references unknown area")
+	}
+	v.tags("tg", refs, item.P.TagIDs)
+	return v.err()
+}
+
+// Validate checks the item for inconsistencies which would corrupt the data of other devices
+func (t TagActionItem) Validate() error {
+	return t.ValidateAgainst(nil)
+}
+
+// ValidateAgainst validates the item and ensures that all referenced objects exist in refs
+func (t TagActionItem) ValidateAgainst(refs References) error {
+	v := &validation{item: t.Item}
+	if !v.header(ItemKindTag) {
+		return v.err()
+	}
+	if t.Action == ItemActionModified && refs != nil && refs.Tag(t.UUID()) == nil {
+		v.fail("uuid", "references unknown tag")
+	}
+	v.single("pn", t.P.ParentTagIDs)
+	if t.P.ParentTagIDs != nil {
+		for _, id := range *t.P.ParentTagIDs {
+			if id == t.UUID() {
+				v.fail("pn", "must not reference the tag itself")
+			}
+		}
+		v.tags("pn", refs, t.P.ParentTagIDs)
+	}
+	return v.err()
+}
+
+// Validate checks the item for inconsistencies which would corrupt the data of other devices
+func (item SettingsActionItem) Validate() error {
+	return item.ValidateAgainst(nil)
+}
+
+// ValidateAgainst validates the item. Settings do not reference other objects
+func (item SettingsActionItem) ValidateAgainst(refs References) error {
+	v := &validation{item: item.Item}
+	if !v.header(ItemKindSettings) {
+		return v.err()
+	}
+	if item.P.LogInterval != nil {
+		switch *item.P.LogInterval {
+		case LogIntervalImmediately, LogIntervalDaily, LogIntervalManually:
+		default:
+			v.fail("li", "unknown log interval %d", *item.P.LogInterval)
+		}
+	}
+	return v.err()
+}
+
+// batchReferences resolves objects created within the same batch in addition to refs
+type batchReferences struct {
+	refs  References
+	tasks map[string]*Task
+	areas map[string]*Area
+	tags  map[string]*Tag
+}
+
+func newBatchReferences(refs References, items []Identifiable) *batchReferences {
+	b := &batchReferences{
+		refs:  refs,
+		tasks: map[string]*Task{},
+		areas: map[string]*Area{},
+		tags:  map[string]*Tag{},
+	}
+	for _, item := range items {
+		switch i := item.(type) {
+		case TaskActionItem:
+			if i.Action == ItemActionCreated {
+				task := &Task{UUID: i.UUID(), ScheduledDate: i.P.ScheduledDate.Ptr()}
+				if i.P.Type != nil {
+					task.Type = *i.P.Type
+				}
+				b.tasks[i.UUID()] = task
+			} else if task, ok := b.tasks[i.UUID()]; ok && i.P.ScheduledDate.IsSet() {
+				task.ScheduledDate = i.P.ScheduledDate.Ptr()
+			}
+		case AreaActionItem:
+			if i.Action == ItemActionCreated {
+				b.areas[i.UUID()] = &Area{UUID: i.UUID()}
+			}
+		case TagActionItem:
+			if i.Action == ItemActionCreated {
+				b.tags[i.UUID()] = &Tag{UUID: i.UUID()}
+			}
+		}
+	}
+	return b
+}
+
+func (b *batchReferences) Task(uuid string) *Task {
+	if t, ok := b.tasks[uuid]; ok {
+		return t
+	}
+	return b.refs.Task(uuid)
+}
+
+func (b *batchReferences) Area(uuid string) *Area {
+	if a, ok := b.areas[uuid]; ok {
+		return a
+	}
+	return b.refs.Area(uuid)
+}
+
+func (b *batchReferences) Tag(uuid string) *Tag {
+	if t, ok := b.tags[uuid]; ok {
+		return t
+	}
+	return b.refs.Tag(uuid)
+}
+
+// ValidateBatch validates all items. Items which do not implement Validator are rejected with
+// ErrNotValidatable. If refs is given, objects created within the batch may be referenced by other
+// items of the batch.
+func ValidateBatch(refs References, items ...Identifiable) error {
+	var batchRefs References
+	if refs != nil {
+		batchRefs = newBatchReferences(refs, items)
+	}
+	errs := ValidationErrors{}
+	for _, item := range items {
+		v, ok := item.(Validator)
+		if !ok {
+			return fmt.Errorf("%w: %T %s", ErrNotValidatable, item, item.UUID())
+		}
+		err := v.ValidateAgainst(batchRefs)
+		if err == nil {
+			continue
+		}
+		if verrs, ok := err.(ValidationErrors); ok {
+			errs = append(errs, verrs...)
+		} else {
+			return err
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
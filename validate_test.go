@@ -0,0 +1,257 @@
+package thingscloud
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeReferences struct {
+	tasks map[string]*Task
+	areas map[string]*Area
+	tags  map[string]*Tag
+}
+
+func (r fakeReferences) Task(uuid string) *Task { return r.tasks[uuid] }
+func (r fakeReferences) Area(uuid string) *Area { return r.areas[uuid] }
+func (r fakeReferences) Tag(uuid string) *Tag   { return r.tags[uuid] }
+
+func newFakeReferences() fakeReferences {
+	return fakeReferences{
+		tasks: map[string]*Task{
+			"project": {UUID: "project", Type: TaskTypeProject},
+			"task":    {UUID: "task"},
+			"today":   {UUID: "today", ScheduledDate: &Day{}},
+			"heading": {UUID: "heading", Type: TaskTypeHeading, ParentTaskIDs: []string{"project"}},
+		},
+		areas: map[string]*Area{"area": {UUID: "area"}},
+		tags:  map[string]*Tag{"tag": {UUID: "tag"}},
+	}
+}
+
+func validationFields(err error) []string {
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+	fields := []string{}
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	return fields
+}
+
+// inToday moves the task to today without changing its start date
+func inToday(b *TaskBuilder) TaskActionItem {
+	item := b.Build()
+	item.P.Schedule = Schedule(TaskScheduleToday)
+	return item
+}
+
+func TestTaskActionItem_Validate(t *testing.T) {
+	invalidStatus := TaskStatus(1)
+	invalidSchedule := TaskSchedule(5)
+
+	testCases := []struct {
+		Title  string
+		Item   TaskActionItem
+		Fields []string
+	}{
+		{"valid task", NewTask("a").Build(), nil},
+		{"valid today", NewTask("a").Today().Build(), nil},
+		{"valid scheduled", NewTask("a").ScheduledFor(time.Now().AddDate(0, 0, 1)).Build(), nil},
+		{"delete", DeleteTask("a"), nil},
+		{"invalid status", func() TaskActionItem {
+			item := NewTask("a").Build()
+			item.P.Status = &invalidStatus
+			return item
+		}(), []string{"ss"}},
+		{"invalid schedule", func() TaskActionItem {
+			item := NewTask("a").Build()
+			item.P.Schedule = &invalidSchedule
+			return item
+		}(), []string{"st"}},
+		{"today without date", inToday(NewTask("a")), []string{"sr"}},
+		{"today clearing date", inToday(EditTask("a").Unscheduled()), []string{"sr"}},
+		{"today keeping date", inToday(EditTask("a")), nil},
+		{"nested project", NewProject("a").InProject(&Task{UUID: "project"}).Build(), []string{"pr"}},
+		{"task in itself", EditTask("a").InProject(&Task{UUID: "a"}).Build(), []string{"pr"}},
+		{"heading without project", func() TaskActionItem {
+			item := NewTask("a").Build()
+			item.P.Type = Type(TaskTypeHeading)
+			return item
+		}(), []string{"pr"}},
+		{"invalid type", func() TaskActionItem {
+			item := NewTask("a").Build()
+			item.P.Type = Type(TaskType(3))
+			return item
+		}(), []string{"tp"}},
+		{"weekly repeater without weekday", func() TaskActionItem {
+			item := NewTask("a").Build()
+			item.P.Repeater = Some(RepeaterConfiguration{FirstScheduledAt: Time(time.Now()), FrequencyUnit: FrequencyUnitWeekly, FrequencyAmplitude: 1, DetailConfiguration: []RepeaterDetailConfiguration{{}}})
+			return item
+		}(), []string{"rr"}},
+		{"missing uuid", EditTask("").Build(), []string{"uuid"}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Title, func(t *testing.T) {
+			fields := validationFields(testCase.Item.Validate())
+			if fmt.Sprint(fields) != fmt.Sprint(testCase.Fields) {
+				t.Fatalf("Expected errors for %v but got %v", testCase.Fields, fields)
+			}
+		})
+	}
+}
+
+func TestTaskActionItem_ValidateAgainst(t *testing.T) {
+	refs := newFakeReferences()
+
+	testCases := []struct {
+		Title  string
+		Item   TaskActionItem
+		Fields []string
+	}{
+		{"valid", NewTask("a").InProject(refs.tasks["project"]).InArea(refs.areas["area"]).WithTags(refs.tags["tag"]).Build(), nil},
+		{"unknown project", NewTask("a").InProject(&Task{UUID: "missing"}).Build(), []string{"pr"}},
+		{"parent is no project", NewTask("a").InProject(refs.tasks["task"]).Build(), []string{"pr"}},
+		{"unknown area", NewTask("a").InArea(&Area{UUID: "missing"}).Build(), []string{"ar"}},
+		{"unknown tag", NewTask("a").WithTags(&Tag{UUID: "missing"}).Build(), []string{"tg"}},
+		{"unknown task", EditTask("missing").WithTitle("b").Build(), []string{"uuid"}},
+		{"today keeps date", inToday(EditTask("today")), nil},
+		{"today without date", inToday(EditTask("task")), []string{"sr"}},
+		{"project nested", EditTask("task").AsProject().InProject(refs.tasks["project"]).Build(), []string{"pr"}},
+		{"under heading", NewTask("a").UnderHeading(refs.tasks["heading"].Heading()).Build(), nil},
+		{"under task", NewTask("a").UnderHeading(&Heading{UUID: "task"}).Build(), []string{"agr"}},
+		{"heading in unknown project", EditTask("heading").InProject(&Task{UUID: "missing"}).Build(), []string{"pr"}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Title, func(t *testing.T) {
+			fields := validationFields(testCase.Item.ValidateAgainst(refs))
+			if fmt.Sprint(fields) != fmt.Sprint(testCase.Fields) {
+				t.Fatalf("Expected errors for %v but got %v", testCase.Fields, fields)
+			}
+		})
+	}
+}
+
+func TestCheckListActionItem_Validate(t *testing.T) {
+	refs := newFakeReferences()
+
+	testCases := []struct {
+		Title  string
+		Item   CheckListActionItem
+		Refs   References
+		Fields []string
+	}{
+		{"valid", NewCheckListItem("a").InTask(refs.tasks["task"]).Build(), refs, nil},
+		{"without task", NewCheckListItem("a").Build(), nil, []string{"ts"}},
+		{"unknown task", NewCheckListItem("a").InTask(&Task{UUID: "missing"}).Build(), refs, []string{"ts"}},
+		{"edit", EditCheckListItem("a").Complete().Build(), nil, nil},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.Title, func(t *testing.T) {
+			fields := validationFields(testCase.Item.ValidateAgainst(testCase.Refs))
+			if fmt.Sprint(fields) != fmt.Sprint(testCase.Fields) {
+				t.Fatalf("Expected errors for %v but got %v", testCase.Fields, fields)
+			}
+		})
+	}
+}
+
+func TestTagActionItem_Validate(t *testing.T) {
+	refs := newFakeReferences()
+
+	if err := NewTag("a").InParent(refs.tags["tag"]).Build().ValidateAgainst(refs); err != nil {
+		t.Fatalf("Expected tag to be valid, got %v", err)
+	}
+	if err := NewTag("a").InParent(&Tag{UUID: "missing"}).Build().ValidateAgainst(refs); err == nil {
+		t.Fatal("Expected unknown parent tag to be rejected")
+	}
+	tag := EditTag("a").Build()
+	tag.P.ParentTagIDs = &[]string{"a"}
+	if err := tag.Validate(); err == nil {
+		t.Fatal("Expected tag nested in itself to be rejected")
+	}
+}
+
+func TestValidateBatch(t *testing.T) {
+	refs := newFakeReferences()
+
+	project := NewProject("project").Build()
+	task := NewTask("task").InProject(&Task{UUID: project.UUID(), Type: TaskTypeProject})
+	if err := ValidateBatch(refs, project, task.Build()); err != nil {
+		t.Fatalf("Expected objects created within the batch to be referencable, got %v", err)
+	}
+
+	scheduled := NewTask("scheduled").ScheduledOn(NewDay(2017, time.May, 24)).Build()
+	if err := ValidateBatch(refs, scheduled, inToday(EditTask(scheduled.UUID()))); err != nil {
+		t.Fatalf("Expected start date of tasks created within the batch to be known, got %v", err)
+	}
+	unscheduled := NewTask("unscheduled").Build()
+	err := ValidateBatch(refs, unscheduled, inToday(EditTask(unscheduled.UUID())))
+	if fields := validationFields(err); fmt.Sprint(fields) != "[sr]" {
+		t.Fatalf("Expected today without start date to be rejected, got %v", fields)
+	}
+
+	err = ValidateBatch(refs, task.Build(), inToday(NewTask("today")))
+	if fields := validationFields(err); fmt.Sprint(fields) != "[pr sr]" {
+		t.Fatalf("Expected errors of all items, got %v", fields)
+	}
+}
+
+// opaqueItem is an Identifiable whose payload is unknown to the SDK
+type opaqueItem struct{}
+
+func (opaqueItem) UUID() string { return "opaque" }
+
+func TestHistory_Write(t *testing.T) {
+	t.Run("Strict rejects invalid batches", func(t *testing.T) {
+		t.Parallel()
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			fmt.Fprint(w, `{"server-head-index":1}`)
+		}))
+		defer server.Close()
+
+		c := New(fmt.Sprintf("http://%s", server.Listener.Addr().String()), "martin@example.com", "")
+		h := History{Client: c, ID: "33333abb-bfe4-4b03-a5c9-106d42220c72", Strict: true, References: newFakeReferences()}
+		err := h.Write(NewTask("a").InArea(&Area{UUID: "missing"}).Build())
+		var errs ValidationErrors
+		if !errors.As(err, &errs) {
+			t.Fatalf("Expected validation error, got %v", err)
+		}
+		if requests != 0 {
+			t.Fatalf("Expected invalid batch not to be sent, but got %d requests", requests)
+		}
+
+		if err := h.Write(NewTask("a").InArea(&Area{UUID: "area"}).Build()); err != nil {
+			t.Fatalf("Expected valid batch to be written, got %v", err)
+		}
+		if requests != 1 {
+			t.Fatalf("Expected valid batch to be sent, but got %d requests", requests)
+		}
+	})
+
+	t.Run("Strict rejects items which can't be validated", func(t *testing.T) {
+		t.Parallel()
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			fmt.Fprint(w, `{"server-head-index":1}`)
+		}))
+		defer server.Close()
+
+		c := New(fmt.Sprintf("http://%s", server.Listener.Addr().String()), "martin@example.com", "")
+		h := History{Client: c, ID: "33333abb-bfe4-4b03-a5c9-106d42220c72", Strict: true}
+		if err := h.Write(NewTask("a").Build(), opaqueItem{}); !errors.Is(err, ErrNotValidatable) {
+			t.Fatalf("Expected %v, got %v", ErrNotValidatable, err)
+		}
+		if requests != 0 {
+			t.Fatalf("Expected batch not to be sent, but got %d requests", requests)
+		}
+	})
+}